@@ -0,0 +1,264 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3/internal/utf16le"
+)
+
+// ADReason is the reason of an Active Directory error, derived from the
+// sub-code of the diagnostic message
+type ADReason int
+
+// Reasons of Active Directory errors
+const (
+	// ADReasonUnknown is used for sub-codes without a named reason
+	ADReasonUnknown ADReason = iota
+	// ADReasonUserNotFound - data 525
+	ADReasonUserNotFound
+	// ADReasonBadPassword - data 52e
+	ADReasonBadPassword
+	// ADReasonLogonHours - data 530, logon not permitted at this time
+	ADReasonLogonHours
+	// ADReasonWorkstation - data 531, logon not permitted from this workstation
+	ADReasonWorkstation
+	// ADReasonPasswordExpired - data 532
+	ADReasonPasswordExpired
+	// ADReasonAccountDisabled - data 533
+	ADReasonAccountDisabled
+	// ADReasonAccountExpired - data 701
+	ADReasonAccountExpired
+	// ADReasonMustResetPassword - data 773
+	ADReasonMustResetPassword
+	// ADReasonAccountLocked - data 775
+	ADReasonAccountLocked
+)
+
+// adReasons maps the sub-codes of Active Directory to reasons
+var adReasons = map[uint32]ADReason{
+	0x525: ADReasonUserNotFound,
+	0x52e: ADReasonBadPassword,
+	0x530: ADReasonLogonHours,
+	0x531: ADReasonWorkstation,
+	0x532: ADReasonPasswordExpired,
+	0x533: ADReasonAccountDisabled,
+	0x701: ADReasonAccountExpired,
+	0x773: ADReasonMustResetPassword,
+	0x775: ADReasonAccountLocked,
+}
+
+// adPasswordPolicyCodes maps Active Directory reasons to password policy
+// errors
+var adPasswordPolicyCodes = map[ADReason]int8{
+	ADReasonPasswordExpired:   BeheraPasswordExpired,
+	ADReasonMustResetPassword: BeheraChangeAfterReset,
+	ADReasonAccountLocked:     BeheraAccountLocked,
+}
+
+// ADReasonMap contains human readable descriptions of Active Directory reasons
+var ADReasonMap = map[ADReason]string{
+	ADReasonUnknown:           "Unknown",
+	ADReasonUserNotFound:      "User not found",
+	ADReasonBadPassword:       "Bad password",
+	ADReasonLogonHours:        "Logon not permitted at this time",
+	ADReasonWorkstation:       "Logon not permitted from this workstation",
+	ADReasonPasswordExpired:   "Password expired",
+	ADReasonAccountDisabled:   "Account disabled",
+	ADReasonAccountExpired:    "Account expired",
+	ADReasonMustResetPassword: "Password must be reset",
+	ADReasonAccountLocked:     "Account locked",
+}
+
+func (r ADReason) String() string {
+	return ADReasonMap[r]
+}
+
+// ADDiagnostic is the decoded diagnostic message of an Active Directory
+// error, e.g. "80090308: LdapErr: DSID-0C09041C, comment: AcceptSecurityContext
+// error, data 52e, v4563"
+type ADDiagnostic struct {
+	// Win32Error is the error code the message starts with, e.g. 0x80090308
+	// or 0x52d
+	Win32Error uint32
+	// DSID identifies the location in the source code of the domain
+	// controller, e.g. "DSID-0C09041C"
+	DSID string
+	// Comment is the comment of the message, if any, e.g.
+	// "AcceptSecurityContext error"
+	Comment string
+	// Problem is the problem code of the message, if any, e.g. 1005 for
+	// "problem 1005 (CONSTRAINT_ATT_TYPE)"
+	Problem uint32
+	// SubCode is the data code of the message, e.g. 0x52e
+	SubCode uint32
+	// Reason is the named reason of the sub-code
+	Reason ADReason
+}
+
+var (
+	adWin32ErrorPattern = regexp.MustCompile(`^([0-9A-Fa-f]{8}): `)
+	adDSIDPattern       = regexp.MustCompile(`\bDSID-[0-9A-Fa-f]+\b`)
+	adCommentPattern    = regexp.MustCompile(`\bcomment: ([^,]*)`)
+	adProblemPattern    = regexp.MustCompile(`\bproblem ([0-9]+)\b`)
+	adDataPattern       = regexp.MustCompile(`\bdata ([0-9A-Fa-f]+)\b`)
+)
+
+// ParseADDiagnostic decodes the diagnostic message of an Active Directory
+// error. It returns false if the message neither starts with a Win32 error
+// code like the messages of Active Directory nor contains a data sub-code.
+func ParseADDiagnostic(message string) (*ADDiagnostic, bool) {
+	message = strings.TrimRight(message, "\x00\r\n")
+	match := adWin32ErrorPattern.FindStringSubmatch(message)
+	if match == nil && !adDataPattern.MatchString(message) {
+		return nil, false
+	}
+	diagnostic := &ADDiagnostic{
+		DSID: adDSIDPattern.FindString(message),
+	}
+	if match != nil {
+		win32Error, _ := strconv.ParseUint(match[1], 16, 32)
+		diagnostic.Win32Error = uint32(win32Error)
+	}
+	if match := adCommentPattern.FindStringSubmatch(message); match != nil {
+		diagnostic.Comment = strings.TrimSpace(match[1])
+	}
+	if match := adProblemPattern.FindStringSubmatch(message); match != nil {
+		problem, _ := strconv.ParseUint(match[1], 10, 32)
+		diagnostic.Problem = uint32(problem)
+	}
+	if match := adDataPattern.FindStringSubmatch(message); match != nil {
+		subCode, _ := strconv.ParseUint(match[1], 16, 32)
+		diagnostic.SubCode = uint32(subCode)
+		diagnostic.Reason = adReasons[diagnostic.SubCode]
+	}
+	return diagnostic, true
+}
+
+// ADDiagnostic decodes the diagnostic message of an error returned by Active
+// Directory, see ParseADDiagnostic. The message of Err is used for errors
+// without a diagnostic message, e.g. those created by NewError.
+func (e *Error) ADDiagnostic() (*ADDiagnostic, bool) {
+	if e.DiagnosticMessage == "" && e.Err != nil {
+		return ParseADDiagnostic(e.Err.Error())
+	}
+	return ParseADDiagnostic(e.DiagnosticMessage)
+}
+
+// GetADDiagnostic decodes the diagnostic message of the LDAP error wrapped by
+// err, see ParseADDiagnostic
+func GetADDiagnostic(err error) (*ADDiagnostic, bool) {
+	var ldapErr *Error
+	if !errors.As(err, &ldapErr) {
+		return nil, false
+	}
+	return ldapErr.ADDiagnostic()
+}
+
+var (
+	// ErrUnencryptedConnection is returned by SetADPassword and
+	// ChangeADPassword if the connection is neither protected by TLS nor
+	// sealed by a SASL security layer, as Active Directory rejects password
+	// changes on such connections
+	ErrUnencryptedConnection = errors.New("ldap: Active Directory passwords can only be set over an encrypted connection")
+	// ErrADPasswordRestriction is returned by SetADPassword and
+	// ChangeADPassword if the new password does not meet the password policy
+	// of the domain, e.g. its length, complexity, history or minimum age
+	ErrADPasswordRestriction = errors.New("ldap: password does not meet the password policy of the domain")
+)
+
+// Win32 errors of Active Directory password changes
+const (
+	adErrorInvalidPassword     = 0x56
+	adErrorPasswordRestriction = 0x52d
+)
+
+// adPasswordRestrictions maps the password restrictions reported by Samba in
+// the diagnostic message to password policy errors. Active Directory does not
+// tell which restriction was violated.
+var adPasswordRestrictions = []struct {
+	message string
+	code    int8
+}{
+	{"in history", BeheraPasswordInHistory},
+	{"complexity", BeheraInsufficientPasswordQuality},
+	{"too young", BeheraPasswordTooYoung},
+	{"too short", BeheraPasswordTooShort},
+}
+
+// NewADPasswordSetRequest returns a request setting the unicodePwd attribute
+// of the entry, as done by administrators resetting the password
+func NewADPasswordSetRequest(dn, password string) *ModifyRequest {
+	req := NewModifyRequest(dn, nil)
+	req.Replace("unicodePwd", []string{encodeADPassword(password)})
+	return req
+}
+
+// NewADPasswordChangeRequest returns a request changing the unicodePwd
+// attribute of the entry from the old to the new password, as done by users
+// changing their own password
+func NewADPasswordChangeRequest(dn, oldPassword, newPassword string) *ModifyRequest {
+	req := NewModifyRequest(dn, nil)
+	req.Delete("unicodePwd", []string{encodeADPassword(oldPassword)})
+	req.Add("unicodePwd", []string{encodeADPassword(newPassword)})
+	return req
+}
+
+// encodeADPassword returns the password quoted and encoded as UTF-16LE, as
+// required for the unicodePwd attribute
+func encodeADPassword(password string) string {
+	return string(utf16le.Encode(`"` + password + `"`))
+}
+
+// SetADPassword resets the password of the Active Directory entry, which
+// requires the right to reset passwords. The connection must be encrypted,
+// otherwise ErrUnencryptedConnection is returned. If the password is rejected,
+// the error wraps ErrADPasswordRestriction and, if the server reported the
+// reason, a PasswordPolicyError.
+func (l *Conn) SetADPassword(dn, password string) error {
+	return l.modifyADPassword(NewADPasswordSetRequest(dn, password))
+}
+
+// ChangeADPassword changes the password of the Active Directory entry from the
+// old to the new password, which is allowed for the user itself. The errors
+// are those of SetADPassword, and ErrInvalidCredentials is wrapped if the old
+// password is wrong.
+func (l *Conn) ChangeADPassword(dn, oldPassword, newPassword string) error {
+	return l.modifyADPassword(NewADPasswordChangeRequest(dn, oldPassword, newPassword))
+}
+
+func (l *Conn) modifyADPassword(req *ModifyRequest) error {
+	if !l.encrypted() {
+		return ErrUnencryptedConnection
+	}
+	return adPasswordError(l.Modify(req))
+}
+
+// adPasswordError maps the Win32 error of a rejected password change to
+// ErrInvalidCredentials or ErrADPasswordRestriction
+func adPasswordError(err error) error {
+	var ldapErr *Error
+	if !errors.As(err, &ldapErr) {
+		return err
+	}
+	diagnostic, ok := ldapErr.ADDiagnostic()
+	if !ok {
+		return err
+	}
+	switch diagnostic.Win32Error {
+	case adErrorInvalidPassword:
+		return fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	case adErrorPasswordRestriction:
+		message := strings.ToLower(ldapErr.DiagnosticMessage)
+		for _, restriction := range adPasswordRestrictions {
+			if strings.Contains(message, restriction.message) {
+				return fmt.Errorf("%w: %w", ErrADPasswordRestriction, &PasswordPolicyError{Code: restriction.code, Err: err})
+			}
+		}
+		return fmt.Errorf("%w: %w", ErrADPasswordRestriction, err)
+	}
+	return err
+}
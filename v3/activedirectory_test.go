@@ -0,0 +1,182 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseADDiagnostic(t *testing.T) {
+	for _, tt := range []struct {
+		message  string
+		expected *ADDiagnostic
+	}{
+		{
+			message: "80090308: LdapErr: DSID-0C09041C, comment: AcceptSecurityContext error, data 52e, v4563\x00",
+			expected: &ADDiagnostic{
+				Win32Error: 0x80090308,
+				DSID:       "DSID-0C09041C",
+				Comment:    "AcceptSecurityContext error",
+				SubCode:    0x52e,
+				Reason:     ADReasonBadPassword,
+			},
+		},
+		{
+			message: "80090308: LdapErr: DSID-0C09044E, comment: AcceptSecurityContext error, data 533, v2580",
+			expected: &ADDiagnostic{
+				Win32Error: 0x80090308,
+				DSID:       "DSID-0C09044E",
+				Comment:    "AcceptSecurityContext error",
+				SubCode:    0x533,
+				Reason:     ADReasonAccountDisabled,
+			},
+		},
+		{
+			message: "80090308: LdapErr: DSID-0C09041C, comment: AcceptSecurityContext error, data 530, v4563",
+			expected: &ADDiagnostic{
+				Win32Error: 0x80090308,
+				DSID:       "DSID-0C09041C",
+				Comment:    "AcceptSecurityContext error",
+				SubCode:    0x530,
+				Reason:     ADReasonLogonHours,
+			},
+		},
+		{
+			message: "0000052D: Constraint violation - check password restrictions: SvcErr: DSID-031A1236, problem 1005 (CONSTRAINT_ATT_TYPE), data 0\n\x00",
+			expected: &ADDiagnostic{
+				Win32Error: 0x52d,
+				DSID:       "DSID-031A1236",
+				Problem:    1005,
+			},
+		},
+	} {
+		diagnostic, ok := ParseADDiagnostic(tt.message)
+		if assert.True(t, ok, tt.message) {
+			assert.Equal(t, tt.expected, diagnostic)
+		}
+	}
+
+	_, ok := ParseADDiagnostic("invalid credentials")
+	assert.False(t, ok)
+	assert.Equal(t, "Password must be reset", ADReasonMustResetPassword.String())
+}
+
+func TestGetADDiagnostic(t *testing.T) {
+	// decode the packets like the reader does
+	packet := ber.DecodePacket(encodeTestResult(1, ApplicationBindResponse, LDAPResultInvalidCredentials).Bytes())
+	_, ok := GetADDiagnostic(GetLDAPError(packet))
+	assert.False(t, ok)
+
+	message := "80090308: LdapErr: DSID-0C09041C, comment: AcceptSecurityContext error, data 775, v4563"
+	packet = ber.DecodePacket(encodeTestErrorResult(1, ApplicationBindResponse, LDAPResultInvalidCredentials, message).Bytes())
+	diagnostic, ok := GetADDiagnostic(GetLDAPError(packet))
+	if assert.True(t, ok) {
+		assert.Equal(t, ADReasonAccountLocked, diagnostic.Reason)
+	}
+}
+
+func TestADPasswordRequests(t *testing.T) {
+	// "\"ä€\"" in UTF-16LE
+	encoded := "\x22\x00\xe4\x00\xac\x20\x22\x00"
+
+	req := NewADPasswordSetRequest("cn=jdoe,dc=example,dc=org", "ä€")
+	if assert.Len(t, req.Changes, 1) {
+		assert.Equal(t, uint(ReplaceAttribute), req.Changes[0].Operation)
+		assert.Equal(t, PartialAttribute{Type: "unicodePwd", Vals: []string{encoded}}, req.Changes[0].Modification)
+	}
+
+	req = NewADPasswordChangeRequest("cn=jdoe,dc=example,dc=org", "old", "ä€")
+	if assert.Len(t, req.Changes, 2) {
+		assert.Equal(t, uint(DeleteAttribute), req.Changes[0].Operation)
+		assert.Equal(t, PartialAttribute{Type: "unicodePwd", Vals: []string{"\x22\x00o\x00l\x00d\x00\x22\x00"}}, req.Changes[0].Modification)
+		assert.Equal(t, uint(AddAttribute), req.Changes[1].Operation)
+		assert.Equal(t, PartialAttribute{Type: "unicodePwd", Vals: []string{encoded}}, req.Changes[1].Modification)
+	}
+}
+
+func TestConnEncrypted(t *testing.T) {
+	assert.False(t, NewConn(newPacketTranslatorConn(), false).encrypted())
+	assert.True(t, NewConn(newPacketTranslatorConn(), true).encrypted())
+
+	for _, tt := range []struct {
+		layer     SASLSecurityLayer
+		encrypted bool
+	}{
+		{&testSASLSecurityLayerMechanism{}, false},
+		{&ntlmSession{flags: ntlmNegotiateSign}, false},
+		{&ntlmSession{flags: ntlmNegotiateSign | ntlmNegotiateSeal}, true},
+		{&gssapiSecurityLayerMechanism{&gssapiMechanism{req: &GSSAPIBindRequest{SecurityLayer: GSSAPISecurityLayerIntegrity}}}, false},
+		{&gssapiSecurityLayerMechanism{&gssapiMechanism{req: &GSSAPIBindRequest{SecurityLayer: GSSAPISecurityLayerConfidentiality}}}, true},
+	} {
+		conn := &Conn{conn: &saslConn{layer: tt.layer}}
+		assert.Equal(t, tt.encrypted, conn.encrypted(), "%T", tt.layer)
+	}
+}
+
+func TestConn_ADPassword(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	assert.ErrorIs(t, conn.SetADPassword("cn=jdoe,dc=example,dc=org", "secret"), ErrUnencryptedConnection)
+	assert.ErrorIs(t, conn.ChangeADPassword("cn=jdoe,dc=example,dc=org", "old", "secret"), ErrUnencryptedConnection)
+
+	// the connection is treated as a TLS connection
+	conn.isTLS = true
+	for _, tt := range []struct {
+		message    string
+		resultCode uint16
+		err        error
+		code       int8
+	}{
+		{"", LDAPResultSuccess, nil, -1},
+		{"0000052D: SvcErr: DSID-031A12D2, problem 5003 (WILL_NOT_PERFORM), data 0\n\x00", LDAPResultUnwillingToPerform, ErrADPasswordRestriction, -1},
+		{"0000052D: Constraint violation - check_password_restrictions: the password was already used (in history)!", LDAPResultConstraintViolation, ErrADPasswordRestriction, BeheraPasswordInHistory},
+		{"0000052D: Constraint violation - check_password_restrictions: the password does not meet the complexity criteria!", LDAPResultConstraintViolation, ErrADPasswordRestriction, BeheraInsufficientPasswordQuality},
+		{"0000052D: Constraint violation - check_password_restrictions: password is too young to change!", LDAPResultConstraintViolation, ErrADPasswordRestriction, BeheraPasswordTooYoung},
+		{"00000056: AtrErr: DSID-03190F80, #1:\n\t0: 00000056: DSID-03190F80, problem 1005 (CONSTRAINT_ATT_TYPE), data 0, Att 9005a (unicodePwd)\n\x00", LDAPResultConstraintViolation, ErrInvalidCredentials, -1},
+		{"00002098: SecErr: DSID-03150E8A, problem 4003 (INSUFF_ACCESS_RIGHTS), data 0\n\x00", LDAPResultInsufficientAccessRights, nil, -1},
+	} {
+		requests := make(chan *ber.Packet, 1)
+		go func() {
+			req, err := ptc.ReceiveRequest()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = ptc.SendResponse(encodeTestErrorResult(req.Children[0].Value.(int64), ApplicationModifyResponse, tt.resultCode, tt.message))
+			requests <- req
+		}()
+		err := conn.ChangeADPassword("cn=jdoe,dc=example,dc=org", "old", "secret")
+		switch {
+		case tt.resultCode == LDAPResultSuccess:
+			assert.NoError(t, err)
+		case tt.err == nil:
+			assert.True(t, IsErrorWithCode(err, tt.resultCode), "%s: %v", tt.message, err)
+			assert.False(t, errors.Is(err, ErrADPasswordRestriction), tt.message)
+			assert.False(t, errors.Is(err, ErrInvalidCredentials), tt.message)
+		default:
+			assert.ErrorIs(t, err, tt.err, tt.message)
+			assert.True(t, IsErrorWithCode(err, tt.resultCode), "%s: %v", tt.message, err)
+		}
+		var ppolicyErr *PasswordPolicyError
+		if tt.code < 0 {
+			assert.False(t, errors.As(err, &ppolicyErr), tt.message)
+		} else if assert.True(t, errors.As(err, &ppolicyErr), tt.message) {
+			assert.Equal(t, tt.code, ppolicyErr.Code)
+		}
+
+		req := <-requests
+		changes := req.Children[1].Children[1].Children
+		if assert.Len(t, changes, 2) {
+			assert.Equal(t, int64(DeleteAttribute), changes[0].Children[0].Value)
+			assert.Equal(t, int64(AddAttribute), changes[1].Children[0].Value)
+			assert.Equal(t, "unicodePwd", changes[1].Children[1].Children[0].Value)
+		}
+	}
+}
@@ -71,6 +71,11 @@ func (l *Conn) Add(addRequest *AddRequest) error {
 	if addRequest == nil {
 		return NewError(ErrorNetwork, errors.New("AddRequest cannot be nil"))
 	}
+	if controls, removed := l.negotiateControls("add", addRequest.DN, addRequest.Controls); len(removed) > 0 {
+		req := *addRequest
+		req.Controls = controls
+		addRequest = &req
+	}
 
 	msgCtx, err := l.doRequest(addRequest)
 	if err != nil {
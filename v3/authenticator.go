@@ -0,0 +1,164 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidCredentials is returned by Authenticator.Authenticate if the user
+// does not exist or the password is wrong
+var ErrInvalidCredentials = errors.New("ldap: invalid credentials")
+
+// Authenticator authenticates users by searching for their entry with a
+// service account and binding with the DN found and the password of the user
+// on a separate connection. The password policy controls of the server are
+// requested with the bind and reported in the AuthenticationResult.
+//
+// An Authenticator can be used concurrently, as each authentication uses new
+// connections.
+type Authenticator struct {
+	// Dial returns a new connection to the directory. It is called twice for
+	// each authentication, for the search and for the bind of the user.
+	Dial func() (Client, error)
+	// BindDN and BindPassword are the credentials of the service account used
+	// for the search. The search is performed anonymously if BindDN is empty.
+	BindDN       string
+	BindPassword string
+	// BaseDNs are searched for the entry of the user
+	BaseDNs []string
+	// Filter selects the entry of the user and has a single placeholder for
+	// the username, e.g. "(&(objectClass=person)(uid=%s))" or
+	// "(&(objectClass=user)(sAMAccountName=%s))"
+	Filter *FilterTemplate
+	// Attributes are the attributes of the entry to return, all user
+	// attributes if empty
+	Attributes []string
+}
+
+// AuthenticationResult is the result of a successful authentication
+type AuthenticationResult struct {
+	// DN is the DN of the user
+	DN string
+	// Entry is the entry of the user, as found by the search
+	Entry *Entry
+	// PasswordExpiresIn is the number of seconds before the password expires,
+	// or -1 if the server did not warn about it
+	PasswordExpiresIn int64
+	// GraceLogins is the number of remaining logins with the expired
+	// password, or -1 if the password did not expire
+	GraceLogins int64
+	// MustChangePassword is set if the password has to be changed before any
+	// other operation, e.g. after an administrative reset
+	MustChangePassword bool
+	// Controls are the controls returned with the bind of the user
+	Controls []Control
+}
+
+// NewAuthenticator returns an Authenticator dialing the given URL, see
+// DialURL, and searching the base DNs for the entry matching the filter
+func NewAuthenticator(addr, bindDN, bindPassword, filter string, baseDNs []string, opts ...DialOpt) (*Authenticator, error) {
+	template, err := NewFilterTemplate(filter)
+	if err != nil {
+		return nil, err
+	}
+	if template.args != 1 {
+		return nil, fmt.Errorf("ldap: authenticator filter %q must have a single placeholder for the username", filter)
+	}
+	return &Authenticator{
+		Dial: func() (Client, error) {
+			return DialURL(addr, opts...)
+		},
+		BindDN:       bindDN,
+		BindPassword: bindPassword,
+		BaseDNs:      baseDNs,
+		Filter:       template,
+	}, nil
+}
+
+// Authenticate verifies the password of the user. If the authentication was
+// rejected, the returned error wraps ErrInvalidCredentials or a
+// PasswordPolicyError, which matches ErrAccountLocked and ErrPasswordExpired.
+func (a *Authenticator) Authenticate(username, password string) (*AuthenticationResult, error) {
+	// an empty password would perform an unauthenticated bind, which always
+	// succeeds
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	entry, err := a.findUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := a.Dial()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	bindResult, err := conn.SimpleBind(NewSimpleBindRequest(entry.DN, password, []Control{NewControlBeheraPasswordPolicy()}))
+	if err != nil {
+		if IsErrorWithCode(err, LDAPResultInvalidCredentials) && !errors.As(err, new(*PasswordPolicyError)) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+		}
+		return nil, err
+	}
+
+	result := &AuthenticationResult{
+		DN:                entry.DN,
+		Entry:             entry,
+		PasswordExpiresIn: -1,
+		GraceLogins:       -1,
+		Controls:          bindResult.Controls,
+	}
+	if warning := bindResult.PasswordPolicyWarning(); warning != nil {
+		result.PasswordExpiresIn = warning.Expire
+		result.GraceLogins = warning.Grace
+		result.MustChangePassword = warning.MustChange
+	}
+	return result, nil
+}
+
+// findUser returns the single entry matching the filter for the username
+func (a *Authenticator) findUser(username string) (*Entry, error) {
+	filter, err := a.Filter.Execute(username)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := a.Dial()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if a.BindDN != "" {
+		if err := conn.Bind(a.BindDN, a.BindPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []*Entry
+	for _, baseDN := range a.BaseDNs {
+		result, err := conn.Search(NewSearchRequest(
+			baseDN, ScopeWholeSubtree, NeverDerefAliases, 2, 0, false,
+			filter, a.Attributes, nil,
+		))
+		switch {
+		case IsErrorWithCode(err, LDAPResultNoSuchObject):
+			continue
+		case IsErrorWithCode(err, LDAPResultSizeLimitExceeded):
+			return nil, fmt.Errorf("ldap: username %q matches multiple entries", username)
+		case err != nil:
+			return nil, err
+		}
+		entries = append(entries, result.Entries...)
+	}
+
+	switch len(entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+		return entries[0], nil
+	}
+	return nil, fmt.Errorf("ldap: username %q matches multiple entries", username)
+}
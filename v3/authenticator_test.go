@@ -0,0 +1,164 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeTestPasswordPolicy returns a Behera password policy response control
+// with the warning and error, omitting negative values
+func encodeTestPasswordPolicy(expire, grace int64, ppolicyError int8) *ber.Packet {
+	sequence := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "PasswordPolicyResponseValue")
+	if expire >= 0 || grace >= 0 {
+		warning := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "warning")
+		if expire >= 0 {
+			warning.AppendChild(ber.NewInteger(ber.ClassContext, ber.TypePrimitive, 0, expire, "timeBeforeExpiration"))
+		} else {
+			warning.AppendChild(ber.NewInteger(ber.ClassContext, ber.TypePrimitive, 1, grace, "graceAuthNsRemaining"))
+		}
+		sequence.AppendChild(warning)
+	}
+	if ppolicyError >= 0 {
+		sequence.AppendChild(ber.NewInteger(ber.ClassContext, ber.TypePrimitive, 1, int64(ppolicyError), "error"))
+	}
+
+	control := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	control.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ControlTypeBeheraPasswordPolicy, "Control Type"))
+	control.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(sequence.Bytes()), "Control Value"))
+	return control
+}
+
+// testDirectoryUser is an entry of the directory served by serveTestDirectory
+type testDirectoryUser struct {
+	uid      string
+	dn       string
+	password string
+	// resultCode and ppolicy are returned for binds with the password
+	resultCode uint16
+	ppolicy    *ber.Packet
+}
+
+// serveTestDirectory answers binds and searches for the users, which are found
+// by the search filter "(uid=<uid>)" below the base DN
+func serveTestDirectory(t *testing.T, ptc *packetTranslatorConn, users []testDirectoryUser) {
+	for {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			return
+		}
+		msgID := req.Children[0].Value.(int64)
+		op := req.Children[1]
+		switch op.Tag {
+		case ApplicationBindRequest:
+			name, password := op.Children[1].Value.(string), op.Children[2].Data.String()
+			if name == "cn=service,dc=example,dc=org" && password == "service" {
+				_ = ptc.SendResponse(encodeTestResult(msgID, ApplicationBindResponse, LDAPResultSuccess))
+				continue
+			}
+			var user *testDirectoryUser
+			for i := range users {
+				if users[i].dn == name && users[i].password == password {
+					user = &users[i]
+				}
+			}
+			if user == nil {
+				_ = ptc.SendResponse(encodeTestResult(msgID, ApplicationBindResponse, LDAPResultInvalidCredentials))
+				continue
+			}
+			response := encodeTestResult(msgID, ApplicationBindResponse, user.resultCode)
+			if user.ppolicy != nil {
+				controls := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+				controls.AppendChild(user.ppolicy)
+				response.AppendChild(controls)
+			}
+			_ = ptc.SendResponse(response)
+		case ApplicationSearchRequest:
+			filter, err := DecompileFilter(op.Children[6])
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			baseDN := op.Children[0].Value.(string)
+			for _, user := range users {
+				if filter == "(uid="+user.uid+")" && strings.HasSuffix(user.dn, ","+baseDN) {
+					_ = ptc.SendResponse(encodeTestSearchEntry(msgID, user.dn, map[string][]string{"uid": {user.uid}}))
+				}
+			}
+			_ = ptc.SendResponse(encodeTestResult(msgID, ApplicationSearchResultDone, LDAPResultSuccess))
+		case ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	users := []testDirectoryUser{
+		{uid: "jdoe", dn: "uid=jdoe,ou=people,dc=example,dc=org", password: "secret",
+			ppolicy: encodeTestPasswordPolicy(3600, -1, -1)},
+		{uid: "reset", dn: "uid=reset,ou=people,dc=example,dc=org", password: "secret",
+			ppolicy: encodeTestPasswordPolicy(-1, 2, BeheraChangeAfterReset)},
+		{uid: "locked", dn: "uid=locked,ou=people,dc=example,dc=org", password: "secret",
+			resultCode: LDAPResultInvalidCredentials, ppolicy: encodeTestPasswordPolicy(-1, -1, BeheraAccountLocked)},
+		{uid: "expired", dn: "uid=expired,ou=people,dc=example,dc=org", password: "secret",
+			resultCode: LDAPResultInvalidCredentials, ppolicy: encodeTestPasswordPolicy(-1, -1, BeheraPasswordExpired)},
+		// the search must not match several entries, e.g. in different base DNs
+		{uid: "twin", dn: "uid=twin,ou=people,dc=example,dc=org", password: "secret"},
+		{uid: "twin", dn: "uid=twin,ou=other,dc=example,dc=org", password: "secret"},
+	}
+
+	authenticator, err := NewAuthenticator("ldap://ldap.example.org", "cn=service,dc=example,dc=org", "service",
+		"(uid=%s)", []string{"ou=people,dc=example,dc=org", "ou=other,dc=example,dc=org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator.Dial = func() (Client, error) {
+		ptc := newPacketTranslatorConn()
+		go serveTestDirectory(t, ptc, users)
+		conn := NewConn(ptc, false)
+		conn.Start()
+		return conn, nil
+	}
+
+	result, err := authenticator.Authenticate("jdoe", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "uid=jdoe,ou=people,dc=example,dc=org", result.DN)
+	assert.Equal(t, []string{"jdoe"}, result.Entry.GetAttributeValues("uid"))
+	assert.Equal(t, int64(3600), result.PasswordExpiresIn)
+	assert.Equal(t, int64(-1), result.GraceLogins)
+	assert.False(t, result.MustChangePassword)
+
+	result, err = authenticator.Authenticate("reset", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(-1), result.PasswordExpiresIn)
+	assert.Equal(t, int64(2), result.GraceLogins)
+	assert.True(t, result.MustChangePassword)
+
+	for _, tt := range []struct {
+		username, password string
+		err                error
+	}{
+		{"jdoe", "wrong", ErrInvalidCredentials},
+		{"jdoe", "", ErrInvalidCredentials},
+		{"unknown", "secret", ErrInvalidCredentials},
+		{"locked", "secret", ErrAccountLocked},
+		{"expired", "secret", ErrPasswordExpired},
+	} {
+		_, err := authenticator.Authenticate(tt.username, tt.password)
+		assert.ErrorIs(t, err, tt.err, tt.username)
+	}
+
+	_, err = authenticator.Authenticate("twin", "secret")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrInvalidCredentials))
+
+	_, err = NewAuthenticator("ldap://ldap.example.org", "", "", "(uid=*)", nil)
+	assert.Error(t, err)
+}
@@ -2,20 +2,21 @@ package ldap
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
-	"encoding/binary"
 	"encoding/hex"
 	enchex "encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"strings"
-	"unicode/utf16"
 
 	"github.com/Azure/go-ntlmssp"
 	ber "github.com/go-asn1-ber/asn1-ber"
 	"golang.org/x/crypto/md4" //nolint:staticcheck
+
+	"github.com/go-ldap/ldap/v3/internal/utf16le"
 )
 
 // SimpleBindRequest represents a username/password bind operation
@@ -36,6 +37,18 @@ type SimpleBindResult struct {
 	Controls []Control
 }
 
+// AuthzID returns the authorization identity of the ControlAuthzIDResponse
+// returned by the server, if the bind was sent with a ControlAuthzIDRequest
+func (r *SimpleBindResult) AuthzID() (string, bool) {
+	return authzIDFromControls(r.Controls)
+}
+
+// PasswordPolicyWarning returns the warning of the password policy response
+// controls, or nil if there is none
+func (r *SimpleBindResult) PasswordPolicyWarning() *PasswordPolicyWarning {
+	return passwordPolicyWarning(r.Controls)
+}
+
 // NewSimpleBindRequest returns a bind request
 func NewSimpleBindRequest(username string, password string, controls []Control) *SimpleBindRequest {
 	return &SimpleBindRequest{
@@ -60,7 +73,8 @@ func (req *SimpleBindRequest) appendTo(envelope *ber.Packet) error {
 	return nil
 }
 
-// SimpleBind performs the simple bind operation defined in the given request
+// SimpleBind performs the simple bind operation defined in the given request.
+// A bind rejected by the password policy returns a PasswordPolicyError.
 func (l *Conn) SimpleBind(simpleBindRequest *SimpleBindRequest) (*SimpleBindResult, error) {
 	if simpleBindRequest.Password == "" && !simpleBindRequest.AllowEmptyPassword {
 		return nil, NewError(ErrorEmptyPassword, errors.New("ldap: empty password not allowed by the client"))
@@ -91,11 +105,13 @@ func (l *Conn) SimpleBind(simpleBindRequest *SimpleBindRequest) (*SimpleBindResu
 		}
 	}
 
-	err = GetLDAPError(packet)
+	err = passwordPolicyError(GetLDAPError(packet), result.Controls)
 	return result, err
 }
 
-// Bind performs a bind with the given username and password.
+// Bind performs a bind with the given username and password, requesting the
+// password policy response control. A bind rejected by the password policy
+// returns a PasswordPolicyError.
 //
 // It does not allow unauthenticated bind (i.e. empty password). Use the UnauthenticatedBind method
 // for that.
@@ -103,6 +119,7 @@ func (l *Conn) Bind(username, password string) error {
 	req := &SimpleBindRequest{
 		Username:           username,
 		Password:           password,
+		Controls:           []Control{NewControlBeheraPasswordPolicy()},
 		AllowEmptyPassword: false,
 	}
 	_, err := l.SimpleBind(req)
@@ -157,6 +174,12 @@ type DigestMD5BindResult struct {
 	Controls []Control
 }
 
+// AuthzID returns the authorization identity of the ControlAuthzIDResponse
+// returned by the server, if the bind was sent with a ControlAuthzIDRequest
+func (r *DigestMD5BindResult) AuthzID() (string, bool) {
+	return authzIDFromControls(r.Controls)
+}
+
 // MD5Bind performs a digest-md5 bind with the given host, username and password.
 func (l *Conn) MD5Bind(host, username, password string) error {
 	req := &DigestMD5BindRequest{
@@ -242,6 +265,9 @@ func (l *Conn) DigestMD5Bind(digestMD5BindRequest *DigestMD5BindRequest) (*Diges
 		auth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, resp, "Credentials"))
 		request.AppendChild(auth)
 		packet.AppendChild(request)
+		if len(digestMD5BindRequest.Controls) > 0 {
+			packet.AppendChild(encodeControls(digestMD5BindRequest.Controls))
+		}
 		msgCtx, err = l.sendMessage(packet)
 		if err != nil {
 			return nil, fmt.Errorf("send message: %s", err)
@@ -286,6 +312,16 @@ func (l *Conn) DigestMD5Bind(digestMD5BindRequest *DigestMD5BindRequest) (*Diges
 		}
 	}
 
+	if len(packet.Children) == 3 {
+		for _, child := range packet.Children[2].Children {
+			decodedChild, decodeErr := DecodeControl(child)
+			if decodeErr != nil {
+				return nil, fmt.Errorf("failed to decode child control: %s", decodeErr)
+			}
+			result.Controls = append(result.Controls, decodedChild)
+		}
+	}
+
 	err = GetLDAPError(packet)
 	return result, err
 }
@@ -430,40 +466,59 @@ func randomBytes(length int) ([]byte, error) {
 	return b, nil
 }
 
-var externalBindRequest = requestFunc(func(envelope *ber.Packet) error {
-	pkt := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationBindRequest, nil, "Bind Request")
-	pkt.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
-	pkt.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "User Name"))
-
-	saslAuth := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, "", "authentication")
-	saslAuth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "EXTERNAL", "SASL Mech"))
-	saslAuth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "SASL Cred"))
-
-	pkt.AppendChild(saslAuth)
-
-	envelope.AppendChild(pkt)
-
-	return nil
-})
-
 // ExternalBind performs SASL/EXTERNAL authentication.
 //
-// Use ldap.DialURL("ldapi://") to connect to the Unix socket before ExternalBind.
+// Use ldap.DialURL("ldapi://") to connect to the Unix socket before ExternalBind,
+// or authenticate with a TLS client certificate over ldaps:// or StartTLS,
+// see DialWithClientCertificate and ClientCertificateReloader.
 //
 // See https://tools.ietf.org/html/rfc4422#appendix-A
 func (l *Conn) ExternalBind() error {
-	msgCtx, err := l.doRequest(externalBindRequest)
-	if err != nil {
-		return err
-	}
-	defer l.finishMessage(msgCtx)
+	return l.ExternalBindWithAuthzID("")
+}
 
-	packet, err := l.readPacket(msgCtx)
-	if err != nil {
-		return err
-	}
+// ExternalBindWithAuthzID performs SASL/EXTERNAL authentication, requesting
+// to act as the given authorization identity, e.g. "dn:cn=admin,dc=example,dc=org"
+// or "u:admin". An empty authzid requests the identity derived from the
+// credentials of the connection, i.e. the Unix user or the TLS client
+// certificate. Use WhoAmI to confirm the identity the server assigned.
+//
+// See https://tools.ietf.org/html/rfc4422#appendix-A
+func (l *Conn) ExternalBindWithAuthzID(authzid string) error {
+	_, err := l.ExternalBindWithResult(context.Background(), &ExternalBindRequest{AuthZID: authzid})
+	return err
+}
+
+// ExternalBindRequest represents a SASL EXTERNAL bind request
+type ExternalBindRequest struct {
+	// (Optional) AuthZID is the authorization identity to act as
+	AuthZID string
+	// (Optional) Controls to send with the bind request
+	Controls []Control
+}
+
+// ExternalBindWithResult performs the SASL EXTERNAL bind defined in the given
+// request
+func (l *Conn) ExternalBindWithResult(ctx context.Context, req *ExternalBindRequest) (*SASLBindResult, error) {
+	return l.SASLBind(ctx, externalMechanism{authzID: req.AuthZID}, req.Controls)
+}
+
+// externalMechanism is the SASL EXTERNAL mechanism with an optional
+// authorization identity
+type externalMechanism struct {
+	authzID string
+}
+
+func (externalMechanism) Name() string {
+	return "EXTERNAL"
+}
+
+func (m externalMechanism) Start() ([]byte, error) {
+	return []byte(m.authzID), nil
+}
 
-	return GetLDAPError(packet)
+func (externalMechanism) Next(challenge []byte) ([]byte, error) {
+	return nil, errors.New("ldap: unexpected challenge for SASL EXTERNAL")
 }
 
 // NTLMBind performs an NTLMSSP bind leveraging https://github.com/Azure/go-ntlmssp
@@ -485,6 +540,12 @@ type NTLMBindRequest struct {
 	Controls []Control
 	// Negotiator allows to specify a custom NTLM negotiator.
 	Negotiator NTLMNegotiator
+	// (Optional) SecurityLayer protecting the connection after the bind with
+	// NTLM session security, as required by domain controllers enforcing LDAP
+	// signing: GSSAPISecurityLayerIntegrity signs all messages,
+	// GSSAPISecurityLayerConfidentiality additionally seals them.
+	// Not supported with a custom Negotiator.
+	SecurityLayer byte
 }
 
 // NTLMNegotiator is an abstraction of an NTLM implementation that produces and
@@ -494,33 +555,23 @@ type NTLMNegotiator interface {
 	ChallengeResponse(challenge []byte, username string, hash string) ([]byte, error)
 }
 
-func (req *NTLMBindRequest) appendTo(envelope *ber.Packet) (err error) {
+// ntlmBindMessage is a bind request carrying an NTLM message, either the
+// sicilyNegotiate or the sicilyResponse authentication choice of MS-ADTS
+// section 5.1.1.1.3
+type ntlmBindMessage struct {
+	tag      ber.Tag
+	message  []byte
+	controls []Control
+}
+
+func (req *ntlmBindMessage) appendTo(envelope *ber.Packet) error {
 	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationBindRequest, nil, "Bind Request")
 	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
 	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "User Name"))
-
-	var negMessage []byte
-
-	// generate an NTLMSSP Negotiation message for the  specified domain (it can be blank)
-	switch {
-	case req.Negotiator == nil:
-		negMessage, err = ntlmssp.NewNegotiateMessage(req.Domain, "")
-		if err != nil {
-			return fmt.Errorf("create NTLM negotiate message: %s", err)
-		}
-	default:
-		negMessage, err = req.Negotiator.Negotiate(req.Domain, "")
-		if err != nil {
-			return fmt.Errorf("create NTLM negotiate message with custom negotiator: %s", err)
-		}
-	}
-
-	// append the generated NTLMSSP message as a TagEnumerated BER value
-	auth := ber.Encode(ber.ClassContext, ber.TypePrimitive, ber.TagEnumerated, negMessage, "authentication")
-	request.AppendChild(auth)
+	request.AppendChild(ber.Encode(ber.ClassContext, ber.TypePrimitive, req.tag, req.message, "authentication"))
 	envelope.AppendChild(request)
-	if len(req.Controls) > 0 {
-		envelope.AppendChild(encodeControls(req.Controls))
+	if len(req.controls) > 0 {
+		envelope.AppendChild(encodeControls(req.controls))
 	}
 	return nil
 }
@@ -530,6 +581,12 @@ type NTLMBindResult struct {
 	Controls []Control
 }
 
+// AuthzID returns the authorization identity of the ControlAuthzIDResponse
+// returned by the server, if the bind was sent with a ControlAuthzIDRequest
+func (r *NTLMBindResult) AuthzID() (string, bool) {
+	return authzIDFromControls(r.Controls)
+}
+
 // NTLMBind performs an NTLMSSP Bind with the given domain, username and password
 func (l *Conn) NTLMBind(domain, username, password string) error {
 	req := &NTLMBindRequest{
@@ -568,22 +625,79 @@ func (l *Conn) NTLMBindWithHash(domain, username, hash string) error {
 	return err
 }
 
-// NTLMChallengeBind performs the NTLMSSP bind operation defined in the given request
+// NTLMChallengeBind performs the NTLMSSP bind operation defined in the given request.
+//
+// Over TLS, the authentication is bound to the connection with the
+// tls-server-end-point channel binding for Extended Protection for
+// Authentication. Security layers are not supported over TLS, as Active
+// Directory refuses to sign or seal messages of TLS connections. If a security
+// layer was requested, it is installed on the connection after the bind
+// succeeded, so there must be no outstanding requests during the bind.
+//
+// The bind uses go-ntlmssp unless a channel binding or a security layer is
+// needed. Both implementations only take the domain of the user from a
+// username of the form DOMAIN\user.
 func (l *Conn) NTLMChallengeBind(ntlmBindRequest *NTLMBindRequest) (*NTLMBindResult, error) {
+	if l == nil || l.conn == nil {
+		return nil, ErrNilConnection
+	}
 	if !ntlmBindRequest.AllowEmptyPassword && ntlmBindRequest.Password == "" && ntlmBindRequest.Hash == "" {
 		return nil, NewError(ErrorEmptyPassword, errors.New("ldap: empty password not allowed by the client"))
 	}
+	state, isTLS := l.TLSConnectionState()
+	switch ntlmBindRequest.SecurityLayer {
+	case 0, GSSAPISecurityLayerNone:
+	case GSSAPISecurityLayerIntegrity, GSSAPISecurityLayerConfidentiality:
+		if ntlmBindRequest.Negotiator != nil {
+			return nil, errors.New("ldap: NTLM security layers are not supported with a custom negotiator")
+		}
+		if isTLS || l.isTLS {
+			return nil, errors.New("ldap: NTLM security layers are not supported over TLS")
+		}
+	default:
+		return nil, fmt.Errorf("ldap: invalid NTLM security layer %#x", ntlmBindRequest.SecurityLayer)
+	}
 
-	msgCtx, err := l.doRequest(ntlmBindRequest)
-	if err != nil {
-		return nil, err
+	var session *ntlmSession
+	var securityLayer SASLSecurityLayer
+	var negMessage []byte
+	var err error
+	switch {
+	case ntlmBindRequest.Negotiator != nil:
+		negMessage, err = ntlmBindRequest.Negotiator.Negotiate(ntlmBindRequest.Domain, "")
+		if err != nil {
+			return nil, fmt.Errorf("create NTLM negotiate message with custom negotiator: %s", err)
+		}
+	case isTLS || ntlmBindRequest.SecurityLayer > GSSAPISecurityLayerNone:
+		session, err = newNTLMSession(ntlmBindRequest.Username, ntlmBindRequest.Password, ntlmBindRequest.Hash, ntlmBindRequest.SecurityLayer)
+		if err != nil {
+			return nil, err
+		}
+		if isTLS {
+			if err := session.setChannelBinding(state); err != nil {
+				return nil, err
+			}
+		} else {
+			securityLayer = session
+		}
+		negMessage = session.negotiate()
+	default:
+		// generate an NTLMSSP Negotiation message for the specified domain (it can be blank)
+		negMessage, err = ntlmssp.NewNegotiateMessage(ntlmBindRequest.Domain, "")
+		if err != nil {
+			return nil, fmt.Errorf("create NTLM negotiate message: %s", err)
+		}
 	}
-	defer l.finishMessage(msgCtx)
-	packet, err := l.readPacket(msgCtx)
+
+	// the NTLMSSP negotiate message is sent as sicilyNegotiate
+	packet, err := l.bindStep(&ntlmBindMessage{
+		tag:      ber.TagEnumerated,
+		message:  negMessage,
+		controls: ntlmBindRequest.Controls,
+	}, nil)
 	if err != nil {
 		return nil, err
 	}
-	l.Debug.Printf("%d: got response %p", msgCtx.id, packet)
 	if l.Debug {
 		if err = addLDAPDescriptions(packet); err != nil {
 			return nil, err
@@ -604,7 +718,7 @@ func (l *Conn) NTLMChallengeBind(ntlmBindRequest *NTLMBindRequest) (*NTLMBindRes
 			if len(ntlmsspChallenge) < 7 || !bytes.Equal(ntlmsspChallenge[:7], []byte("NTLMSSP")) {
 				return result, GetLDAPError(packet)
 			}
-			l.Debug.Printf("%d: found ntlmssp challenge", msgCtx.id)
+			l.Debug.Printf("%d: found ntlmssp challenge", packet.Children[0].Value)
 		}
 	}
 	if ntlmsspChallenge != nil {
@@ -612,11 +726,11 @@ func (l *Conn) NTLMChallengeBind(ntlmBindRequest *NTLMBindRequest) (*NTLMBindRes
 		var responseMessage []byte
 
 		switch {
-		case ntlmBindRequest.Hash == "" && ntlmBindRequest.Password == "" && !ntlmBindRequest.AllowEmptyPassword:
-			err = fmt.Errorf("need a password or hash to generate reply")
+		case session != nil:
+			responseMessage, err = session.authenticate(ntlmsspChallenge)
 		case ntlmBindRequest.Negotiator == nil && ntlmBindRequest.Hash != "":
 			responseMessage, err = ntlmssp.ProcessChallengeWithHash(ntlmsspChallenge, ntlmBindRequest.Username, ntlmBindRequest.Hash)
-		case ntlmBindRequest.Negotiator == nil && (ntlmBindRequest.Password != "" || ntlmBindRequest.AllowEmptyPassword):
+		case ntlmBindRequest.Negotiator == nil:
 			// generate a response message to the challenge with the given Username/Password if password is provided
 			_, _, domainNeeded := ntlmssp.GetDomain(ntlmBindRequest.Username)
 			responseMessage, err = ntlmssp.ProcessChallenge(ntlmsspChallenge, ntlmBindRequest.Username, ntlmBindRequest.Password, domainNeeded)
@@ -633,33 +747,25 @@ func (l *Conn) NTLMChallengeBind(ntlmBindRequest *NTLMBindRequest) (*NTLMBindRes
 			return result, fmt.Errorf("process NTLM challenge: %s", err)
 		}
 
-		packet = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
-		packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, l.nextMessageID(), "MessageID"))
-
-		request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationBindRequest, nil, "Bind Request")
-		request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
-		request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "User Name"))
-
-		// append the challenge response message as a TagEmbeddedPDV BER value
-		auth := ber.Encode(ber.ClassContext, ber.TypePrimitive, ber.TagEmbeddedPDV, responseMessage, "authentication")
-
-		request.AppendChild(auth)
-		packet.AppendChild(request)
-		msgCtx, err = l.sendMessage(packet)
+		// the challenge response message is sent as sicilyResponse
+		packet, err = l.bindStep(&ntlmBindMessage{
+			tag:      ber.TagEmbeddedPDV,
+			message:  responseMessage,
+			controls: ntlmBindRequest.Controls,
+		}, securityLayer)
 		if err != nil {
-			return nil, fmt.Errorf("send message: %s", err)
-		}
-		defer l.finishMessage(msgCtx)
-		packetResponse, ok := <-msgCtx.responses
-		if !ok {
-			return nil, NewError(ErrorNetwork, errors.New("ldap: response channel closed"))
-		}
-		packet, err = packetResponse.ReadPacket()
-		l.Debug.Printf("%d: got response %p", msgCtx.id, packet)
-		if err != nil {
-			return nil, fmt.Errorf("read packet: %s", err)
+			return nil, err
 		}
+	}
 
+	if len(packet.Children) == 3 {
+		for _, child := range packet.Children[2].Children {
+			decodedChild, decodeErr := DecodeControl(child)
+			if decodeErr != nil {
+				return nil, fmt.Errorf("failed to decode child control: %s", decodeErr)
+			}
+			result.Controls = append(result.Controls, decodedChild)
+		}
 	}
 
 	err = GetLDAPError(packet)
@@ -667,13 +773,8 @@ func (l *Conn) NTLMChallengeBind(ntlmBindRequest *NTLMBindRequest) (*NTLMBindRes
 }
 
 func ntHash(pass string) string {
-	runes := utf16.Encode([]rune(pass))
-
-	b := bytes.Buffer{}
-	_ = binary.Write(&b, binary.LittleEndian, &runes)
-
 	hash := md4.New()
-	_, _ = hash.Write(b.Bytes())
+	_, _ = hash.Write(utf16le.Encode(pass))
 
 	return hex.EncodeToString(hash.Sum(nil))
 }
@@ -715,148 +816,185 @@ type GSSAPIClient interface {
 	DeleteSecContext() error
 }
 
+// GSSAPISecurityLayerClient is implemented by a GSSAPIClient which can
+// negotiate the integrity and confidentiality protection of the connection.
+// See RFC 4752 section 3.3.
+type GSSAPISecurityLayerClient interface {
+	GSSAPIClient
+	// NegotiateSaslAuthWithSecurityLayer performs the last step of the Sasl
+	// handshake like NegotiateSaslAuth, selecting the given security layer
+	// and the maximum size of the buffers the client accepts. It returns the
+	// maximum number of bytes which may be passed to Wrap at once.
+	NegotiateSaslAuthWithSecurityLayer(token []byte, authzid string, securityLayer byte, maxReceiveSize uint32) (output []byte, maxWrapSize int, err error)
+	// Wrap protects data sent to the server, encrypting it if confidential
+	// is true.
+	Wrap(data []byte, confidential bool) ([]byte, error)
+	// Unwrap verifies data received from the server and returns its payload.
+	Unwrap(token []byte) ([]byte, error)
+}
+
+// GSSAPI SASL security layers, see RFC 4752 section 3.3.
+const (
+	GSSAPISecurityLayerNone            = 0x01
+	GSSAPISecurityLayerIntegrity       = 0x02
+	GSSAPISecurityLayerConfidentiality = 0x04
+)
+
 // GSSAPIBindRequest represents a GSSAPI SASL mechanism bind request.
 // See rfc4752 and rfc4513 section 5.2.1.2.
 type GSSAPIBindRequest struct {
+	// Client used for the bind, e.g. a gssapi.Client. The client argument of
+	// GSSAPIBind, GSSAPIBindRequest and GSSAPIBindRequestWithAPOptions
+	// replaces it.
+	Client GSSAPIClient
 	// Service Principal Name user for the service ticket. Eg. "ldap/<host>"
 	ServicePrincipalName string
 	// (Optional) Authorization entity
 	AuthZID string
+	// (Optional) SecurityLayer protecting the connection after the bind,
+	// GSSAPISecurityLayerIntegrity or GSSAPISecurityLayerConfidentiality.
+	// Requires a client implementing GSSAPISecurityLayerClient, which is then
+	// used by the connection until it is closed.
+	SecurityLayer byte
+	// (Optional) APOptions are the Kerberos AP options of the service ticket.
+	// The argument of GSSAPIBindRequestWithAPOptions replaces it.
+	APOptions []int
 	// (Optional) Controls to send with the bind request
 	Controls []Control
 }
 
 // GSSAPIBind performs the GSSAPI SASL bind using the provided GSSAPI client.
 func (l *Conn) GSSAPIBind(client GSSAPIClient, servicePrincipal, authzid string) error {
-	return l.GSSAPIBindRequest(client, &GSSAPIBindRequest{
+	_, err := l.GSSAPIBindWithResult(context.Background(), &GSSAPIBindRequest{
+		Client:               client,
 		ServicePrincipalName: servicePrincipal,
 		AuthZID:              authzid,
 	})
+	return err
 }
 
-// GSSAPIBindRequest performs the GSSAPI SASL bind using the provided GSSAPI client.
+// GSSAPIBindRequest performs the GSSAPI SASL bind using the provided GSSAPI
+// client, which replaces the Client of the request.
+//
+// Deprecated: set the Client of the request and use GSSAPIBindWithResult.
 func (l *Conn) GSSAPIBindRequest(client GSSAPIClient, req *GSSAPIBindRequest) error {
-	return l.GSSAPIBindRequestWithAPOptions(client, req, []int{})
+	withClient := *req
+	withClient.Client = client
+	_, err := l.GSSAPIBindWithResult(context.Background(), &withClient)
+	return err
 }
 
-// GSSAPIBindRequest performs the GSSAPI SASL bind using the provided GSSAPI client.
+// GSSAPIBindRequestWithAPOptions performs the GSSAPI SASL bind using the
+// provided GSSAPI client and AP options, which replace the Client and
+// APOptions of the request.
+//
+// Deprecated: set the Client and APOptions of the request and use
+// GSSAPIBindWithResult.
 func (l *Conn) GSSAPIBindRequestWithAPOptions(client GSSAPIClient, req *GSSAPIBindRequest, APOptions []int) error {
-	//nolint:errcheck
-	defer client.DeleteSecContext()
+	withClient := *req
+	withClient.Client = client
+	withClient.APOptions = APOptions
+	_, err := l.GSSAPIBindWithResult(context.Background(), &withClient)
+	return err
+}
 
-	var err error
-	var reqToken []byte
-	var recvToken []byte
-	needInit := true
-	for {
-		if needInit {
-			// Establish secure context between client and server.
-			reqToken, needInit, err = client.InitSecContextWithOptions(req.ServicePrincipalName, recvToken, APOptions)
-			if err != nil {
-				return err
-			}
-		} else {
-			// Secure context is set up, perform the last step of SASL handshake.
-			reqToken, err = client.NegotiateSaslAuth(recvToken, req.AuthZID)
-			if err != nil {
-				return err
-			}
-		}
-		// Send Bind request containing the current token and extract the
-		// token sent by server.
-		recvToken, err = l.saslBindTokenExchange(req.Controls, reqToken)
-		if err != nil {
-			return err
+// GSSAPIBindWithResult performs the GSSAPI SASL bind defined in the given
+// request using its Client and returns the response of the server.
+func (l *Conn) GSSAPIBindWithResult(ctx context.Context, req *GSSAPIBindRequest) (*SASLBindResult, error) {
+	client := req.Client
+	if client == nil {
+		return nil, errors.New("ldap: GSSAPI bind requires a client")
+	}
+	mechanism := &gssapiMechanism{
+		client:  client,
+		req:     req,
+		options: req.APOptions,
+	}
+	var saslMechanism SASLMechanism = mechanism
+	switch req.SecurityLayer {
+	case 0, GSSAPISecurityLayerNone:
+	case GSSAPISecurityLayerIntegrity, GSSAPISecurityLayerConfidentiality:
+		layerClient, ok := client.(GSSAPISecurityLayerClient)
+		if !ok {
+			return nil, errors.New("ldap: GSSAPI client does not support security layers")
 		}
+		mechanism.layerClient = layerClient
+		saslMechanism = &gssapiSecurityLayerMechanism{mechanism}
+	default:
+		return nil, fmt.Errorf("ldap: invalid GSSAPI security layer %#x", req.SecurityLayer)
+	}
 
-		if !needInit && len(recvToken) == 0 {
-			break
-		}
+	result, err := l.SASLBind(ctx, saslMechanism, req.Controls)
+	if err != nil || mechanism.maxWrapSize == 0 {
+		// the security context is still in use by the security layer otherwise
+		//nolint:errcheck
+		client.DeleteSecContext()
 	}
+	return result, err
+}
 
-	return nil
+// gssapiMechanism adapts a GSSAPIClient to the SASLMechanism interface
+type gssapiMechanism struct {
+	client      GSSAPIClient
+	layerClient GSSAPISecurityLayerClient
+	req         *GSSAPIBindRequest
+	options     []int
+	needInit    bool
+	done        bool
+	maxWrapSize int
 }
 
-func (l *Conn) saslBindTokenExchange(reqControls []Control, reqToken []byte) ([]byte, error) {
-	// Construct LDAP Bind request with GSSAPI SASL mechanism.
-	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
-	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, l.nextMessageID(), "MessageID"))
+func (m *gssapiMechanism) Name() string {
+	return "GSSAPI"
+}
 
-	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationBindRequest, nil, "Bind Request")
-	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
-	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "User Name"))
+func (m *gssapiMechanism) Start() ([]byte, error) {
+	m.needInit = true
+	return m.Next(nil)
+}
 
-	auth := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, "", "authentication")
-	auth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "GSSAPI", "SASL Mech"))
-	if len(reqToken) > 0 {
-		auth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(reqToken), "Credentials"))
-	}
-	request.AppendChild(auth)
-	envelope.AppendChild(request)
-	if len(reqControls) > 0 {
-		envelope.AppendChild(encodeControls(reqControls))
+func (m *gssapiMechanism) Next(challenge []byte) ([]byte, error) {
+	var token []byte
+	var err error
+	switch {
+	case m.done:
+		return nil, nil
+	case m.needInit:
+		// Establish secure context between client and server.
+		token, m.needInit, err = m.client.InitSecContextWithOptions(m.req.ServicePrincipalName, challenge, m.options)
+	case m.layerClient != nil:
+		// Secure context is set up, negotiate the security layer.
+		token, m.maxWrapSize, err = m.layerClient.NegotiateSaslAuthWithSecurityLayer(challenge, m.req.AuthZID, m.req.SecurityLayer, saslMaxBufferSize)
+		m.done = true
+	default:
+		// Secure context is set up, perform the last step of SASL handshake.
+		token, err = m.client.NegotiateSaslAuth(challenge, m.req.AuthZID)
+		m.done = true
 	}
-
-	msgCtx, err := l.sendMessage(envelope)
-	if err != nil {
+	if err != nil || len(token) == 0 {
 		return nil, err
 	}
-	defer l.finishMessage(msgCtx)
+	return token, nil
+}
 
-	packet, err := l.readPacket(msgCtx)
-	if err != nil {
-		return nil, err
-	}
-	l.Debug.Printf("%d: got response %p", msgCtx.id, packet)
-	if l.Debug {
-		if err = addLDAPDescriptions(packet); err != nil {
-			return nil, err
-		}
-		ber.PrintPacket(packet)
-	}
+// gssapiSecurityLayerMechanism is a gssapiMechanism negotiating a security
+// layer
+type gssapiSecurityLayerMechanism struct {
+	*gssapiMechanism
+}
 
-	// https://www.rfc-editor.org/rfc/rfc4511#section-4.1.1
-	// packet is an envelope
-	// child 0 is message id
-	// child 1 is protocolOp
-	if len(packet.Children) != 2 {
-		return nil, fmt.Errorf("bad bind response")
-	}
-
-	protocolOp := packet.Children[1]
-RESP:
-	switch protocolOp.Description {
-	case "Bind Response": // Bind Response
-		// Bind Reponse is an LDAP Response (https://www.rfc-editor.org/rfc/rfc4511#section-4.1.9)
-		// with an additional optional serverSaslCreds string (https://www.rfc-editor.org/rfc/rfc4511#section-4.2.2)
-		// child 0 is resultCode
-		resultCode := protocolOp.Children[0]
-		if resultCode.Tag != ber.TagEnumerated {
-			break RESP
-		}
-		switch resultCode.Value.(int64) {
-		case 14: // Sasl bind in progress
-			if len(protocolOp.Children) < 3 {
-				break RESP
-			}
-			referral := protocolOp.Children[3]
-			switch referral.Description {
-			case "Referral":
-				if referral.ClassType != ber.ClassContext || referral.Tag != ber.TagObjectDescriptor {
-					break RESP
-				}
-				return ioutil.ReadAll(referral.Data)
-			}
-			// Optional:
-			//if len(protocolOp.Children) == 4 {
-			//	serverSaslCreds := protocolOp.Children[4]
-			//}
-		case 0: // Success - Bind OK.
-			// SASL layer in effect (if any) (See https://www.rfc-editor.org/rfc/rfc4513#section-5.2.1.4)
-			// NOTE: SASL security layers are not supported currently.
-			return nil, nil
-		}
-	}
+func (m *gssapiSecurityLayerMechanism) SecurityLayer() (bool, int) {
+	return m.maxWrapSize > 0, m.maxWrapSize
+}
+
+func (m *gssapiSecurityLayerMechanism) Wrap(data []byte) ([]byte, error) {
+	return m.layerClient.Wrap(data, m.req.SecurityLayer == GSSAPISecurityLayerConfidentiality)
+}
+
+func (m *gssapiSecurityLayerMechanism) Unwrap(data []byte) ([]byte, error) {
+	return m.layerClient.Unwrap(data)
+}
 
-	return nil, GetLDAPError(packet)
+func (m *gssapiSecurityLayerMechanism) confidential() bool {
+	return m.req.SecurityLayer == GSSAPISecurityLayerConfidentiality
 }
@@ -1,6 +1,7 @@
 package ldap
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -117,3 +118,82 @@ func TestConn_UnauthenticatedBind(t *testing.T) {
 	assert.Error(t, err)
 	assert.Truef(t, IsErrorWithCode(err, LDAPResultUnwillingToPerform), "Expected LDAPResultUnwillingToPerform, got %v", err)
 }
+
+// serveTestAuthzIDBind answers a bind request carrying a ControlAuthzIDRequest
+// with the authorization identity
+func serveTestAuthzIDBind(t *testing.T, ptc *packetTranslatorConn, authzID string) {
+	req, err := ptc.ReceiveRequest()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if assert.Len(t, req.Children, 3) {
+		control, err := DecodeControl(req.Children[2].Children[0])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, NewControlAuthzIDRequest(false), control)
+	}
+	response := encodeTestResult(req.Children[0].Value.(int64), ApplicationBindResponse, LDAPResultSuccess)
+	response.AppendChild(encodeControls([]Control{NewControlAuthzIDResponse(authzID)}))
+	_ = ptc.SendResponse(response)
+}
+
+func TestConn_BindAuthzID(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	go serveTestAuthzIDBind(t, ptc, "dn:cn=admin,dc=example,dc=org")
+	simpleResult, err := conn.SimpleBind(NewSimpleBindRequest("cn=admin,dc=example,dc=org", "secret",
+		[]Control{NewControlAuthzIDRequest(false)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authzID, ok := simpleResult.AuthzID()
+	assert.True(t, ok)
+	assert.Equal(t, "dn:cn=admin,dc=example,dc=org", authzID)
+
+	go serveTestAuthzIDBind(t, ptc, "")
+	saslResult, err := conn.ExternalBindWithResult(context.Background(), &ExternalBindRequest{
+		Controls: []Control{NewControlAuthzIDRequest(false)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authzID, ok = saslResult.AuthzID()
+	assert.True(t, ok)
+	assert.Equal(t, "", authzID)
+
+	// the controls are sent with both NTLM messages
+	go func() {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Len(t, req.Children, 3)
+		flags := uint32(ntlmNegotiateUnicode | ntlmNegotiateNTLM | ntlmNegotiateExtendedSessionSecurity | ntlmNegotiateTargetInfo)
+		challenge := testNTLMChallengeWithTargetInfo(flags, appendNTLMAvPair(nil, ntlmAvEOL, nil))
+		_ = ptc.SendResponse(encodeTestNTLMChallenge(req.Children[0].Value.(int64), challenge))
+		serveTestAuthzIDBind(t, ptc, `u:EXAMPLE\user`)
+	}()
+	ntlmResult, err := conn.NTLMChallengeBind(&NTLMBindRequest{
+		Username: `EXAMPLE\user`,
+		Password: "password",
+		Controls: []Control{NewControlAuthzIDRequest(false)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authzID, ok = ntlmResult.AuthzID()
+	assert.True(t, ok)
+	assert.Equal(t, `u:EXAMPLE\user`, authzID)
+
+	_, ok = (&SASLBindResult{Controls: []Control{NewControlManageDsaIT(false)}}).AuthzID()
+	assert.False(t, ok)
+}
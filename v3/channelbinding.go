@@ -0,0 +1,53 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	"github.com/go-ldap/ldap/v3/internal/channelbinding"
+)
+
+// Channel binding types for TLS connections
+const (
+	// ChannelBindingTLSServerEndPoint binds to the certificate of the server,
+	// see https://www.rfc-editor.org/rfc/rfc5929#section-4
+	ChannelBindingTLSServerEndPoint = "tls-server-end-point"
+	// ChannelBindingTLSExporter binds to keying material exported from the
+	// TLS session, see https://www.rfc-editor.org/rfc/rfc9266
+	ChannelBindingTLSExporter = "tls-exporter"
+)
+
+// defaultChannelBinding returns the channel binding type to use for the
+// connection: tls-exporter for TLS 1.3 and tls-server-end-point otherwise, as
+// tls-exporter requires the extended master secret before TLS 1.3
+func defaultChannelBinding(state tls.ConnectionState) string {
+	if state.Version >= tls.VersionTLS13 {
+		return ChannelBindingTLSExporter
+	}
+	return ChannelBindingTLSServerEndPoint
+}
+
+// channelBindingData returns the channel binding data of the given type for
+// the TLS connection
+func channelBindingData(state tls.ConnectionState, bindingType string) ([]byte, error) {
+	switch bindingType {
+	case ChannelBindingTLSServerEndPoint:
+		if len(state.PeerCertificates) == 0 {
+			return nil, errors.New("ldap: no server certificate for tls-server-end-point channel binding")
+		}
+		data, err := channelbinding.TLSServerEndPointHash(state.PeerCertificates[0])
+		if err != nil {
+			return nil, fmt.Errorf("ldap: %w", err)
+		}
+		return data, nil
+	case ChannelBindingTLSExporter:
+		data, err := state.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+		if err != nil {
+			return nil, fmt.Errorf("ldap: tls-exporter channel binding: %w", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("ldap: unsupported channel binding type %q", bindingType)
+	}
+}
@@ -40,3 +40,9 @@ type Client interface {
 	DirSyncAsync(ctx context.Context, searchRequest *SearchRequest, bufferSize int, flags, maxAttrCount int64, cookie []byte) Response
 	Syncrepl(ctx context.Context, searchRequest *SearchRequest, bufferSize int, mode ControlSyncRequestMode, cookie []byte, reloadHint bool) Response
 }
+
+// SASLBinder is implemented by clients supporting SASL binds with arbitrary
+// mechanisms, such as Conn
+type SASLBinder interface {
+	SASLBind(ctx context.Context, mechanism SASLMechanism, controls []Control) (*SASLBindResult, error)
+}
@@ -0,0 +1,77 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// ClientCertificateReloader provides a TLS client certificate loaded from PEM
+// files, reloading it whenever one of the files is modified, e.g. when a
+// short-lived certificate is rotated by an external agent.
+//
+// Use DialWithClientCertificateReloader to present it for ldaps:// URLs and
+// StartTLS, or set GetClientCertificate of a tls.Config.
+type ClientCertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// NewClientCertificateReloader loads the certificate and private key from the
+// given PEM files, which may be the same file.
+func NewClientCertificateReloader(certFile, keyFile string) (*ClientCertificateReloader, error) {
+	r := &ClientCertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Certificate returns the current certificate, reloading it if the files were
+// modified. If reloading fails, e.g. because the certificate and key are
+// being replaced, the previously loaded certificate is returned.
+func (r *ClientCertificateReloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_ = r.reload()
+	return r.cert
+}
+
+// GetClientCertificate returns the current certificate, suitable for
+// tls.Config.GetClientCertificate.
+func (r *ClientCertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// reload loads the files if their modification times changed since they were
+// loaded last
+func (r *ClientCertificateReloader) reload() error {
+	var modTimes [2]time.Time
+	for i, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	if r.cert != nil && modTimes == r.modTimes {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTimes = modTimes
+	return nil
+}
@@ -0,0 +1,232 @@
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestKeyPair returns a self-signed certificate and its key as PEM
+func createTestKeyPair(t *testing.T, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func leafCommonName(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestClientCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	write := func(certPEM, keyPEM []byte, modTime time.Time) {
+		for file, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+			if err := os.WriteFile(file, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(file, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	certPEM, keyPEM := createTestKeyPair(t, "first")
+	write(certPEM, keyPEM, time.Now())
+	reloader, err := NewClientCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "first", leafCommonName(t, reloader.Certificate()))
+
+	certPEM, keyPEM = createTestKeyPair(t, "rotated")
+	write(certPEM, keyPEM, time.Now().Add(time.Minute))
+	cert, err := reloader.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "rotated", leafCommonName(t, cert))
+
+	// a partially written rotation keeps the previous certificate
+	write(certPEM, []byte("invalid"), time.Now().Add(2*time.Minute))
+	assert.Equal(t, "rotated", leafCommonName(t, reloader.Certificate()))
+
+	_, err = NewClientCertificateReloader(certFile, keyFile)
+	assert.Error(t, err)
+}
+
+func TestDialWithClientCertificateExternalBind(t *testing.T) {
+	serverCertPEM, serverKeyPEM := createTestKeyPair(t, "server")
+	serverCert, err := tls.X509KeyPair(serverCertPEM, serverKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCertPEM, clientKeyPEM := createTestKeyPair(t, "client")
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer func() { _ = c.Close() }()
+		tlsConn := c.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			t.Error(err)
+			return
+		}
+		peerCertificates := tlsConn.ConnectionState().PeerCertificates
+		if len(peerCertificates) != 1 || peerCertificates[0].Subject.CommonName != "client" {
+			t.Error("expected the client certificate")
+			return
+		}
+
+		// the authorization identity is sent as the SASL credentials
+		req, err := ber.ReadPacket(c)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		auth := req.Children[1].Children[2]
+		assert.Equal(t, "EXTERNAL", auth.Children[0].Value)
+		assert.Equal(t, "dn:cn=client", auth.Children[1].Value)
+		_, _ = c.Write(encodeTestResult(req.Children[0].Value.(int64), ApplicationBindResponse, LDAPResultSuccess).Bytes())
+
+		req, err = ber.ReadPacket(c)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		response := encodeTestResponse(req.Children[0].Value.(int64), ApplicationExtendedResponse, LDAPResultSuccess,
+			ber.NewString(ber.ClassContext, ber.TypePrimitive, 11, "dn:cn=client", "responseValue"))
+		_, _ = c.Write(response.Bytes())
+	}()
+
+	conn, err := DialURL("ldaps://"+listener.Addr().String(),
+		DialWithTLSConfig(&tls.Config{InsecureSkipVerify: true}),
+		DialWithClientCertificate(clientCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := conn.ExternalBindWithAuthzID("dn:cn=client"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := conn.WhoAmI(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "dn:cn=client", result.AuthzID)
+}
+
+func TestDialWithClientCertificateStartTLS(t *testing.T) {
+	serverCertPEM, serverKeyPEM := createTestKeyPair(t, "server")
+	serverCert, err := tls.X509KeyPair(serverCertPEM, serverKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCertPEM, clientKeyPEM := createTestKeyPair(t, "client")
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer func() { _ = c.Close() }()
+
+		req, err := ber.ReadPacket(c)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, _ = c.Write(encodeTestResult(req.Children[0].Value.(int64), ApplicationExtendedResponse, LDAPResultSuccess).Bytes())
+
+		tlsConn := tls.Server(c, &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAnyClientCert,
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			t.Error(err)
+			return
+		}
+		peerCertificates := tlsConn.ConnectionState().PeerCertificates
+		if len(peerCertificates) != 1 || peerCertificates[0].Subject.CommonName != "client" {
+			t.Error("expected the client certificate")
+		}
+	}()
+
+	conn, err := DialURL("ldap://"+listener.Addr().String(), DialWithClientCertificate(clientCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	config := &tls.Config{InsecureSkipVerify: true}
+	if err := conn.StartTLS(config); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, config.GetClientCertificate)
+}
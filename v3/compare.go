@@ -11,6 +11,8 @@ type CompareRequest struct {
 	DN        string
 	Attribute string
 	Value     string
+	// Controls hold optional controls to send with the request
+	Controls []Control
 }
 
 func (req *CompareRequest) appendTo(envelope *ber.Packet) error {
@@ -24,6 +26,9 @@ func (req *CompareRequest) appendTo(envelope *ber.Packet) error {
 	pkt.AppendChild(ava)
 
 	envelope.AppendChild(pkt)
+	if len(req.Controls) > 0 {
+		envelope.AppendChild(encodeControls(req.Controls))
+	}
 
 	return nil
 }
@@ -31,11 +36,17 @@ func (req *CompareRequest) appendTo(envelope *ber.Packet) error {
 // Compare checks to see if the attribute of the dn matches value. Returns true if it does otherwise
 // false with any error that occurs if any.
 func (l *Conn) Compare(dn, attribute, value string) (bool, error) {
-	msgCtx, err := l.doRequest(&CompareRequest{
+	return l.CompareWithRequest(&CompareRequest{
 		DN:        dn,
 		Attribute: attribute,
 		Value:     value,
 	})
+}
+
+// CompareWithRequest performs the compare operation of the request, like
+// Compare, sending the controls of the request along.
+func (l *Conn) CompareWithRequest(compareRequest *CompareRequest) (bool, error) {
+	msgCtx, err := l.doRequest(compareRequest)
 	if err != nil {
 		return false, err
 	}
@@ -118,10 +118,19 @@ type Conn struct {
 	// not share messageMutex or those writers could deadlock.
 	errMutex sync.Mutex
 	err      error
+
+	// negotiation is set by EnableControlNegotiation
+	negotiation *controlNegotiation
+
+	// getClientCertificate is set by DialWithClientCertificate and applied
+	// by StartTLS
+	getClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
 }
 
 var _ Client = &Conn{}
 
+var _ SASLBinder = &Conn{}
+
 // DefaultTimeout is a package-level variable that sets the timeout value
 // used for the Dial and DialTLS methods.
 //
@@ -157,10 +166,50 @@ func DialWithTLSDialer(tlsConfig *tls.Config, dialer *net.Dialer) DialOpt {
 	}
 }
 
+// DialWithClientCertificate presents the TLS client certificate when
+// connecting to an ldaps:// URL or upgrading the connection with StartTLS,
+// e.g. for ExternalBind. Use
+// tls.LoadX509KeyPair or tls.X509KeyPair to load it from files or PEM bytes.
+// It takes precedence over the certificates of the tls.Config.
+func DialWithClientCertificate(cert tls.Certificate) DialOpt {
+	return func(dc *DialContext) {
+		dc.getClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &cert, nil
+		}
+	}
+}
+
+// DialWithClientCertificateReloader presents the current certificate of the
+// reloader when connecting to an ldaps:// URL or upgrading the connection with
+// StartTLS, so rotated certificates are
+// used by new connections without restarting the application.
+// It takes precedence over the certificates of the tls.Config.
+func DialWithClientCertificateReloader(reloader *ClientCertificateReloader) DialOpt {
+	return func(dc *DialContext) {
+		dc.getClientCertificate = reloader.GetClientCertificate
+	}
+}
+
 // DialContext contains necessary parameters to dial the given ldap URL.
 type DialContext struct {
-	dialer    *net.Dialer
-	tlsConfig *tls.Config
+	dialer               *net.Dialer
+	tlsConfig            *tls.Config
+	getClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+}
+
+// withClientCertificate returns the TLS configuration with the client
+// certificate applied, leaving the configuration passed by the caller unchanged
+func withClientCertificate(config *tls.Config, getClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)) *tls.Config {
+	if getClientCertificate == nil {
+		return config
+	}
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	config.GetClientCertificate = getClientCertificate
+	return config
 }
 
 func (dc *DialContext) dial(u *url.URL) (net.Conn, error) {
@@ -201,7 +250,7 @@ func (dc *DialContext) dial(u *url.URL) (net.Conn, error) {
 		if port == "" {
 			port = DefaultLdapsPort
 		}
-		return tls.DialWithDialer(dc.dialer, "tcp", net.JoinHostPort(host, port), dc.tlsConfig)
+		return tls.DialWithDialer(dc.dialer, "tcp", net.JoinHostPort(host, port), withClientCertificate(dc.tlsConfig, dc.getClientCertificate))
 	}
 
 	return nil, fmt.Errorf("Unknown scheme '%s'", u.Scheme)
@@ -280,6 +329,7 @@ func DialURL(addr string, opts ...DialOpt) (*Conn, error) {
 	}
 
 	conn := NewConn(c, u.Scheme == "ldaps")
+	conn.getClientCertificate = dc.getClientCertificate
 	conn.Start()
 	return conn, nil
 }
@@ -388,6 +438,10 @@ func (l *Conn) setError(err error) {
 }
 
 // StartTLS sends the command to start a TLS session and then creates a new TLS Client
+//
+// The client certificate of DialWithClientCertificate or
+// DialWithClientCertificateReloader takes precedence over the certificates of
+// the config.
 func (l *Conn) StartTLS(config *tls.Config) error {
 	if l.isTLS {
 		return NewError(ErrorNetwork, errors.New("ldap: already encrypted"))
@@ -427,7 +481,7 @@ func (l *Conn) StartTLS(config *tls.Config) error {
 	}
 
 	if err := GetLDAPError(packet); err == nil {
-		conn := tls.Client(l.conn, config)
+		conn := tls.Client(l.conn, withClientCertificate(config, l.getClientCertificate))
 
 		if connErr := conn.Handshake(); connErr != nil {
 			l.Close()
@@ -448,13 +502,31 @@ func (l *Conn) StartTLS(config *tls.Config) error {
 // The return values are their zero values if StartTLS did
 // not succeed.
 func (l *Conn) TLSConnectionState() (state tls.ConnectionState, ok bool) {
-	tc, ok := l.conn.(*tls.Conn)
+	conn := l.conn
+	if sc, isSASL := conn.(*saslConn); isSASL {
+		conn = sc.Conn
+	}
+	tc, ok := conn.(*tls.Conn)
 	if !ok {
 		return
 	}
 	return tc.ConnectionState(), true
 }
 
+// encrypted reports whether the connection uses TLS or a SASL security layer
+// sealing the messages
+func (l *Conn) encrypted() bool {
+	if l.isTLS {
+		return true
+	}
+	sc, isSASL := l.conn.(*saslConn)
+	if !isSASL {
+		return false
+	}
+	layer, ok := sc.layer.(saslConfidentialityLayer)
+	return ok && layer.confidential()
+}
+
 func (l *Conn) sendMessage(packet *ber.Packet) (*messageContext, error) {
 	return l.sendMessageWithFlags(packet, 0)
 }
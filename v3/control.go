@@ -24,6 +24,12 @@ const (
 	ControlTypeWhoAmI = "1.3.6.1.4.1.4203.1.11.3"
 	// ControlTypeSubtreeDelete - https://datatracker.ietf.org/doc/html/draft-armijo-ldap-treedelete-02
 	ControlTypeSubtreeDelete = "1.2.840.113556.1.4.805"
+	// ControlTypeProxiedAuthorization - https://www.rfc-editor.org/rfc/rfc4370
+	ControlTypeProxiedAuthorization = "2.16.840.1.113730.3.4.18"
+	// ControlTypeAuthzIDRequest - https://www.rfc-editor.org/rfc/rfc3829
+	ControlTypeAuthzIDRequest = "2.16.840.1.113730.3.4.16"
+	// ControlTypeAuthzIDResponse - https://www.rfc-editor.org/rfc/rfc3829
+	ControlTypeAuthzIDResponse = "2.16.840.1.113730.3.4.15"
 
 	// ControlTypeServerSideSorting - https://www.ietf.org/rfc/rfc2891.txt
 	ControlTypeServerSideSorting = "1.2.840.113556.1.4.473"
@@ -158,6 +164,9 @@ var ControlTypeMap = map[string]string{
 	ControlTypeManageDsaIT:            "Manage DSA IT",
 	ControlTypeWhoAmI:                 "Who Am I",
 	ControlTypeSubtreeDelete:          "Subtree Delete Control",
+	ControlTypeProxiedAuthorization:   "Proxied Authorization",
+	ControlTypeAuthzIDRequest:         "Authorization Identity Request",
+	ControlTypeAuthzIDResponse:        "Authorization Identity Response",
 
 	ControlTypeServerSideSorting:       "Server Side Sorting",
 	ControlTypeServerSideSortingResult: "Server Side Sorting Result",
@@ -655,8 +664,12 @@ func DecodeControl(packet *ber.Packet) (Control, error) {
 		value.Children[1].Value = c.Cookie
 		return c, nil
 	case ControlTypeBeheraPasswordPolicy:
-		value.Description += " (Password Policy - Behera)"
 		c := NewControlBeheraPasswordPolicy()
+		if value == nil {
+			// the request control has no value
+			return c, nil
+		}
+		value.Description += " (Password Policy - Behera)"
 		if value.Value != nil {
 			valueChildren, err := ber.DecodePacketErr(value.Data.Bytes())
 			if err != nil {
@@ -667,11 +680,17 @@ func DecodeControl(packet *ber.Packet) (Control, error) {
 			value.AppendChild(valueChildren)
 		}
 
+		if len(value.Children) == 0 {
+			return nil, fmt.Errorf("password policy control value is empty")
+		}
 		sequence := value.Children[0]
 
 		for _, child := range sequence.Children {
 			if child.Tag == 0 {
 				// Warning
+				if len(child.Children) == 0 {
+					return nil, fmt.Errorf("password policy warning is empty")
+				}
 				warningPacket := child.Children[0]
 				val, err := ber.ParseInt64(warningPacket.Data.Bytes())
 				if err != nil {
@@ -725,14 +744,40 @@ func DecodeControl(packet *ber.Packet) (Control, error) {
 		return NewControlMicrosoftServerLinkTTL(), nil
 	case ControlTypeSubtreeDelete:
 		return NewControlSubtreeDelete(), nil
+	case ControlTypeProxiedAuthorization:
+		c := NewControlProxiedAuthorization("")
+		if value != nil {
+			value.Description += " (Authorization Identity)"
+			if value.Data != nil {
+				c.AuthzID = value.Data.String()
+			}
+		}
+		return c, nil
+	case ControlTypeAuthzIDRequest:
+		return NewControlAuthzIDRequest(Criticality), nil
+	case ControlTypeAuthzIDResponse:
+		c := NewControlAuthzIDResponse("")
+		if value != nil {
+			value.Description += " (Authorization Identity)"
+			if value.Data != nil {
+				c.AuthzID = value.Data.String()
+			}
+		}
+		return c, nil
 	case ControlTypeServerSideSorting:
 		return NewControlServerSideSorting(value)
 	case ControlTypeServerSideSortingResult:
 		return NewControlServerSideSortingResult(value)
 	case ControlTypeDirSync:
+		if value == nil {
+			return nil, fmt.Errorf("dirSync control value is missing")
+		}
 		value.Description += " (DirSync)"
 		return NewResponseControlDirSync(value)
 	case ControlTypeSyncState:
+		if value == nil {
+			return nil, fmt.Errorf("syncState control value is missing")
+		}
 		value.Description += " (Sync State)"
 		valueChildren, err := ber.DecodePacketErr(value.Data.Bytes())
 		if err != nil {
@@ -740,6 +785,9 @@ func DecodeControl(packet *ber.Packet) (Control, error) {
 		}
 		return NewControlSyncState(valueChildren)
 	case ControlTypeSyncDone:
+		if value == nil {
+			return nil, fmt.Errorf("syncDone control value is missing")
+		}
 		value.Description += " (Sync Done)"
 		valueChildren, err := ber.DecodePacketErr(value.Data.Bytes())
 		if err != nil {
@@ -747,6 +795,9 @@ func DecodeControl(packet *ber.Packet) (Control, error) {
 		}
 		return NewControlSyncDone(valueChildren)
 	case ControlTypeSyncInfo:
+		if value == nil {
+			return nil, fmt.Errorf("syncInfo control value is missing")
+		}
 		value.Description += " (Sync Info)"
 		valueChildren, err := ber.DecodePacketErr(value.Data.Bytes())
 		if err != nil {
@@ -825,6 +876,142 @@ func (c *ControlSubtreeDelete) String() string {
 		ControlTypeSubtreeDelete)
 }
 
+// ControlProxiedAuthorization implements the proxied authorization control
+// described in https://www.rfc-editor.org/rfc/rfc4370, which makes the
+// server perform the operation as the given authorization identity. The
+// control is always critical.
+type ControlProxiedAuthorization struct {
+	// AuthzID is the authorization identity, e.g. "dn:uid=jdoe,ou=people,dc=example,dc=org"
+	// or "u:jdoe". An empty AuthzID requests anonymous authorization.
+	AuthzID string
+}
+
+// NewControlProxiedAuthorization returns a ControlProxiedAuthorization
+// control for the authorization identity
+func NewControlProxiedAuthorization(authzID string) *ControlProxiedAuthorization {
+	return &ControlProxiedAuthorization{AuthzID: authzID}
+}
+
+// NewControlProxiedAuthorizationDN returns a ControlProxiedAuthorization
+// control for the DN, using the authorization identity "dn:<dn>"
+func NewControlProxiedAuthorizationDN(dn string) *ControlProxiedAuthorization {
+	return NewControlProxiedAuthorization("dn:" + dn)
+}
+
+// NewControlProxiedAuthorizationUser returns a ControlProxiedAuthorization
+// control for the user ID, using the authorization identity "u:<userID>"
+func NewControlProxiedAuthorizationUser(userID string) *ControlProxiedAuthorization {
+	return NewControlProxiedAuthorization("u:" + userID)
+}
+
+// GetControlType returns the OID
+func (c *ControlProxiedAuthorization) GetControlType() string {
+	return ControlTypeProxiedAuthorization
+}
+
+// Encode returns the ber packet representation
+func (c *ControlProxiedAuthorization) Encode() *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ControlTypeProxiedAuthorization, "Control Type ("+ControlTypeMap[ControlTypeProxiedAuthorization]+")"))
+	packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, true, "Criticality"))
+	// the value is the authorization identity itself, not BER encoded
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, c.AuthzID, "Control Value (Authorization Identity)"))
+	return packet
+}
+
+// String returns a human-readable description
+func (c *ControlProxiedAuthorization) String() string {
+	return fmt.Sprintf(
+		"Control Type: %s (%q)  Criticality: true  AuthzID: %q",
+		ControlTypeMap[ControlTypeProxiedAuthorization],
+		ControlTypeProxiedAuthorization,
+		c.AuthzID)
+}
+
+// ControlAuthzIDRequest implements the authorization identity request
+// control described in https://www.rfc-editor.org/rfc/rfc3829, which asks the
+// server to return the authorization identity established by a bind in a
+// ControlAuthzIDResponse.
+type ControlAuthzIDRequest struct {
+	// Criticality indicates if this control is required
+	Criticality bool
+}
+
+// NewControlAuthzIDRequest returns a ControlAuthzIDRequest control
+func NewControlAuthzIDRequest(criticality bool) *ControlAuthzIDRequest {
+	return &ControlAuthzIDRequest{Criticality: criticality}
+}
+
+// GetControlType returns the OID
+func (c *ControlAuthzIDRequest) GetControlType() string {
+	return ControlTypeAuthzIDRequest
+}
+
+// Encode returns the ber packet representation
+func (c *ControlAuthzIDRequest) Encode() *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ControlTypeAuthzIDRequest, "Control Type ("+ControlTypeMap[ControlTypeAuthzIDRequest]+")"))
+	if c.Criticality {
+		packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, c.Criticality, "Criticality"))
+	}
+	return packet
+}
+
+// String returns a human-readable description
+func (c *ControlAuthzIDRequest) String() string {
+	return fmt.Sprintf(
+		"Control Type: %s (%q)  Criticality: %t",
+		ControlTypeMap[ControlTypeAuthzIDRequest],
+		ControlTypeAuthzIDRequest,
+		c.Criticality)
+}
+
+// ControlAuthzIDResponse implements the authorization identity response
+// control described in https://www.rfc-editor.org/rfc/rfc3829, which is
+// returned with a successful bind requesting it.
+type ControlAuthzIDResponse struct {
+	// AuthzID is the authorization identity, e.g. "dn:uid=jdoe,ou=people,dc=example,dc=org"
+	// or "u:jdoe". It is empty for an anonymous association.
+	AuthzID string
+}
+
+// NewControlAuthzIDResponse returns a ControlAuthzIDResponse control
+func NewControlAuthzIDResponse(authzID string) *ControlAuthzIDResponse {
+	return &ControlAuthzIDResponse{AuthzID: authzID}
+}
+
+// GetControlType returns the OID
+func (c *ControlAuthzIDResponse) GetControlType() string {
+	return ControlTypeAuthzIDResponse
+}
+
+// Encode returns the ber packet representation
+func (c *ControlAuthzIDResponse) Encode() *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ControlTypeAuthzIDResponse, "Control Type ("+ControlTypeMap[ControlTypeAuthzIDResponse]+")"))
+	// the value is the authorization identity itself, not BER encoded
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, c.AuthzID, "Control Value (Authorization Identity)"))
+	return packet
+}
+
+// String returns a human-readable description
+func (c *ControlAuthzIDResponse) String() string {
+	return fmt.Sprintf(
+		"Control Type: %s (%q)  Criticality: false  AuthzID: %q",
+		ControlTypeMap[ControlTypeAuthzIDResponse],
+		ControlTypeAuthzIDResponse,
+		c.AuthzID)
+}
+
+// authzIDFromControls returns the authorization identity of a
+// ControlAuthzIDResponse in the controls, and whether there is one
+func authzIDFromControls(controls []Control) (string, bool) {
+	if c, ok := FindControl(controls, ControlTypeAuthzIDResponse).(*ControlAuthzIDResponse); ok {
+		return c.AuthzID, true
+	}
+	return "", false
+}
+
 func encodeControls(controls []Control) *ber.Packet {
 	packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
 	for _, control := range controls {
@@ -869,10 +1056,21 @@ func NewResponseControlDirSync(value *ber.Packet) (*ControlDirSync, error) {
 		value.Value = nil
 		value.AppendChild(valueChildren)
 	}
+	if len(value.Children) == 0 {
+		return nil, fmt.Errorf("dirSync control value is empty")
+	}
 	child := value.Children[0]
 	if len(child.Children) != 3 { // also on initial creation, Cookie is an empty string
 		return nil, fmt.Errorf("invalid number of children in dirSync control")
 	}
+	flags, ok := child.Children[0].Value.(int64)
+	if !ok {
+		return nil, fmt.Errorf("dirSync flags are not an integer: %T", child.Children[0].Value)
+	}
+	maxAttrCount, ok := child.Children[1].Value.(int64)
+	if !ok {
+		return nil, fmt.Errorf("dirSync maxAttrCount is not an integer: %T", child.Children[1].Value)
+	}
 	child.Description = "DirSync Control Value"
 	child.Children[0].Description = "Flags"
 	child.Children[1].Description = "MaxAttrCount"
@@ -882,8 +1080,8 @@ func NewResponseControlDirSync(value *ber.Packet) (*ControlDirSync, error) {
 	child.Children[2].Value = cookie
 	return &ControlDirSync{
 		Criticality:  true,
-		Flags:        child.Children[0].Value.(int64),
-		MaxAttrCount: child.Children[1].Value.(int64),
+		Flags:        flags,
+		MaxAttrCount: maxAttrCount,
 		Cookie:       cookie,
 	}, nil
 }
@@ -959,6 +1157,9 @@ func (c *ControlServerSideSorting) GetControlType() string {
 }
 
 func NewControlServerSideSorting(value *ber.Packet) (*ControlServerSideSorting, error) {
+	if value == nil {
+		return nil, fmt.Errorf("server side sorting control value is missing")
+	}
 	val, err := ber.DecodePacketErr(value.Data.Bytes())
 	if err != nil {
 		return nil, fmt.Errorf("decode packet err: %s", err)
@@ -1253,19 +1454,19 @@ func NewControlSyncState(pkt *ber.Packet) (*ControlSyncState, error) {
 	switch len(pkt.Children) {
 	case 0, 1:
 		return nil, fmt.Errorf("at least two children are required: %d", len(pkt.Children))
-	case 2:
-		state = ControlSyncStateState(pkt.Children[0].Value.(int64))
-		entryUUID, err = uuid.FromBytes(pkt.Children[1].ByteValue)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode uuid: %w", err)
+	case 2, 3:
+		value, ok := pkt.Children[0].Value.(int64)
+		if !ok {
+			return nil, fmt.Errorf("sync state is not an integer: %T", pkt.Children[0].Value)
 		}
-	case 3:
-		state = ControlSyncStateState(pkt.Children[0].Value.(int64))
+		state = ControlSyncStateState(value)
 		entryUUID, err = uuid.FromBytes(pkt.Children[1].ByteValue)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode uuid: %w", err)
 		}
-		cookie = pkt.Children[2].ByteValue
+		if len(pkt.Children) == 3 {
+			cookie = pkt.Children[2].ByteValue
+		}
 	}
 	return &ControlSyncState{
 		Criticality: false,
@@ -1317,7 +1518,10 @@ func NewControlSyncDone(pkt *ber.Packet) (*ControlSyncDone, error) {
 		cookie = pkt.Children[0].ByteValue
 	case 2:
 		cookie = pkt.Children[0].ByteValue
-		refreshDeletes = pkt.Children[1].Value.(bool)
+		var ok bool
+		if refreshDeletes, ok = pkt.Children[1].Value.(bool); !ok {
+			return nil, fmt.Errorf("refreshDeletes is not a boolean: %T", pkt.Children[1].Value)
+		}
 	}
 	return &ControlSyncDone{
 		Criticality:    false,
@@ -1451,7 +1655,10 @@ func NewControlSyncInfo(pkt *ber.Packet) (*ControlSyncInfo, error) {
 			cookie = pkt.Children[0].ByteValue
 		case 2:
 			cookie = pkt.Children[0].ByteValue
-			refreshDone = pkt.Children[1].Value.(bool)
+			var ok bool
+			if refreshDone, ok = pkt.Children[1].Value.(bool); !ok {
+				return nil, fmt.Errorf("refreshDone is not a boolean: %T", pkt.Children[1].Value)
+			}
 		}
 		c.RefreshDelete = &ControlSyncInfoRefreshDelete{
 			Cookie:      cookie,
@@ -1466,7 +1673,10 @@ func NewControlSyncInfo(pkt *ber.Packet) (*ControlSyncInfo, error) {
 			cookie = pkt.Children[0].ByteValue
 		case 2:
 			cookie = pkt.Children[0].ByteValue
-			refreshDone = pkt.Children[1].Value.(bool)
+			var ok bool
+			if refreshDone, ok = pkt.Children[1].Value.(bool); !ok {
+				return nil, fmt.Errorf("refreshDone is not a boolean: %T", pkt.Children[1].Value)
+			}
 		}
 		c.RefreshPresent = &ControlSyncInfoRefreshPresent{
 			Cookie:      cookie,
@@ -1481,10 +1691,16 @@ func NewControlSyncInfo(pkt *ber.Packet) (*ControlSyncInfo, error) {
 			cookie = pkt.Children[0].ByteValue
 		case 2:
 			cookie = pkt.Children[0].ByteValue
-			refreshDeletes = pkt.Children[1].Value.(bool)
+			var ok bool
+			if refreshDeletes, ok = pkt.Children[1].Value.(bool); !ok {
+				return nil, fmt.Errorf("refreshDeletes is not a boolean: %T", pkt.Children[1].Value)
+			}
 		case 3:
 			cookie = pkt.Children[0].ByteValue
-			refreshDeletes = pkt.Children[1].Value.(bool)
+			var ok bool
+			if refreshDeletes, ok = pkt.Children[1].Value.(bool); !ok {
+				return nil, fmt.Errorf("refreshDeletes is not a boolean: %T", pkt.Children[1].Value)
+			}
 			syncUUIDs = make([]uuid.UUID, 0, len(pkt.Children[2].Children))
 			for _, child := range pkt.Children[2].Children {
 				u, err := uuid.FromBytes(child.ByteValue)
@@ -82,6 +82,57 @@ func TestDecodeControlPagingMalformed(t *testing.T) {
 	}
 }
 
+func TestDecodeControlMalformedValues(t *testing.T) {
+	// response controls of unexpected structure must be rejected instead of
+	// panicking
+	control := func(controlType string, value *ber.Packet) *ber.Packet {
+		p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+		p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, controlType, "Control Type"))
+		p.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, false, "Criticality"))
+		if value != nil {
+			p.AppendChild(value)
+		}
+		return p
+	}
+	encodedValue := func(children ...*ber.Packet) *ber.Packet {
+		seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Value")
+		for _, c := range children {
+			seq.AppendChild(c)
+		}
+		return ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(seq.Bytes()), "Control Value")
+	}
+	str := func(s string) *ber.Packet {
+		return ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, s, "")
+	}
+
+	for _, tt := range []struct {
+		name    string
+		packet  *ber.Packet
+		wantErr string
+	}{
+		{"dirSync without value", control(ControlTypeDirSync, nil), "dirSync control value is missing"},
+		{"dirSync flags not an integer", control(ControlTypeDirSync, encodedValue(str("x"), str("y"), str(""))), "flags are not an integer"},
+		{"sync state without value", control(ControlTypeSyncState, nil), "syncState control value is missing"},
+		{"sync state not an integer", control(ControlTypeSyncState, encodedValue(str("x"), str("0123456789abcdef"))), "sync state is not an integer"},
+		{"sync done without value", control(ControlTypeSyncDone, nil), "syncDone control value is missing"},
+		{"sync done refreshDeletes not a boolean", control(ControlTypeSyncDone, encodedValue(str("cookie"), str("x"))), "refreshDeletes is not a boolean"},
+		{"sync info without value", control(ControlTypeSyncInfo, nil), "syncInfo control value is missing"},
+		{"server side sorting without value", control(ControlTypeServerSideSorting, nil), "server side sorting control value is missing"},
+		{"password policy with empty value", control(ControlTypeBeheraPasswordPolicy, ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control Value")), "password policy control value is empty"},
+		{"password policy with empty warning", control(ControlTypeBeheraPasswordPolicy, encodedValue(ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Warning"))), "password policy warning is empty"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeControl(tt.packet)
+			if err == nil {
+				t.Fatalf("DecodeControl returned nil error, want one containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestControlManageDsaIT(t *testing.T) {
 	runControlTest(t, NewControlManageDsaIT(true))
 	runControlTest(t, NewControlManageDsaIT(false))
@@ -115,6 +166,19 @@ func TestControlDirSync(t *testing.T) {
 	runControlTest(t, NewRequestControlDirSync(DirSyncObjectSecurity, 1000, []byte("I'm a cookie!")))
 }
 
+func TestControlProxiedAuthorization(t *testing.T) {
+	runControlTest(t, NewControlProxiedAuthorizationDN("uid=jdoe,ou=people,dc=example,dc=org"))
+	runControlTest(t, NewControlProxiedAuthorizationUser("jdoe"))
+	runControlTest(t, NewControlProxiedAuthorization(""))
+}
+
+func TestControlAuthzID(t *testing.T) {
+	runControlTest(t, NewControlAuthzIDRequest(false))
+	runControlTest(t, NewControlAuthzIDRequest(true))
+	runControlTest(t, NewControlAuthzIDResponse("dn:uid=jdoe,ou=people,dc=example,dc=org"))
+	runControlTest(t, NewControlAuthzIDResponse(""))
+}
+
 func runControlTest(t *testing.T, originalControl Control) {
 	header := ""
 	if callerpc, _, line, ok := runtime.Caller(1); ok {
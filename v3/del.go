@@ -41,6 +41,20 @@ func (l *Conn) Del(delRequest *DelRequest) error {
 		return NewError(ErrorNetwork, errors.New("DelRequest cannot be nil"))
 	}
 
+	controls, removed := l.negotiateControls("delete", delRequest.DN, delRequest.Controls, ControlTypeSubtreeDelete)
+	if len(removed) == 0 {
+		return l.del(delRequest)
+	}
+
+	req := *delRequest
+	req.Controls = controls
+	if FindControl(removed, ControlTypeSubtreeDelete) != nil {
+		return l.deleteSubtree(&req)
+	}
+	return l.del(&req)
+}
+
+func (l *Conn) del(delRequest *DelRequest) error {
 	msgCtx, err := l.doRequest(delRequest)
 	if err != nil {
 		return err
@@ -187,6 +187,14 @@ type Error struct {
 	MatchedDN string
 	// Packet is the returned packet if any
 	Packet *ber.Packet
+	// DiagnosticMessage is the diagnostic message returned by the server
+	DiagnosticMessage string
+	// Referrals are the referral URIs returned by the server
+	Referrals []string
+	// Controls are the controls describing the error returned by the server,
+	// currently the password policy control. Controls which can not be
+	// decoded are skipped.
+	Controls []Control
 }
 
 func (e *Error) Error() string {
@@ -224,11 +232,15 @@ func GetLDAPError(packet *ber.Packet) error {
 					if response.Children[1].Value == nil {
 						return &Error{ResultCode: ErrorNetwork, Err: fmt.Errorf("Invalid matchedDN in packet"), Packet: packet}
 					}
+					diagnosticMessage, _ := response.Children[2].Value.(string)
 					return &Error{
-						ResultCode: resultCode,
-						MatchedDN:  response.Children[1].Value.(string),
-						Err:        fmt.Errorf("%v", response.Children[2].Value),
-						Packet:     packet,
+						ResultCode:        resultCode,
+						MatchedDN:         response.Children[1].Value.(string),
+						Err:               fmt.Errorf("%v", response.Children[2].Value),
+						Packet:            packet,
+						DiagnosticMessage: diagnosticMessage,
+						Referrals:         errorReferrals(response),
+						Controls:          errorControls(packet),
 					}
 				}
 			}
@@ -238,6 +250,42 @@ func GetLDAPError(packet *ber.Packet) error {
 	return &Error{ResultCode: ErrorNetwork, Err: fmt.Errorf("Invalid packet format"), Packet: packet}
 }
 
+// errorReferrals returns the referral URIs of an LDAPResult
+func errorReferrals(response *ber.Packet) []string {
+	var referrals []string
+	for _, child := range response.Children[3:] {
+		// see getReferral for the tags used by servers
+		if (child.Tag != ber.TagBitString && child.Tag != ber.TagPrintableString) || child.TagType != ber.TypeConstructed || child.ClassType != ber.ClassContext {
+			continue
+		}
+		for _, uri := range child.Children {
+			if referral, ok := uri.Value.(string); ok {
+				referrals = append(referrals, referral)
+			}
+		}
+	}
+	return referrals
+}
+
+// errorControls returns the controls of a response describing the error,
+// skipping controls which can not be decoded, as the error of the operation
+// is more important
+func errorControls(packet *ber.Packet) []Control {
+	if len(packet.Children) < 3 {
+		return nil
+	}
+	var controls []Control
+	for _, child := range packet.Children[2].Children {
+		if len(child.Children) == 0 || child.Children[0].Value != ControlTypeBeheraPasswordPolicy {
+			continue
+		}
+		if control, err := DecodeControl(child); err == nil {
+			controls = append(controls, control)
+		}
+	}
+	return controls
+}
+
 // NewError creates an LDAP error with the given code and underlying error
 func NewError(resultCode uint16, err error) error {
 	return &Error{ResultCode: resultCode, Err: err}
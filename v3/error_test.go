@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -336,3 +337,63 @@ func (c *signalErrConn) SetReadDeadline(t time.Time) error {
 func (c *signalErrConn) SetWriteDeadline(t time.Time) error {
 	return nil
 }
+
+// encodeTestErrorResult returns a response with the result code, diagnostic
+// message and additional children appended to the result
+func encodeTestErrorResult(msgID int64, application ber.Tag, resultCode uint16, message string, children ...*ber.Packet) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(resultCode), "resultCode"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "dc=example,dc=org", "matchedDN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "diagnosticMessage"))
+	for _, child := range children {
+		result.AppendChild(child)
+	}
+
+	response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+	response.AppendChild(result)
+	return response
+}
+
+func TestGetLDAPErrorDetails(t *testing.T) {
+	referral := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, nil, "Referral")
+	referral.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "ldap://a.example.org/dc=example,dc=org", "URI"))
+	referral.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "ldap://b.example.org/dc=example,dc=org", "URI"))
+	packet := encodeTestErrorResult(1, ApplicationModifyResponse, LDAPResultReferral, "referral", referral)
+	// only the password policy control is decoded, other controls and
+	// controls which can not be decoded are skipped
+	invalid := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	invalid.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ControlTypeBeheraPasswordPolicy, "Control Type"))
+	invalid.AppendChild(ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control Value"))
+	dirSync := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	dirSync.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ControlTypeDirSync, "Control Type"))
+	controls := encodeControls([]Control{NewControlManageDsaIT(false)})
+	controls.AppendChild(invalid)
+	controls.AppendChild(dirSync)
+	controls.AppendChild(encodeTestPasswordPolicy(-1, -1, BeheraPasswordExpired))
+	packet.AppendChild(controls)
+
+	// decode the packet like the reader does
+	packet, err := ber.DecodePacketErr(packet.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = GetLDAPError(packet)
+	var ldapErr *Error
+	if !errors.As(err, &ldapErr) {
+		t.Fatalf("Expected error of type *Error, got %T", err)
+	}
+	if ldapErr.DiagnosticMessage != "referral" {
+		t.Errorf("Got incorrect diagnostic message; got %q", ldapErr.DiagnosticMessage)
+	}
+	expectedReferrals := []string{"ldap://a.example.org/dc=example,dc=org", "ldap://b.example.org/dc=example,dc=org"}
+	if !reflect.DeepEqual(ldapErr.Referrals, expectedReferrals) {
+		t.Errorf("Got incorrect referrals; got %v, expected %v", ldapErr.Referrals, expectedReferrals)
+	}
+	if len(ldapErr.Controls) != 1 {
+		t.Fatalf("Got incorrect controls; got %v, expected the password policy control", ldapErr.Controls)
+	}
+	if ppolicy, ok := ldapErr.Controls[0].(*ControlBeheraPasswordPolicy); !ok || ppolicy.Error != BeheraPasswordExpired {
+		t.Errorf("Got incorrect password policy control %v", ldapErr.Controls[0])
+	}
+}
@@ -558,6 +558,59 @@ func ExampleConn_ExternalBind() {
 	// Conduct ldap queries
 }
 
+// This example demonstrates how to present a client certificate which is
+// reloaded when it is rotated, e.g. by an external agent renewing short-lived
+// certificates.
+func ExampleClientCertificateReloader() {
+	reloader, err := NewClientCertificateReloader("/path/to/cert.pem", "/path/to/key.pem")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the certificate is presented for ldaps:// URLs and StartTLS
+	l, err := DialURL("ldap://ldap.example.com:389", DialWithClientCertificateReloader(reloader))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	err = l.StartTLS(&tls.Config{ServerName: "ldap.example.com"})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = l.ExternalBind()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// This example demonstrates how to request an authorization identity with
+// EXTERNAL SASL and confirm the identity assigned by the server.
+func ExampleConn_ExternalBindWithAuthzID() {
+	cert, err := tls.LoadX509KeyPair("/path/to/cert.pem", "/path/to/key.pem")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	l, err := DialURL("ldaps://ldap.example.com:636", DialWithClientCertificate(cert))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	err = l.ExternalBindWithAuthzID("dn:cn=admin,dc=example,dc=com")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	res, err := l.WhoAmI(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Bound as: %s\n", res.AuthzID)
+}
+
 // ExampleConn_WhoAmI demonstrates how to run a whoami request according to https://tools.ietf.org/html/rfc4532
 func ExampleConn_WhoAmI() {
 	conn, err := DialURL("ldap.example.org:389")
@@ -73,20 +73,21 @@ var MatchingRuleAssertionMap = map[uint64]string{
 
 var _SymbolAny = []byte{'*'}
 
-// CompileFilter converts a string representation of a filter into a BER-encoded packet
+// CompileFilter converts a string representation of a filter into a BER-encoded packet.
+// Syntax errors are reported as a *FilterSyntaxError wrapped in an *Error.
 func CompileFilter(filter string) (*ber.Packet, error) {
 	if len(filter) == 0 || filter[0] != '(' {
-		return nil, NewError(ErrorFilterCompile, errors.New("ldap: filter does not start with an '('"))
+		return nil, compileFilterError(filter, NewError(ErrorFilterCompile, errors.New("ldap: filter does not start with an '('")))
 	}
 	packet, pos, err := compileFilter(filter, 1)
 	if err != nil {
-		return nil, err
+		return nil, compileFilterError(filter, err)
 	}
 	switch {
 	case pos > len(filter):
-		return nil, NewError(ErrorFilterCompile, errors.New("ldap: unexpected end of filter"))
+		return nil, compileFilterError(filter, NewError(ErrorFilterCompile, errors.New("ldap: unexpected end of filter")))
 	case pos < len(filter):
-		return nil, NewError(ErrorFilterCompile, errors.New("ldap: finished compiling filter with extra at end: "+fmt.Sprint(filter[pos:])))
+		return nil, compileFilterError(filter, NewError(ErrorFilterCompile, errors.New("ldap: finished compiling filter with extra at end: "+fmt.Sprint(filter[pos:]))))
 	}
 	return packet, nil
 }
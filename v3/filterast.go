@@ -0,0 +1,415 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// Filter is a search filter as defined in https://www.rfc-editor.org/rfc/rfc4511#section-4.5.1.7
+// built from the node types of this package. Values held by the nodes are
+// not escaped, escaping is applied by String.
+type Filter interface {
+	// Encode returns the ber packet representation
+	Encode() *ber.Packet
+	// String returns the RFC 4515 string representation
+	String() string
+}
+
+// AndFilter matches if all of its filters match. An empty AndFilter is always true.
+type AndFilter struct {
+	Filters []Filter
+}
+
+// OrFilter matches if any of its filters match. An empty OrFilter is always false.
+type OrFilter struct {
+	Filters []Filter
+}
+
+// NotFilter matches if its filter does not match
+type NotFilter struct {
+	Filter Filter
+}
+
+// EqualityFilter matches entries having the attribute with the value
+type EqualityFilter struct {
+	Attribute string
+	Value     string
+}
+
+// SubstringsFilter matches entries having the attribute with a value that
+// starts with Initial, contains the Any parts in order and ends with Final.
+// Empty Initial and Final parts are omitted.
+type SubstringsFilter struct {
+	Attribute string
+	Initial   string
+	Any       []string
+	Final     string
+}
+
+// GreaterOrEqualFilter matches entries having the attribute with a value greater or equal to the value
+type GreaterOrEqualFilter struct {
+	Attribute string
+	Value     string
+}
+
+// LessOrEqualFilter matches entries having the attribute with a value less or equal to the value
+type LessOrEqualFilter struct {
+	Attribute string
+	Value     string
+}
+
+// PresentFilter matches entries having the attribute
+type PresentFilter struct {
+	Attribute string
+}
+
+// ApproxFilter matches entries having the attribute with a value approximately equal to the value
+type ApproxFilter struct {
+	Attribute string
+	Value     string
+}
+
+// ExtensibleMatchFilter matches entries using the given matching rule. At least
+// one of MatchingRule and Attribute must be set.
+type ExtensibleMatchFilter struct {
+	MatchingRule string
+	Attribute    string
+	Value        string
+	DNAttributes bool
+}
+
+// NewAndFilter returns a filter matching if all of the filters match
+func NewAndFilter(filters ...Filter) *AndFilter {
+	return &AndFilter{Filters: filters}
+}
+
+// NewOrFilter returns a filter matching if any of the filters match
+func NewOrFilter(filters ...Filter) *OrFilter {
+	return &OrFilter{Filters: filters}
+}
+
+// NewNotFilter returns a filter matching if the filter does not match
+func NewNotFilter(filter Filter) *NotFilter {
+	return &NotFilter{Filter: filter}
+}
+
+// NewEqualityFilter returns an equality filter for the attribute and the unescaped value
+func NewEqualityFilter(attribute, value string) *EqualityFilter {
+	return &EqualityFilter{Attribute: attribute, Value: value}
+}
+
+// NewSubstringsFilter returns a substrings filter for the attribute and the unescaped parts
+func NewSubstringsFilter(attribute, initial string, any []string, final string) *SubstringsFilter {
+	return &SubstringsFilter{Attribute: attribute, Initial: initial, Any: any, Final: final}
+}
+
+// NewGreaterOrEqualFilter returns a greater or equal filter for the attribute and the unescaped value
+func NewGreaterOrEqualFilter(attribute, value string) *GreaterOrEqualFilter {
+	return &GreaterOrEqualFilter{Attribute: attribute, Value: value}
+}
+
+// NewLessOrEqualFilter returns a less or equal filter for the attribute and the unescaped value
+func NewLessOrEqualFilter(attribute, value string) *LessOrEqualFilter {
+	return &LessOrEqualFilter{Attribute: attribute, Value: value}
+}
+
+// NewPresentFilter returns a presence filter for the attribute
+func NewPresentFilter(attribute string) *PresentFilter {
+	return &PresentFilter{Attribute: attribute}
+}
+
+// NewApproxFilter returns an approximate match filter for the attribute and the unescaped value
+func NewApproxFilter(attribute, value string) *ApproxFilter {
+	return &ApproxFilter{Attribute: attribute, Value: value}
+}
+
+// NewExtensibleMatchFilter returns an extensible match filter
+func NewExtensibleMatchFilter(matchingRule, attribute, value string, dnAttributes bool) *ExtensibleMatchFilter {
+	return &ExtensibleMatchFilter{MatchingRule: matchingRule, Attribute: attribute, Value: value, DNAttributes: dnAttributes}
+}
+
+// ParseFilter parses the string representation of a filter
+func ParseFilter(filter string) (Filter, error) {
+	packet, err := CompileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeFilter(packet)
+}
+
+// DecodeFilter converts a packet representation of a filter into a Filter
+func DecodeFilter(packet *ber.Packet) (_ Filter, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = NewError(ErrorFilterDecompile, errors.New("ldap: error decoding filter"))
+		}
+	}()
+
+	if packet.ClassType != ber.ClassContext {
+		return nil, NewError(ErrorFilterDecompile, fmt.Errorf("ldap: invalid filter class %d", packet.ClassType))
+	}
+
+	switch packet.Tag {
+	case FilterAnd, FilterOr:
+		filters := make([]Filter, 0, len(packet.Children))
+		for _, child := range packet.Children {
+			filter, err := DecodeFilter(child)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, filter)
+		}
+		if packet.Tag == FilterAnd {
+			return &AndFilter{Filters: filters}, nil
+		}
+		return &OrFilter{Filters: filters}, nil
+	case FilterNot:
+		if len(packet.Children) != 1 {
+			return nil, NewError(ErrorFilterDecompile, fmt.Errorf("ldap: not filter must have 1 child, got %d", len(packet.Children)))
+		}
+		filter, err := DecodeFilter(packet.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		return &NotFilter{Filter: filter}, nil
+	case FilterEqualityMatch:
+		attribute, value := decodeAttributeValueAssertion(packet)
+		return &EqualityFilter{Attribute: attribute, Value: value}, nil
+	case FilterGreaterOrEqual:
+		attribute, value := decodeAttributeValueAssertion(packet)
+		return &GreaterOrEqualFilter{Attribute: attribute, Value: value}, nil
+	case FilterLessOrEqual:
+		attribute, value := decodeAttributeValueAssertion(packet)
+		return &LessOrEqualFilter{Attribute: attribute, Value: value}, nil
+	case FilterApproxMatch:
+		attribute, value := decodeAttributeValueAssertion(packet)
+		return &ApproxFilter{Attribute: attribute, Value: value}, nil
+	case FilterPresent:
+		return &PresentFilter{Attribute: ber.DecodeString(packet.Data.Bytes())}, nil
+	case FilterSubstrings:
+		filter := &SubstringsFilter{Attribute: ber.DecodeString(packet.Children[0].Data.Bytes())}
+		parts := packet.Children[1].Children
+		if len(parts) == 0 {
+			return nil, NewError(ErrorFilterDecompile, errors.New("ldap: substrings filter without substrings"))
+		}
+		for i, part := range parts {
+			value := ber.DecodeString(part.Data.Bytes())
+			switch {
+			case part.Tag == FilterSubstringsInitial && i == 0:
+				filter.Initial = value
+			case part.Tag == FilterSubstringsAny:
+				filter.Any = append(filter.Any, value)
+			case part.Tag == FilterSubstringsFinal && i == len(parts)-1:
+				filter.Final = value
+			default:
+				return nil, NewError(ErrorFilterDecompile, fmt.Errorf("ldap: unexpected %s at position %d", FilterSubstringsMap[uint64(part.Tag)], i))
+			}
+		}
+		return filter, nil
+	case FilterExtensibleMatch:
+		filter := &ExtensibleMatchFilter{}
+		for _, child := range packet.Children {
+			switch child.Tag {
+			case MatchingRuleAssertionMatchingRule:
+				filter.MatchingRule = ber.DecodeString(child.Data.Bytes())
+			case MatchingRuleAssertionType:
+				filter.Attribute = ber.DecodeString(child.Data.Bytes())
+			case MatchingRuleAssertionMatchValue:
+				filter.Value = ber.DecodeString(child.Data.Bytes())
+			case MatchingRuleAssertionDNAttributes:
+				filter.DNAttributes = child.Value.(bool)
+			}
+		}
+		return filter, nil
+	default:
+		return nil, NewError(ErrorFilterDecompile, fmt.Errorf("ldap: unknown filter choice %d", packet.Tag))
+	}
+}
+
+func decodeAttributeValueAssertion(packet *ber.Packet) (string, string) {
+	return ber.DecodeString(packet.Children[0].Data.Bytes()), ber.DecodeString(packet.Children[1].Data.Bytes())
+}
+
+func encodeFilterSet(tag ber.Tag, filters []Filter) *ber.Packet {
+	packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, tag, nil, FilterMap[uint64(tag)])
+	for _, filter := range filters {
+		packet.AppendChild(filter.Encode())
+	}
+	return packet
+}
+
+func encodeAttributeValueAssertion(tag ber.Tag, attribute, value string) *ber.Packet {
+	packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, tag, nil, FilterMap[uint64(tag)])
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute, "Attribute"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Condition"))
+	return packet
+}
+
+func filterSetString(op byte, filters []Filter) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	b.WriteByte(op)
+	for _, filter := range filters {
+		b.WriteString(filter.String())
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func attributeValueAssertionString(attribute, op, value string) string {
+	return "(" + EscapeFilter(attribute) + op + EscapeFilter(value) + ")"
+}
+
+// Encode returns the ber packet representation
+func (f *AndFilter) Encode() *ber.Packet {
+	return encodeFilterSet(FilterAnd, f.Filters)
+}
+
+// String returns the RFC 4515 string representation
+func (f *AndFilter) String() string {
+	return filterSetString('&', f.Filters)
+}
+
+// Encode returns the ber packet representation
+func (f *OrFilter) Encode() *ber.Packet {
+	return encodeFilterSet(FilterOr, f.Filters)
+}
+
+// String returns the RFC 4515 string representation
+func (f *OrFilter) String() string {
+	return filterSetString('|', f.Filters)
+}
+
+// Encode returns the ber packet representation
+func (f *NotFilter) Encode() *ber.Packet {
+	packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, FilterNot, nil, FilterMap[FilterNot])
+	packet.AppendChild(f.Filter.Encode())
+	return packet
+}
+
+// String returns the RFC 4515 string representation
+func (f *NotFilter) String() string {
+	return "(!" + f.Filter.String() + ")"
+}
+
+// Encode returns the ber packet representation
+func (f *EqualityFilter) Encode() *ber.Packet {
+	return encodeAttributeValueAssertion(FilterEqualityMatch, f.Attribute, f.Value)
+}
+
+// String returns the RFC 4515 string representation
+func (f *EqualityFilter) String() string {
+	return attributeValueAssertionString(f.Attribute, "=", f.Value)
+}
+
+// Encode returns the ber packet representation
+func (f *SubstringsFilter) Encode() *ber.Packet {
+	packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, FilterSubstrings, nil, FilterMap[FilterSubstrings])
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, f.Attribute, "Attribute"))
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Substrings")
+	if f.Initial != "" {
+		seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, FilterSubstringsInitial, f.Initial, FilterSubstringsMap[FilterSubstringsInitial]))
+	}
+	for _, part := range f.Any {
+		seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, FilterSubstringsAny, part, FilterSubstringsMap[FilterSubstringsAny]))
+	}
+	if f.Final != "" {
+		seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, FilterSubstringsFinal, f.Final, FilterSubstringsMap[FilterSubstringsFinal]))
+	}
+	packet.AppendChild(seq)
+	return packet
+}
+
+// String returns the RFC 4515 string representation
+func (f *SubstringsFilter) String() string {
+	var b strings.Builder
+	b.WriteByte('(')
+	b.WriteString(EscapeFilter(f.Attribute))
+	b.WriteByte('=')
+	b.WriteString(EscapeFilter(f.Initial))
+	b.WriteByte('*')
+	for _, part := range f.Any {
+		b.WriteString(EscapeFilter(part))
+		b.WriteByte('*')
+	}
+	b.WriteString(EscapeFilter(f.Final))
+	b.WriteByte(')')
+	return b.String()
+}
+
+// Encode returns the ber packet representation
+func (f *GreaterOrEqualFilter) Encode() *ber.Packet {
+	return encodeAttributeValueAssertion(FilterGreaterOrEqual, f.Attribute, f.Value)
+}
+
+// String returns the RFC 4515 string representation
+func (f *GreaterOrEqualFilter) String() string {
+	return attributeValueAssertionString(f.Attribute, ">=", f.Value)
+}
+
+// Encode returns the ber packet representation
+func (f *LessOrEqualFilter) Encode() *ber.Packet {
+	return encodeAttributeValueAssertion(FilterLessOrEqual, f.Attribute, f.Value)
+}
+
+// String returns the RFC 4515 string representation
+func (f *LessOrEqualFilter) String() string {
+	return attributeValueAssertionString(f.Attribute, "<=", f.Value)
+}
+
+// Encode returns the ber packet representation
+func (f *PresentFilter) Encode() *ber.Packet {
+	return ber.NewString(ber.ClassContext, ber.TypePrimitive, FilterPresent, f.Attribute, FilterMap[FilterPresent])
+}
+
+// String returns the RFC 4515 string representation
+func (f *PresentFilter) String() string {
+	return "(" + EscapeFilter(f.Attribute) + "=*)"
+}
+
+// Encode returns the ber packet representation
+func (f *ApproxFilter) Encode() *ber.Packet {
+	return encodeAttributeValueAssertion(FilterApproxMatch, f.Attribute, f.Value)
+}
+
+// String returns the RFC 4515 string representation
+func (f *ApproxFilter) String() string {
+	return attributeValueAssertionString(f.Attribute, "~=", f.Value)
+}
+
+// Encode returns the ber packet representation
+func (f *ExtensibleMatchFilter) Encode() *ber.Packet {
+	packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, FilterExtensibleMatch, nil, FilterMap[FilterExtensibleMatch])
+	if f.MatchingRule != "" {
+		packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, MatchingRuleAssertionMatchingRule, f.MatchingRule, MatchingRuleAssertionMap[MatchingRuleAssertionMatchingRule]))
+	}
+	if f.Attribute != "" {
+		packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, MatchingRuleAssertionType, f.Attribute, MatchingRuleAssertionMap[MatchingRuleAssertionType]))
+	}
+	packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, MatchingRuleAssertionMatchValue, f.Value, MatchingRuleAssertionMap[MatchingRuleAssertionMatchValue]))
+	if f.DNAttributes {
+		packet.AppendChild(ber.NewBoolean(ber.ClassContext, ber.TypePrimitive, MatchingRuleAssertionDNAttributes, f.DNAttributes, MatchingRuleAssertionMap[MatchingRuleAssertionDNAttributes]))
+	}
+	return packet
+}
+
+// String returns the RFC 4515 string representation
+func (f *ExtensibleMatchFilter) String() string {
+	var b strings.Builder
+	b.WriteByte('(')
+	b.WriteString(EscapeFilter(f.Attribute))
+	if f.DNAttributes {
+		b.WriteString(":dn")
+	}
+	if f.MatchingRule != "" {
+		b.WriteByte(':')
+		b.WriteString(EscapeFilter(f.MatchingRule))
+	}
+	b.WriteString(":=")
+	b.WriteString(EscapeFilter(f.Value))
+	b.WriteByte(')')
+	return b.String()
+}
@@ -0,0 +1,131 @@
+package ldap
+
+import (
+	"bytes"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter_RoundTrip(t *testing.T) {
+	for _, filter := range []string{
+		"(&)",
+		"(|)",
+		"(cn=test)",
+		"(cn=*)",
+		"(cn=abc*)",
+		"(cn=*abc)",
+		"(cn=a*b*c)",
+		"(cn=*a*b*)",
+		"(uidNumber>=1000)",
+		"(uidNumber<=1000)",
+		"(sn~=smith)",
+		"(!(cn=test))",
+		"(&(objectClass=person)(|(cn=a)(sn=b))(!(mail=*)))",
+		"(cn:caseExactMatch:=Fred)",
+		"(cn:dn:2.4.6.8.10:=Dino)",
+		"(:dn:2.4.6.8.10:=Dino)",
+		"(o:dn:=Ace Industry)",
+		`(cn=\28parens\29 \2a star \5c backslash)`,
+		`(cn=caf\c3\a9)`,
+		`(objectGUID=\00\ff\80)`,
+	} {
+		t.Run(filter, func(t *testing.T) {
+			parsed, err := ParseFilter(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, filter, parsed.String())
+
+			compiled, err := CompileFilter(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, bytes.Equal(compiled.Bytes(), parsed.Encode().Bytes()), "encoding differs from CompileFilter")
+
+			decompiled, err := DecompileFilter(parsed.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, filter, decompiled)
+		})
+	}
+}
+
+func TestParseFilter_Values(t *testing.T) {
+	filter, err := ParseFilter(`(&(cn=a\2ab*c*)(uid:caseExactMatch:=x))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	and, ok := filter.(*AndFilter)
+	if !ok {
+		t.Fatalf("expected *AndFilter, got %T", filter)
+	}
+	assert.Equal(t, &SubstringsFilter{Attribute: "cn", Initial: "a*b", Any: []string{"c"}}, and.Filters[0])
+	assert.Equal(t, &ExtensibleMatchFilter{Attribute: "uid", MatchingRule: "caseExactMatch", Value: "x"}, and.Filters[1])
+}
+
+func TestParseFilter_Errors(t *testing.T) {
+	for _, filter := range []string{"", "cn=a", "(cn=a", "(cn=a))", "(cn=\\zz)", "(cn=**)"} {
+		_, err := ParseFilter(filter)
+		assert.Error(t, err, filter)
+	}
+}
+
+func TestFilterBuilder(t *testing.T) {
+	filter := NewAndFilter(
+		NewEqualityFilter("objectClass", "person"),
+		NewOrFilter(
+			NewSubstringsFilter("cn", "J*", []string{"(x)"}, "Doe"),
+			NewGreaterOrEqualFilter("uidNumber", "1000"),
+			NewLessOrEqualFilter("uidNumber", "2000"),
+			NewApproxFilter("sn", "smyth"),
+		),
+		NewNotFilter(NewPresentFilter("nsAccountLock")),
+		NewExtensibleMatchFilter("1.2.840.113556.1.4.803", "userAccountControl", "2", false),
+	)
+	expected := `(&(objectClass=person)(|(cn=J\2a*\28x\29*Doe)(uidNumber>=1000)(uidNumber<=2000)(sn~=smyth))(!(nsAccountLock=*))(userAccountControl:1.2.840.113556.1.4.803:=2))`
+	assert.Equal(t, expected, filter.String())
+
+	parsed, err := ParseFilter(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Filter(filter), parsed)
+}
+
+func TestDecodeFilter_Invalid(t *testing.T) {
+	_, err := DecodeFilter(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "cn", ""))
+	assert.Error(t, err)
+
+	_, err = DecodeFilter(ber.Encode(ber.ClassContext, ber.TypeConstructed, FilterNot, nil, ""))
+	assert.Error(t, err)
+
+	_, err = DecodeFilter(ber.Encode(ber.ClassContext, ber.TypeConstructed, FilterEqualityMatch, nil, ""))
+	assert.Error(t, err)
+
+	substrings := NewSubstringsFilter("cn", "a", nil, "b").Encode()
+	seq := substrings.Children[1]
+	seq.Children[0], seq.Children[1] = seq.Children[1], seq.Children[0]
+	_, err = DecodeFilter(substrings)
+	assert.Error(t, err)
+}
+
+func TestSearchRequest_FilterTree(t *testing.T) {
+	byString := NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false,
+		"(&(objectClass=person)(cn=a\\2ab))", nil, nil)
+	byTree := NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false,
+		"", nil, nil)
+	byTree.FilterTree = NewAndFilter(NewEqualityFilter("objectClass", "person"), NewEqualityFilter("cn", "a*b"))
+
+	a := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	b := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	if err := byString.appendTo(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := byTree.appendTo(b); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, a.Bytes(), b.Bytes())
+}
@@ -0,0 +1,588 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// FilterResult is the result of evaluating a filter as described in
+// https://www.rfc-editor.org/rfc/rfc4511#section-4.5.1.7
+type FilterResult int
+
+// Filter results
+const (
+	FilterFalse     FilterResult = 0
+	FilterTrue      FilterResult = 1
+	FilterUndefined FilterResult = 2
+)
+
+// FilterResultMap contains human readable descriptions of the filter results
+var FilterResultMap = map[FilterResult]string{
+	FilterFalse:     "FALSE",
+	FilterTrue:      "TRUE",
+	FilterUndefined: "Undefined",
+}
+
+// MatchingRule compares values when evaluating filters on the client
+type MatchingRule interface {
+	// Normalize returns the normalized form of a value. An error means the
+	// value is not valid for the rule, which makes the assertion Undefined.
+	Normalize(value string) (string, error)
+	// Compare compares two normalized values, returning 0 if they match,
+	// a negative number if a orders before b and a positive number otherwise
+	Compare(a, b string) int
+}
+
+// Built-in matching rules as defined in https://www.rfc-editor.org/rfc/rfc4517#section-4.2
+var (
+	// CaseIgnoreMatch compares strings case-insensitively, ignoring insignificant spaces
+	CaseIgnoreMatch MatchingRule = caseIgnoreRule{}
+	// CaseExactMatch compares strings case-sensitively, ignoring insignificant spaces
+	CaseExactMatch MatchingRule = caseExactRule{}
+	// IntegerMatch compares integers numerically
+	IntegerMatch MatchingRule = integerRule{}
+	// NumericStringMatch compares numeric strings, ignoring spaces
+	NumericStringMatch MatchingRule = numericStringRule{}
+	// OctetStringMatch compares values byte by byte
+	OctetStringMatch MatchingRule = octetStringRule{}
+	// BooleanMatch compares TRUE and FALSE values
+	BooleanMatch MatchingRule = booleanRule{}
+	// DistinguishedNameMatch compares distinguished names, ignoring case
+	DistinguishedNameMatch MatchingRule = dnRule{}
+	// GeneralizedTimeMatch compares generalized time values chronologically
+	GeneralizedTimeMatch MatchingRule = generalizedTimeRule{}
+)
+
+// DefaultMatchingRules maps the names and OIDs of the built-in matching rules
+// to their implementation. Keys are lowercase.
+var DefaultMatchingRules = map[string]MatchingRule{
+	"caseignorematch":              CaseIgnoreMatch,
+	"2.5.13.2":                     CaseIgnoreMatch,
+	"caseignoreorderingmatch":      CaseIgnoreMatch,
+	"2.5.13.3":                     CaseIgnoreMatch,
+	"caseignoresubstringsmatch":    CaseIgnoreMatch,
+	"2.5.13.4":                     CaseIgnoreMatch,
+	"caseignoreia5match":           CaseIgnoreMatch,
+	"1.3.6.1.4.1.1466.109.114.2":   CaseIgnoreMatch,
+	"caseignoreia5substringsmatch": CaseIgnoreMatch,
+	"1.3.6.1.4.1.1466.109.114.3":   CaseIgnoreMatch,
+	"objectidentifiermatch":        CaseIgnoreMatch,
+	"2.5.13.0":                     CaseIgnoreMatch,
+	"caseexactmatch":               CaseExactMatch,
+	"2.5.13.5":                     CaseExactMatch,
+	"caseexactorderingmatch":       CaseExactMatch,
+	"2.5.13.6":                     CaseExactMatch,
+	"caseexactsubstringsmatch":     CaseExactMatch,
+	"2.5.13.7":                     CaseExactMatch,
+	"caseexactia5match":            CaseExactMatch,
+	"1.3.6.1.4.1.1466.109.114.1":   CaseExactMatch,
+	"numericstringmatch":           NumericStringMatch,
+	"2.5.13.8":                     NumericStringMatch,
+	"numericstringorderingmatch":   NumericStringMatch,
+	"2.5.13.9":                     NumericStringMatch,
+	"numericstringsubstringsmatch": NumericStringMatch,
+	"2.5.13.10":                    NumericStringMatch,
+	"booleanmatch":                 BooleanMatch,
+	"2.5.13.13":                    BooleanMatch,
+	"integermatch":                 IntegerMatch,
+	"2.5.13.14":                    IntegerMatch,
+	"integerorderingmatch":         IntegerMatch,
+	"2.5.13.15":                    IntegerMatch,
+	"octetstringmatch":             OctetStringMatch,
+	"2.5.13.17":                    OctetStringMatch,
+	"octetstringorderingmatch":     OctetStringMatch,
+	"2.5.13.18":                    OctetStringMatch,
+	"distinguishednamematch":       DistinguishedNameMatch,
+	"2.5.13.1":                     DistinguishedNameMatch,
+	"generalizedtimematch":         GeneralizedTimeMatch,
+	"2.5.13.27":                    GeneralizedTimeMatch,
+	"generalizedtimeorderingmatch": GeneralizedTimeMatch,
+	"2.5.13.28":                    GeneralizedTimeMatch,
+}
+
+// FilterEvaluator evaluates filters against entries held by the client, for
+// example entries received with Syncrepl or read from a cache
+type FilterEvaluator struct {
+	// DefaultRule is used for attributes without a known matching rule.
+	// CaseIgnoreMatch is used if nil.
+	DefaultRule MatchingRule
+	// AttributeRules maps attribute types to matching rules, overriding the
+	// schema and the default rule. Keys are compared case-insensitively.
+	AttributeRules map[string]MatchingRule
+	// MatchingRules maps matching rule names and OIDs to their implementation,
+	// used for the rules of the schema and extensible match filters. Keys must
+	// be lowercase. DefaultMatchingRules is used if nil.
+	MatchingRules map[string]MatchingRule
+	// Schema, if set, provides the EQUALITY, ORDERING and SUBSTR rules of the
+	// attribute types and their subtypes. Assertions on attribute types
+	// unknown to the schema evaluate to Undefined, present filters to FALSE.
+	Schema *Schema
+}
+
+// NewFilterEvaluator returns a FilterEvaluator using the built-in matching
+// rules and the given schema, which may be nil
+func NewFilterEvaluator(schema *Schema) *FilterEvaluator {
+	return &FilterEvaluator{Schema: schema}
+}
+
+// MatchFilter returns true if the entry matches the filter, using the
+// case-insensitive default matching of a FilterEvaluator without schema
+func MatchFilter(filter Filter, entry *Entry) bool {
+	return (&FilterEvaluator{}).Evaluate(filter, entry) == FilterTrue
+}
+
+// Match returns true if the entry matches the filter
+func (e *FilterEvaluator) Match(filter Filter, entry *Entry) bool {
+	return e.Evaluate(filter, entry) == FilterTrue
+}
+
+// MatchPacket returns true if the entry matches the compiled filter
+func (e *FilterEvaluator) MatchPacket(packet *ber.Packet, entry *Entry) (bool, error) {
+	filter, err := DecodeFilter(packet)
+	if err != nil {
+		return false, err
+	}
+	return e.Match(filter, entry), nil
+}
+
+// MatchString returns true if the entry matches the string representation of the filter
+func (e *FilterEvaluator) MatchString(filter string, entry *Entry) (bool, error) {
+	parsed, err := ParseFilter(filter)
+	if err != nil {
+		return false, err
+	}
+	return e.Match(parsed, entry), nil
+}
+
+// Evaluate evaluates the filter against the entry using three-valued logic
+func (e *FilterEvaluator) Evaluate(filter Filter, entry *Entry) FilterResult {
+	switch f := filter.(type) {
+	case *AndFilter:
+		result := FilterTrue
+		for _, child := range f.Filters {
+			switch e.Evaluate(child, entry) {
+			case FilterFalse:
+				return FilterFalse
+			case FilterUndefined:
+				result = FilterUndefined
+			}
+		}
+		return result
+	case *OrFilter:
+		result := FilterFalse
+		for _, child := range f.Filters {
+			switch e.Evaluate(child, entry) {
+			case FilterTrue:
+				return FilterTrue
+			case FilterUndefined:
+				result = FilterUndefined
+			}
+		}
+		return result
+	case *NotFilter:
+		switch e.Evaluate(f.Filter, entry) {
+		case FilterTrue:
+			return FilterFalse
+		case FilterFalse:
+			return FilterTrue
+		}
+		return FilterUndefined
+	case *PresentFilter:
+		// an attribute type unknown to the schema is not present in the entry,
+		// see RFC 4511 section 4.5.1.7.5
+		values, _ := e.values(entry, f.Attribute)
+		return filterResult(len(values) > 0)
+	case *EqualityFilter:
+		return e.compare(entry, f.Attribute, f.Value, ruleEquality, func(cmp int) bool { return cmp == 0 })
+	case *GreaterOrEqualFilter:
+		return e.compare(entry, f.Attribute, f.Value, ruleOrdering, func(cmp int) bool { return cmp >= 0 })
+	case *LessOrEqualFilter:
+		return e.compare(entry, f.Attribute, f.Value, ruleOrdering, func(cmp int) bool { return cmp <= 0 })
+	case *ApproxFilter:
+		return e.approx(entry, f)
+	case *SubstringsFilter:
+		return e.substrings(entry, f)
+	case *ExtensibleMatchFilter:
+		return e.extensibleMatch(entry, f)
+	default:
+		return FilterUndefined
+	}
+}
+
+func filterResult(b bool) FilterResult {
+	if b {
+		return FilterTrue
+	}
+	return FilterFalse
+}
+
+type ruleKind int
+
+const (
+	ruleEquality ruleKind = iota
+	ruleOrdering
+	ruleSubstrings
+)
+
+// rule returns the matching rule of the given kind for the attribute, or nil
+// if the attribute has no such rule in the schema
+func (e *FilterEvaluator) rule(attribute string, kind ruleKind) MatchingRule {
+	attribute = attributeTypeFromDescription(attribute)
+	if rule, ok := e.lookupAttributeRule(attribute); ok {
+		return rule
+	}
+	if e.Schema != nil {
+		at, err := e.Schema.ResolveAttributeType(attribute)
+		if err != nil {
+			return nil
+		}
+		name := at.Equality
+		switch kind {
+		case ruleOrdering:
+			name = at.Ordering
+		case ruleSubstrings:
+			name = at.Substring
+		}
+		if name == "" {
+			return nil
+		}
+		return e.matchingRule(name)
+	}
+	if e.DefaultRule != nil {
+		return e.DefaultRule
+	}
+	return CaseIgnoreMatch
+}
+
+func (e *FilterEvaluator) lookupAttributeRule(attribute string) (MatchingRule, bool) {
+	for name, rule := range e.AttributeRules {
+		if strings.EqualFold(name, attribute) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+func (e *FilterEvaluator) matchingRule(name string) MatchingRule {
+	rules := e.MatchingRules
+	if rules == nil {
+		rules = DefaultMatchingRules
+	}
+	return rules[strings.ToLower(name)]
+}
+
+// values returns the values of the attribute and its subtypes. It returns
+// false if the attribute type is unknown to the schema.
+func (e *FilterEvaluator) values(entry *Entry, attribute string) ([]string, bool) {
+	attrType := attributeTypeFromDescription(attribute)
+	hasOptions := attrType != attribute
+
+	var target *AttributeTypeDefinition
+	if e.Schema != nil {
+		if target = e.Schema.AttributeType(attrType); target == nil {
+			return nil, false
+		}
+	}
+
+	var values []string
+	for _, attr := range entry.Attributes {
+		switch {
+		case hasOptions:
+			if !strings.EqualFold(attr.Name, attribute) {
+				continue
+			}
+		case strings.EqualFold(attributeTypeFromDescription(attr.Name), attrType):
+		case target != nil && e.isSubtype(attributeTypeFromDescription(attr.Name), target):
+		default:
+			continue
+		}
+		values = append(values, attr.Values...)
+	}
+	return values, true
+}
+
+func (e *FilterEvaluator) isSubtype(attribute string, target *AttributeTypeDefinition) bool {
+	at := e.Schema.AttributeType(attribute)
+	if at == nil {
+		return false
+	}
+	if at == target {
+		return true
+	}
+	superiors, err := e.Schema.AttributeTypeSuperiors(at.OID)
+	if err != nil {
+		return false
+	}
+	for _, sup := range superiors {
+		if sup == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *FilterEvaluator) compare(entry *Entry, attribute, assertion string, kind ruleKind, match func(cmp int) bool) FilterResult {
+	values, ok := e.values(entry, attribute)
+	rule := e.rule(attribute, kind)
+	if !ok || rule == nil {
+		return FilterUndefined
+	}
+	normalizedAssertion, err := rule.Normalize(assertion)
+	if err != nil {
+		return FilterUndefined
+	}
+	return matchValues(rule, values, func(value string) bool {
+		return match(rule.Compare(value, normalizedAssertion))
+	})
+}
+
+// matchValues returns TRUE if any normalized value matches, Undefined if
+// none matches and some value could not be normalized and FALSE otherwise
+func matchValues(rule MatchingRule, values []string, match func(value string) bool) FilterResult {
+	result := FilterFalse
+	for _, value := range values {
+		normalized, err := rule.Normalize(value)
+		if err != nil {
+			result = FilterUndefined
+			continue
+		}
+		if match(normalized) {
+			return FilterTrue
+		}
+	}
+	return result
+}
+
+// approx evaluates an approximate match as an equality match which also
+// ignores all spaces and, for string rules, the case of the values
+func (e *FilterEvaluator) approx(entry *Entry, f *ApproxFilter) FilterResult {
+	values, ok := e.values(entry, f.Attribute)
+	rule := e.rule(f.Attribute, ruleEquality)
+	if !ok || rule == nil {
+		return FilterUndefined
+	}
+	if rule == CaseExactMatch {
+		rule = CaseIgnoreMatch
+	}
+	assertion, err := rule.Normalize(f.Value)
+	if err != nil {
+		return FilterUndefined
+	}
+	assertion = strings.ReplaceAll(assertion, " ", "")
+	return matchValues(rule, values, func(value string) bool {
+		return rule.Compare(strings.ReplaceAll(value, " ", ""), assertion) == 0
+	})
+}
+
+func (e *FilterEvaluator) substrings(entry *Entry, f *SubstringsFilter) FilterResult {
+	values, ok := e.values(entry, f.Attribute)
+	rule := e.rule(f.Attribute, ruleSubstrings)
+	if !ok || rule == nil {
+		return FilterUndefined
+	}
+
+	normalize := func(part string) (string, error) {
+		if part == "" {
+			return "", nil
+		}
+		return rule.Normalize(part)
+	}
+	initial, err := normalize(f.Initial)
+	if err != nil {
+		return FilterUndefined
+	}
+	final, err := normalize(f.Final)
+	if err != nil {
+		return FilterUndefined
+	}
+	parts := make([]string, len(f.Any))
+	for i, part := range f.Any {
+		if parts[i], err = normalize(part); err != nil {
+			return FilterUndefined
+		}
+	}
+
+	return matchValues(rule, values, func(value string) bool {
+		if !strings.HasPrefix(value, initial) {
+			return false
+		}
+		value = value[len(initial):]
+		for _, part := range parts {
+			i := strings.Index(value, part)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(part):]
+		}
+		return strings.HasSuffix(value, final)
+	})
+}
+
+func (e *FilterEvaluator) extensibleMatch(entry *Entry, f *ExtensibleMatchFilter) FilterResult {
+	var rule MatchingRule
+	if f.MatchingRule != "" {
+		if rule = e.matchingRule(f.MatchingRule); rule == nil {
+			return FilterUndefined
+		}
+	} else if f.Attribute != "" {
+		if rule = e.rule(f.Attribute, ruleEquality); rule == nil {
+			return FilterUndefined
+		}
+	} else {
+		return FilterUndefined
+	}
+
+	var values []string
+	if f.Attribute != "" {
+		var ok bool
+		if values, ok = e.values(entry, f.Attribute); !ok {
+			return FilterUndefined
+		}
+	} else {
+		for _, attr := range entry.Attributes {
+			values = append(values, attr.Values...)
+		}
+	}
+
+	if f.DNAttributes {
+		if dn, err := ParseDN(entry.DN); err == nil {
+			for _, rdn := range dn.RDNs {
+				for _, ava := range rdn.Attributes {
+					if f.Attribute == "" || strings.EqualFold(ava.Type, attributeTypeFromDescription(f.Attribute)) {
+						values = append(values, ava.Value)
+					}
+				}
+			}
+		}
+	}
+
+	assertion, err := rule.Normalize(f.Value)
+	if err != nil {
+		return FilterUndefined
+	}
+	return matchValues(rule, values, func(value string) bool {
+		return rule.Compare(value, assertion) == 0
+	})
+}
+
+// prepareString removes insignificant spaces as described in https://www.rfc-editor.org/rfc/rfc4518#section-2.6.1
+func prepareString(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+type caseIgnoreRule struct{}
+
+func (caseIgnoreRule) Normalize(value string) (string, error) {
+	return strings.ToLower(prepareString(value)), nil
+}
+
+func (caseIgnoreRule) Compare(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+type caseExactRule struct{}
+
+func (caseExactRule) Normalize(value string) (string, error) {
+	return prepareString(value), nil
+}
+
+func (caseExactRule) Compare(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+type octetStringRule struct{}
+
+func (octetStringRule) Normalize(value string) (string, error) {
+	return value, nil
+}
+
+func (octetStringRule) Compare(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+type numericStringRule struct{}
+
+func (numericStringRule) Normalize(value string) (string, error) {
+	value = strings.ReplaceAll(value, " ", "")
+	if strings.Trim(value, "0123456789") != "" {
+		return "", fmt.Errorf("ldap: invalid numeric string %q", value)
+	}
+	return value, nil
+}
+
+func (numericStringRule) Compare(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+type integerRule struct{}
+
+func (integerRule) Normalize(value string) (string, error) {
+	i, ok := new(big.Int).SetString(strings.TrimSpace(value), 10)
+	if !ok {
+		return "", fmt.Errorf("ldap: invalid integer %q", value)
+	}
+	return i.String(), nil
+}
+
+func (integerRule) Compare(a, b string) int {
+	x, okA := new(big.Int).SetString(a, 10)
+	y, okB := new(big.Int).SetString(b, 10)
+	if !okA || !okB {
+		return strings.Compare(a, b)
+	}
+	return x.Cmp(y)
+}
+
+type booleanRule struct{}
+
+func (booleanRule) Normalize(value string) (string, error) {
+	switch value = strings.ToUpper(strings.TrimSpace(value)); value {
+	case "TRUE", "FALSE":
+		return value, nil
+	}
+	return "", fmt.Errorf("ldap: invalid boolean %q", value)
+}
+
+func (booleanRule) Compare(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+type dnRule struct{}
+
+func (dnRule) Normalize(value string) (string, error) {
+	dn, err := ParseDN(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(dn.String()), nil
+}
+
+func (dnRule) Compare(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+type generalizedTimeRule struct{}
+
+const normalizedGeneralizedTime = "20060102150405.000000000Z"
+
+func (generalizedTimeRule) Normalize(value string) (string, error) {
+	t, err := ber.ParseGeneralizedTime([]byte(value))
+	if err != nil {
+		return "", errors.New("ldap: invalid generalized time " + value)
+	}
+	return t.UTC().Format(normalizedGeneralizedTime), nil
+}
+
+func (generalizedTimeRule) Compare(a, b string) int {
+	x, errA := time.Parse(normalizedGeneralizedTime, a)
+	y, errB := time.Parse(normalizedGeneralizedTime, b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	return x.Compare(y)
+}
@@ -0,0 +1,172 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterEvaluator_Match(t *testing.T) {
+	entry := NewEntry("uid=jdoe,ou=People,dc=corp,dc=com", map[string][]string{
+		"objectClass":        {"top", "person", "inetOrgPerson"},
+		"uid":                {"jdoe"},
+		"cn":                 {"John  Doe"},
+		"cn;lang-de":         {"Johann Doe"},
+		"sn":                 {"Doe"},
+		"mail":               {"John.Doe@Corp.com", "jd@example.org"},
+		"uidNumber":          {"1000"},
+		"userAccountControl": {"512"},
+	})
+
+	tests := []struct {
+		filter string
+		match  bool
+	}{
+		{"(&(objectClass=person)(|(mail=*@corp.com)(uid=a*)))", true},
+		{"(&(objectClass=person)(|(mail=*@other.com)(uid=a*)))", false},
+		{"(&)", true},
+		{"(|)", false},
+		{"(uid=*)", true},
+		{"(telephoneNumber=*)", false},
+		{"(!(telephoneNumber=*))", true},
+		{"(cn=john doe)", true},
+		{"(CN=JOHN DOE)", true},
+		{"(cn=Johann Doe)", true},
+		{"(cn;lang-de=Johann Doe)", true},
+		{"(cn;lang-de=John Doe)", false},
+		{"(cn=j*n*d*)", true},
+		{"(cn=*ohn d*)", true},
+		{"(cn=*doe*x)", false},
+		{"(sn>=D)", true},
+		{"(sn<=D)", false},
+		{"(sn~=D O E)", true},
+		{"(uidNumber>=999)", false},
+		{"(uid:caseExactMatch:=jdoe)", true},
+		{"(uid:caseExactMatch:=JDOE)", false},
+		{"(uidNumber:integerOrderingMatch:=01000)", true},
+		{"(ou:dn:=people)", true},
+		{"(ou:=people)", false},
+		{"(:dn:caseIgnoreMatch:=corp)", true},
+		{"(uid:unknownMatch:=jdoe)", false},
+		{"(!(uid:unknownMatch:=jdoe))", false},
+	}
+	evaluator := NewFilterEvaluator(nil)
+	for _, test := range tests {
+		match, err := evaluator.MatchString(test.filter, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, test.match, match, test.filter)
+	}
+
+	// Above, "1000" and "999" were compared as strings; integerMatch compares numerically
+	evaluator.AttributeRules = map[string]MatchingRule{"UIDNUMBER": IntegerMatch}
+	match, _ := evaluator.MatchString("(uidNumber<=999)", entry)
+	assert.False(t, match)
+	assert.Equal(t, FilterUndefined, evaluator.Evaluate(NewEqualityFilter("uidNumber", "abc"), entry))
+}
+
+func TestFilterEvaluator_Schema(t *testing.T) {
+	schema := ParseSchema(NewEntry("cn=Subschema", map[string][]string{
+		SchemaAttributeTypes: {
+			"( 2.5.4.41 NAME 'name' EQUALITY caseIgnoreMatch SUBSTR caseIgnoreSubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 )",
+			"( 2.5.4.3 NAME 'cn' SUP name )",
+			"( 2.5.4.4 NAME 'sn' SUP name )",
+			"( 1.3.6.1.1.1.1.0 NAME 'uidNumber' EQUALITY integerMatch ORDERING integerOrderingMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.27 )",
+			"( 0.9.2342.19200300.100.1.1 NAME 'uid' EQUALITY caseExactMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 )",
+		},
+	}))
+	entry := NewEntry("cn=a", map[string][]string{
+		"cn":        {"Alice"},
+		"sn":        {"Smith"},
+		"uid":       {"Alice"},
+		"uidNumber": {"1000"},
+	})
+	evaluator := NewFilterEvaluator(schema)
+
+	tests := []struct {
+		filter string
+		result FilterResult
+	}{
+		{"(name=smith)", FilterTrue},
+		{"(name=ali*)", FilterTrue},
+		{"(uid=alice)", FilterFalse},
+		{"(uid=Alice)", FilterTrue},
+		{"(uidNumber<=999)", FilterFalse},
+		{"(uidNumber>=0999)", FilterTrue},
+		{"(uid>=A)", FilterUndefined},
+		{"(unknown=*)", FilterFalse},
+		{"(!(unknown=*))", FilterTrue},
+		{"(unknown=x)", FilterUndefined},
+		{"(|(unknown=x)(cn=alice))", FilterTrue},
+		{"(&(unknown=x)(cn=alice))", FilterUndefined},
+		{"(&(unknown=x)(cn=bob))", FilterFalse},
+	}
+	for _, test := range tests {
+		filter, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, FilterResultMap[test.result], FilterResultMap[evaluator.Evaluate(filter, entry)], test.filter)
+	}
+}
+
+func TestMatchingRules(t *testing.T) {
+	tests := []struct {
+		rule  MatchingRule
+		a, b  string
+		cmp   int
+		valid bool
+	}{
+		{CaseIgnoreMatch, " Hello   World ", "hello world", 0, true},
+		{CaseExactMatch, "Hello  World", "Hello World", 0, true},
+		{CaseExactMatch, "Hello", "hello", -1, true},
+		{IntegerMatch, "-5", "3", -1, true},
+		{IntegerMatch, "0010", "10", 0, true},
+		{IntegerMatch, "12345678901234567890", "9", 1, true},
+		{IntegerMatch, "x", "1", 0, false},
+		{NumericStringMatch, "1 234", "1234", 0, true},
+		{NumericStringMatch, "12a", "12", 0, false},
+		{OctetStringMatch, "a", "A", 1, true},
+		{BooleanMatch, "true", "TRUE", 0, true},
+		{BooleanMatch, "yes", "TRUE", 0, false},
+		{DistinguishedNameMatch, "CN=Foo, DC=Example", "cn=foo,dc=example", 0, true},
+		{GeneralizedTimeMatch, "20240101120000+0100", "20240101110000Z", 0, true},
+		{GeneralizedTimeMatch, "20240101120000Z", "20240101110000Z", 1, true},
+	}
+	for _, test := range tests {
+		a, err := test.rule.Normalize(test.a)
+		if !test.valid {
+			assert.Error(t, err, test.a)
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := test.rule.Normalize(test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmp := test.rule.Compare(a, b)
+		if cmp > 0 {
+			cmp = 1
+		} else if cmp < 0 {
+			cmp = -1
+		}
+		assert.Equal(t, test.cmp, cmp, "%q %q", test.a, test.b)
+	}
+}
+
+func TestMatchFilter(t *testing.T) {
+	entry := NewEntry("cn=a", map[string][]string{"cn": {"A"}})
+	assert.True(t, MatchFilter(NewEqualityFilter("cn", "a"), entry))
+	assert.False(t, MatchFilter(NewNotFilter(NewEqualityFilter("cn", "a")), entry))
+
+	packet, err := CompileFilter("(cn=a)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	match, err := NewFilterEvaluator(nil).MatchPacket(packet, entry)
+	assert.NoError(t, err)
+	assert.True(t, match)
+}
@@ -0,0 +1,174 @@
+package ldap
+
+import (
+	"sort"
+	"strings"
+)
+
+// NormalizeFilter returns a simplified, canonical copy of the filter:
+//
+//   - attribute descriptions and matching rule names are lowercased
+//   - nested AND and OR filters are flattened into their parent
+//   - duplicate filters are removed from AND and OR filters
+//   - the filters of AND and OR filters are sorted by their string representation
+//   - AND and OR filters with a single filter are replaced by that filter
+//   - double negations are removed
+//
+// Filters which are always true, such as "(&)", "(objectClass=*)" or an OR
+// filter containing a presence filter and its negation, are reduced to
+// "(objectclass=*)". Filters which are always false are reduced to
+// "(!(objectclass=*))". These are used instead of the absolute true and false
+// filters of RFC 4526 as not all servers support those.
+// Assertion values are left unchanged, as comparing them depends on the
+// matching rules of the server.
+//
+// Equal filters have the same string representation after normalization, so
+// it can be used as a cache key.
+func NormalizeFilter(filter Filter) Filter {
+	switch f := filter.(type) {
+	case *AndFilter:
+		return normalizeFilterSet(f.Filters, true)
+	case *OrFilter:
+		return normalizeFilterSet(f.Filters, false)
+	case *NotFilter:
+		child := NormalizeFilter(f.Filter)
+		if not, ok := child.(*NotFilter); ok {
+			return not.Filter
+		}
+		return &NotFilter{Filter: child}
+	case *EqualityFilter:
+		return &EqualityFilter{Attribute: strings.ToLower(f.Attribute), Value: f.Value}
+	case *SubstringsFilter:
+		return &SubstringsFilter{Attribute: strings.ToLower(f.Attribute), Initial: f.Initial, Any: append([]string(nil), f.Any...), Final: f.Final}
+	case *GreaterOrEqualFilter:
+		return &GreaterOrEqualFilter{Attribute: strings.ToLower(f.Attribute), Value: f.Value}
+	case *LessOrEqualFilter:
+		return &LessOrEqualFilter{Attribute: strings.ToLower(f.Attribute), Value: f.Value}
+	case *PresentFilter:
+		return &PresentFilter{Attribute: strings.ToLower(f.Attribute)}
+	case *ApproxFilter:
+		return &ApproxFilter{Attribute: strings.ToLower(f.Attribute), Value: f.Value}
+	case *ExtensibleMatchFilter:
+		return &ExtensibleMatchFilter{
+			MatchingRule: strings.ToLower(f.MatchingRule),
+			Attribute:    strings.ToLower(f.Attribute),
+			Value:        f.Value,
+			DNAttributes: f.DNAttributes,
+		}
+	default:
+		return filter
+	}
+}
+
+// trueFilter returns the normalized filter which is always true
+func trueFilter() Filter {
+	return &PresentFilter{Attribute: strings.ToLower(objectClassAttribute)}
+}
+
+// falseFilter returns the normalized filter which is always false
+func falseFilter() Filter {
+	return &NotFilter{Filter: trueFilter()}
+}
+
+// isTrueFilter reports whether the normalized filter is always true
+func isTrueFilter(filter Filter) bool {
+	present, ok := filter.(*PresentFilter)
+	return ok && present.Attribute == strings.ToLower(objectClassAttribute)
+}
+
+// isFalseFilter reports whether the normalized filter is always false
+func isFalseFilter(filter Filter) bool {
+	not, ok := filter.(*NotFilter)
+	return ok && isTrueFilter(not.Filter)
+}
+
+// normalizeFilterSet normalizes the filters of an AND filter if and is true,
+// or an OR filter otherwise
+func normalizeFilterSet(filters []Filter, and bool) Filter {
+	// neutral filters are dropped from the set, an absorbing filter decides it
+	neutral, absorbing := isTrueFilter, isFalseFilter
+	identity, absorbed := trueFilter, falseFilter
+	if !and {
+		neutral, absorbing = isFalseFilter, isTrueFilter
+		identity, absorbed = falseFilter, trueFilter
+	}
+
+	var flattened []Filter
+	var flatten func(filters []Filter) bool
+	flatten = func(filters []Filter) bool {
+		for _, filter := range filters {
+			filter = NormalizeFilter(filter)
+			switch f := filter.(type) {
+			case *AndFilter:
+				if and {
+					if !flatten(f.Filters) {
+						return false
+					}
+					continue
+				}
+			case *OrFilter:
+				if !and {
+					if !flatten(f.Filters) {
+						return false
+					}
+					continue
+				}
+			}
+			if absorbing(filter) {
+				return false
+			}
+			if !neutral(filter) {
+				flattened = append(flattened, filter)
+			}
+		}
+		return true
+	}
+	if !flatten(filters) {
+		return absorbed()
+	}
+
+	seen := make(map[string]bool, len(flattened))
+	unique := make([]Filter, 0, len(flattened))
+	for _, filter := range flattened {
+		key := filter.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, filter)
+	}
+
+	// exactly one of a presence filter and its negation is true, other filters
+	// may evaluate to undefined
+	for _, filter := range unique {
+		if not, ok := filter.(*NotFilter); ok {
+			if present, ok := not.Filter.(*PresentFilter); ok && seen[present.String()] {
+				return absorbed()
+			}
+		}
+	}
+
+	sort.Slice(unique, func(i, j int) bool {
+		return unique[i].String() < unique[j].String()
+	})
+	switch len(unique) {
+	case 0:
+		return identity()
+	case 1:
+		return unique[0]
+	}
+	if and {
+		return &AndFilter{Filters: unique}
+	}
+	return &OrFilter{Filters: unique}
+}
+
+// CanonicalFilter parses the string representation of a filter and returns
+// the string representation of its normalized form, see NormalizeFilter
+func CanonicalFilter(filter string) (string, error) {
+	parsed, err := ParseFilter(filter)
+	if err != nil {
+		return "", err
+	}
+	return NormalizeFilter(parsed).String(), nil
+}
@@ -0,0 +1,58 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected string
+	}{
+		{"(CN=Foo)", "(cn=Foo)"},
+		{"(&(cn=a))", "(cn=a)"},
+		{"(|(|(sn=b)(cn=a))(cn=a))", "(|(cn=a)(sn=b))"},
+		{"(&(&(uid=x)(&(sn=b)))(|(cn=a)))", "(&(cn=a)(sn=b)(uid=x))"},
+		{"(&(|(cn=a)(sn=b))(|(sn=b)(cn=a)))", "(|(cn=a)(sn=b))"},
+		{"(!(!(cn=a)))", "(cn=a)"},
+		{"(&(objectClass=*)(cn=a))", "(cn=a)"},
+		{"(|(objectClass=*)(cn=a))", "(objectclass=*)"},
+		{"(&)", "(objectclass=*)"},
+		{"(|)", "(!(objectclass=*))"},
+		{"(!(|))", "(objectclass=*)"},
+		{"(&(cn=a)(|))", "(!(objectclass=*))"},
+		{"(|(cn=a)(!(&)))", "(cn=a)"},
+		{"(&(mail=*)(!(MAIL=*))(cn=a))", "(!(objectclass=*))"},
+		{"(|(mail=*)(!(mail=*)))", "(objectclass=*)"},
+		{"(|(cn=a)(!(cn=a)))", "(|(!(cn=a))(cn=a))"},
+		{"(CN:CaseExactMatch:=Fred)", "(cn:caseexactmatch:=Fred)"},
+		{`(&(objectClass=user)(sAMAccountName=J\2a*)(memberOf:1.2.840.113556.1.4.1941:=CN=G,DC=x))`, `(&(memberof:1.2.840.113556.1.4.1941:=CN=G,DC=x)(objectclass=user)(samaccountname=J\2a*))`},
+	}
+	for _, test := range tests {
+		canonical, err := CanonicalFilter(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, test.expected, canonical, test.filter)
+
+		again, err := CanonicalFilter(canonical)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, canonical, again, "normalization must be idempotent")
+	}
+
+	_, err := CanonicalFilter("(cn=a")
+	assert.Error(t, err)
+}
+
+func TestNormalizeFilter_DoesNotModifyInput(t *testing.T) {
+	filter := NewOrFilter(NewEqualityFilter("SN", "b"), NewAndFilter(NewSubstringsFilter("CN", "a", []string{"b"}, "")))
+	before := filter.String()
+	normalized := NormalizeFilter(filter)
+	assert.Equal(t, before, filter.String())
+	assert.Equal(t, "(|(cn=a*b*)(sn=b))", normalized.String())
+	assert.Less(t, len(normalized.Encode().Bytes()), len(filter.Encode().Bytes()))
+}
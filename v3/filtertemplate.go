@@ -0,0 +1,160 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilterTemplate is a search filter with placeholders which are substituted
+// safely, so that the substituted arguments can never change the structure of
+// the filter. The following placeholders are supported:
+//
+//	%s, %v  an assertion value, escaped with EscapeFilter
+//	%d      an integer assertion value
+//	%A      an attribute description, validated against RFC 4512
+//	%%      a literal percent sign
+//
+// Assertion values given as []byte are hex-escaped completely, which is the
+// usual representation of binary values such as objectGUID or objectSid.
+type FilterTemplate struct {
+	format string
+	parts  []templatePart
+	args   int
+}
+
+type templatePart struct {
+	literal string
+	verb    byte
+}
+
+// NewFilterTemplate parses the given template, returning an error if it
+// contains unsupported placeholders
+func NewFilterTemplate(format string) (*FilterTemplate, error) {
+	t := &FilterTemplate{format: format}
+	literal := strings.Builder{}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal.WriteByte(format[i])
+			continue
+		}
+		if i+1 >= len(format) {
+			return nil, NewError(ErrorFilterCompile, fmt.Errorf("ldap: filter template ends with an incomplete placeholder at position %d", i))
+		}
+		i++
+		switch verb := format[i]; verb {
+		case '%':
+			literal.WriteByte('%')
+		case 's', 'v', 'd', 'A':
+			if literal.Len() > 0 {
+				t.parts = append(t.parts, templatePart{literal: literal.String()})
+				literal.Reset()
+			}
+			t.parts = append(t.parts, templatePart{verb: verb})
+			t.args++
+		default:
+			return nil, NewError(ErrorFilterCompile, fmt.Errorf("ldap: unsupported filter template placeholder %%%c at position %d", verb, i-1))
+		}
+	}
+	if literal.Len() > 0 {
+		t.parts = append(t.parts, templatePart{literal: literal.String()})
+	}
+	return t, nil
+}
+
+// String returns the template the FilterTemplate was created from
+func (t *FilterTemplate) String() string {
+	return t.format
+}
+
+// Execute substitutes the given arguments into the template. The resulting
+// filter is verified with CompileFilter before it is returned.
+func (t *FilterTemplate) Execute(args ...interface{}) (string, error) {
+	if len(args) != t.args {
+		return "", NewError(ErrorFilterCompile, fmt.Errorf("ldap: filter template %q expects %d arguments, got %d", t.format, t.args, len(args)))
+	}
+	filter := strings.Builder{}
+	arg := 0
+	for _, part := range t.parts {
+		if part.verb == 0 {
+			filter.WriteString(part.literal)
+			continue
+		}
+		value, err := formatTemplateArgument(part.verb, args[arg])
+		if err != nil {
+			return "", NewError(ErrorFilterCompile, fmt.Errorf("ldap: filter template argument %d: %w", arg+1, err))
+		}
+		filter.WriteString(value)
+		arg++
+	}
+	if _, err := CompileFilter(filter.String()); err != nil {
+		return "", err
+	}
+	return filter.String(), nil
+}
+
+// Filterf formats a search filter according to the template, escaping all
+// arguments as described in FilterTemplate
+func Filterf(format string, args ...interface{}) (string, error) {
+	t, err := NewFilterTemplate(format)
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(args...)
+}
+
+func formatTemplateArgument(verb byte, arg interface{}) (string, error) {
+	switch verb {
+	case 'A':
+		attribute, ok := arg.(string)
+		if !ok {
+			return "", fmt.Errorf("attribute description must be a string, got %T", arg)
+		}
+		if !isAttributeDescription(attribute) {
+			return "", fmt.Errorf("invalid attribute description %q", attribute)
+		}
+		return attribute, nil
+	case 'd':
+		switch arg.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return fmt.Sprintf("%d", arg), nil
+		}
+		return "", fmt.Errorf("%%d expects an integer, got %T", arg)
+	}
+	switch value := arg.(type) {
+	case []byte:
+		return escapeBytes(value), nil
+	case string:
+		return EscapeFilter(value), nil
+	case nil:
+		return "", fmt.Errorf("assertion value must not be nil")
+	}
+	return EscapeFilter(fmt.Sprint(arg)), nil
+}
+
+// escapeBytes hex-escapes every byte of the value
+func escapeBytes(value []byte) string {
+	const hexValues = "0123456789abcdef"
+	buf := make([]byte, len(value)*3)
+	for i, c := range value {
+		buf[i*3] = '\\'
+		buf[i*3+1] = hexValues[c>>4]
+		buf[i*3+2] = hexValues[c&0xf]
+	}
+	return string(buf)
+}
+
+// isAttributeDescription reports whether value is an attribute description
+// as defined in RFC 4512, section 2.5: a descriptor or numeric OID followed
+// by options
+func isAttributeDescription(value string) bool {
+	parts := strings.Split(value, ";")
+	if !isDescriptor(parts[0]) && !isNumericOID(parts[0]) {
+		return false
+	}
+	for _, option := range parts[1:] {
+		if option == "" || strings.Trim(option, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-") != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterf(t *testing.T) {
+	tests := []struct {
+		format   string
+		args     []interface{}
+		expected string
+	}{
+		{"(uid=%s)", []interface{}{"jdoe"}, "(uid=jdoe)"},
+		{"(uid=%s)", []interface{}{"*)(uid=*"}, `(uid=\2a\29\28uid=\2a)`},
+		{"(&(objectClass=user)(cn=%s*))", []interface{}{`a\b`}, `(&(objectClass=user)(cn=a\5cb*))`},
+		{"(objectGUID=%s)", []interface{}{[]byte{0x01, 'a', 0xff}}, `(objectGUID=\01\61\ff)`},
+		{"(%A=%v)", []interface{}{"cn;lang-de", 42}, "(cn;lang-de=42)"},
+		{"(2.5.4.3=%d)", []interface{}{int64(-7)}, "(2.5.4.3=-7)"},
+		{"(%A>=%d)", []interface{}{"1.3.6.1.1.1.1.0", uint16(1000)}, "(1.3.6.1.1.1.1.0>=1000)"},
+		{"(description=100%%)", nil, "(description=100%)"},
+	}
+	for _, test := range tests {
+		filter, err := Filterf(test.format, test.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, test.expected, filter, test.format)
+	}
+}
+
+func TestFilterf_Errors(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []interface{}
+	}{
+		{"(uid=%q)", []interface{}{"a"}},
+		{"(uid=%", nil},
+		{"(uid=%s)", nil},
+		{"(uid=%s)", []interface{}{"a", "b"}},
+		{"(uid=%s)", []interface{}{nil}},
+		{"(uid=%d)", []interface{}{"1"}},
+		{"(%A=a)", []interface{}{"cn=x)(uid"}},
+		{"(%A=a)", []interface{}{"1cn"}},
+		{"(%A=a)", []interface{}{"cn;"}},
+		{"(%A=a)", []interface{}{[]byte("cn")}},
+		{"(uid=%s", []interface{}{"a"}},
+	}
+	for _, test := range tests {
+		_, err := Filterf(test.format, test.args...)
+		assert.Error(t, err, test.format)
+		assert.True(t, IsErrorWithCode(err, ErrorFilterCompile), test.format)
+	}
+}
+
+func TestFilterTemplate(t *testing.T) {
+	template, err := NewFilterTemplate("(&(objectClass=person)(|(uid=%s)(mail=%s)))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "(&(objectClass=person)(|(uid=%s)(mail=%s)))", template.String())
+
+	for _, input := range []string{"jdoe", "*", "x)(objectClass=*", `\2a`, "café"} {
+		filter, err := template.Execute(input, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseFilter(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		or := parsed.(*AndFilter).Filters[1].(*OrFilter)
+		assert.Equal(t, NewEqualityFilter("uid", input), or.Filters[0], input)
+		assert.Equal(t, NewEqualityFilter("mail", input), or.Filters[1], input)
+	}
+}
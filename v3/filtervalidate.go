@@ -0,0 +1,254 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// FilterSyntaxError describes a problem in the string representation of a
+// search filter. CompileFilter wraps the first problem found in an *Error,
+// so it can be retrieved with errors.As.
+type FilterSyntaxError struct {
+	// Offset is the byte offset of the problem in the filter
+	Offset int
+	// Token is the offending text, empty if the filter ended unexpectedly
+	Token string
+	// Expected describes what was expected instead
+	Expected string
+}
+
+func (e *FilterSyntaxError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("ldap: unexpected end of filter at offset %d, expected %s", e.Offset, e.Expected)
+	}
+	return fmt.Sprintf("ldap: unexpected %q at offset %d of filter, expected %s", e.Token, e.Offset, e.Expected)
+}
+
+// ValidateFilter checks the string representation of a filter against the
+// grammar of RFC 4515 and returns all problems found, in order of their
+// offset. Unlike CompileFilter it does not stop at the first problem, and it
+// also reports invalid attribute descriptions, matching rule identifiers and
+// unescaped special characters in assertion values.
+func ValidateFilter(filter string) []*FilterSyntaxError {
+	v := &filterValidator{filter: filter}
+	v.parseFilter()
+	if v.pos < len(v.filter) {
+		v.fail(v.pos, v.filter[v.pos:], "end of filter")
+	}
+	return v.errors
+}
+
+// compileFilterError replaces err with the first problem reported by
+// ValidateFilter, if there is any
+func compileFilterError(filter string, err error) error {
+	if errors := ValidateFilter(filter); len(errors) > 0 {
+		return NewError(ErrorFilterCompile, errors[0])
+	}
+	return err
+}
+
+type filterValidator struct {
+	filter string
+	pos    int
+	errors []*FilterSyntaxError
+}
+
+func (v *filterValidator) fail(offset int, token, expected string) {
+	if token == "" && len(v.errors) > 0 && v.errors[len(v.errors)-1].Token == "" {
+		// the end of the filter is only reported once
+		return
+	}
+	v.errors = append(v.errors, &FilterSyntaxError{Offset: offset, Token: token, Expected: expected})
+}
+
+// token returns the character at offset
+func (v *filterValidator) token(offset int) string {
+	if offset >= len(v.filter) {
+		return ""
+	}
+	_, width := utf8.DecodeRuneInString(v.filter[offset:])
+	return v.filter[offset : offset+width]
+}
+
+// skip advances to the closing parenthesis of the current filter
+func (v *filterValidator) skip() {
+	depth := 0
+	for ; v.pos < len(v.filter); v.pos++ {
+		switch v.filter[v.pos] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
+	}
+}
+
+func (v *filterValidator) expectClose(expected string) {
+	if v.pos < len(v.filter) && v.filter[v.pos] != ')' {
+		v.fail(v.pos, v.token(v.pos), expected)
+		v.skip()
+	}
+	if v.pos >= len(v.filter) {
+		v.fail(v.pos, "", expected)
+		return
+	}
+	v.pos++
+}
+
+func (v *filterValidator) parseFilter() {
+	if v.pos >= len(v.filter) {
+		v.fail(v.pos, "", "'('")
+		return
+	}
+	if v.filter[v.pos] != '(' {
+		v.fail(v.pos, v.token(v.pos), "'('")
+		v.skip()
+		return
+	}
+	v.pos++
+
+	if v.pos >= len(v.filter) {
+		v.fail(v.pos, "", "filter component")
+		return
+	}
+	switch v.filter[v.pos] {
+	case '&', '|':
+		v.pos++
+		for v.pos < len(v.filter) && v.filter[v.pos] == '(' {
+			v.parseFilter()
+		}
+		v.expectClose("'(' or ')'")
+	case '!':
+		v.pos++
+		v.parseFilter()
+		v.expectClose("')'")
+	case '(':
+		// CompileFilter accepts redundant parentheses
+		v.parseFilter()
+		v.expectClose("')'")
+	default:
+		v.parseItem()
+		v.expectClose("')'")
+	}
+}
+
+func (v *filterValidator) parseItem() {
+	start := v.pos
+	for v.pos < len(v.filter) && !strings.ContainsRune("=~<>:()", rune(v.filter[v.pos])) {
+		v.pos++
+	}
+	attribute := v.filter[start:v.pos]
+
+	const expectedFilterType = "'=', '~=', '>=', '<=' or ':='"
+	if v.pos >= len(v.filter) {
+		v.fail(v.pos, "", expectedFilterType)
+		return
+	}
+	switch c := v.filter[v.pos]; c {
+	case '(', ')':
+		v.fail(v.pos, v.token(v.pos), expectedFilterType)
+		v.skip()
+		return
+	case '=':
+		v.checkAttribute(start, attribute)
+		v.pos++
+		v.parseValue(true)
+	case '~', '>', '<':
+		if v.pos+1 >= len(v.filter) || v.filter[v.pos+1] != '=' {
+			v.fail(v.pos, v.token(v.pos), expectedFilterType)
+			v.skip()
+			return
+		}
+		v.checkAttribute(start, attribute)
+		v.pos += 2
+		v.parseValue(false)
+	case ':':
+		v.parseExtensible(start, attribute)
+	}
+}
+
+func (v *filterValidator) checkAttribute(offset int, attribute string) {
+	if attribute == "" {
+		v.fail(offset, v.token(offset), "attribute description")
+	} else if !isAttributeDescription(attribute) {
+		v.fail(offset, attribute, "attribute description")
+	}
+}
+
+// parseExtensible validates the remainder of an extensible match filter,
+// starting at the colon following the attribute description
+func (v *filterValidator) parseExtensible(start int, attribute string) {
+	if attribute != "" {
+		v.checkAttribute(start, attribute)
+	}
+	if strings.HasPrefix(v.filter[v.pos:], ":dn:") {
+		v.pos += 3
+	}
+	matchingRule := ""
+	if !strings.HasPrefix(v.filter[v.pos:], ":=") {
+		v.pos++
+		ruleStart := v.pos
+		for v.pos < len(v.filter) && !strings.ContainsRune(":=()", rune(v.filter[v.pos])) {
+			v.pos++
+		}
+		matchingRule = v.filter[ruleStart:v.pos]
+		if matchingRule == "" || !isDescriptor(matchingRule) && !isNumericOID(matchingRule) {
+			v.fail(ruleStart, matchingRule, "matching rule descriptor or OID")
+		}
+		if !strings.HasPrefix(v.filter[v.pos:], ":=") {
+			v.fail(v.pos, v.token(v.pos), "':='")
+			v.skip()
+			return
+		}
+	}
+	if attribute == "" && matchingRule == "" {
+		v.fail(start, ":=", "attribute description or matching rule")
+	}
+	v.pos += 2
+	v.parseValue(false)
+}
+
+// parseValue validates an assertion value up to the closing parenthesis,
+// allowing unescaped asterisks only if substrings is true
+func (v *filterValidator) parseValue(substrings bool) {
+	previous := -1
+	for v.pos < len(v.filter) && v.filter[v.pos] != ')' {
+		r, width := utf8.DecodeRuneInString(v.filter[v.pos:])
+		switch {
+		case r == utf8.RuneError && width <= 1:
+			v.fail(v.pos, v.filter[v.pos:v.pos+1], "UTF-8 encoded value")
+		case r == '(':
+			v.fail(v.pos, "(", `escaped value \28`)
+		case r == '*' && !substrings:
+			v.fail(v.pos, "*", `escaped value \2a`)
+		case r == '*' && previous == v.pos-1:
+			v.fail(previous, "**", "value between wildcards")
+		case r == '\\':
+			end := v.pos + 1
+			for end < len(v.filter) && end < v.pos+3 && isHexDigit(v.filter[end]) {
+				end++
+			}
+			if end != v.pos+3 {
+				token := v.filter[v.pos:end]
+				if end < len(v.filter) && v.filter[end] != ')' {
+					token += v.token(end)
+				}
+				v.fail(v.pos, token, "two hexadecimal digits after '\\'")
+			}
+			v.pos = end
+			continue
+		}
+		if r == '*' {
+			previous = v.pos
+		}
+		v.pos += width
+	}
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
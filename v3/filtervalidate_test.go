@@ -0,0 +1,75 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFilter(t *testing.T) {
+	type problem struct {
+		offset   int
+		token    string
+		expected string
+	}
+	tests := []struct {
+		filter   string
+		problems []problem
+	}{
+		{"(&(objectClass=person)(|(cn=a*b*)(sn~=x)))", nil},
+		{"(&)", nil},
+		{"(cn=)", nil},
+		{`(cn=\28\2A)`, nil},
+		{"((cn=a))", nil},
+		{"(cn:1.2.3.4:=a)", nil},
+		{"(:dn:caseExactMatch:=a)", nil},
+		{"", []problem{{0, "", "'('"}}},
+		{"cn=a", []problem{{0, "c", "'('"}}},
+		{"(cn=a", []problem{{5, "", "')'"}}},
+		{"(&(cn=a)", []problem{{8, "", "'(' or ')'"}}},
+		{"(cn=a))", []problem{{6, ")", "end of filter"}}},
+		{"(cn)", []problem{{3, ")", "'=', '~=', '>=', '<=' or ':='"}}},
+		{"(cn>a)", []problem{{3, ">", "'=', '~=', '>=', '<=' or ':='"}}},
+		{"(=a)", []problem{{1, "=", "attribute description"}}},
+		{"(c n=a)", []problem{{1, "c n", "attribute description"}}},
+		{"(cn>=a*)", []problem{{6, "*", `escaped value \2a`}}},
+		{"(cn=a**b)", []problem{{5, "**", "value between wildcards"}}},
+		{`(cn=\zz)`, []problem{{4, `\z`, "two hexadecimal digits after '\\'"}}},
+		{`(cn=\a)`, []problem{{4, `\a`, "two hexadecimal digits after '\\'"}}},
+		{"(cn:=a*)", []problem{{6, "*", `escaped value \2a`}}},
+		{"(cn:x y:=a)", []problem{{4, "x y", "matching rule descriptor or OID"}}},
+		{"(cn:rule=a)", []problem{{8, "=", "':='"}}},
+		{"(:=a)", []problem{{1, ":=", "attribute description or matching rule"}}},
+		{
+			"(&(c n=a(b)(sn>=*)(uid=\\g))",
+			[]problem{
+				{3, "c n", "attribute description"},
+				{8, "(", `escaped value \28`},
+				{16, "*", `escaped value \2a`},
+				{23, `\g`, "two hexadecimal digits after '\\'"},
+			},
+		},
+	}
+	for _, test := range tests {
+		var problems []problem
+		for _, err := range ValidateFilter(test.filter) {
+			problems = append(problems, problem{err.Offset, err.Token, err.Expected})
+		}
+		assert.Equal(t, test.problems, problems, test.filter)
+	}
+}
+
+func TestCompileFilter_SyntaxError(t *testing.T) {
+	_, err := CompileFilter("(&(cn=a)(sn=b)")
+	var syntaxErr *FilterSyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected a *FilterSyntaxError, got %v", err)
+	}
+	assert.Equal(t, 14, syntaxErr.Offset)
+	assert.True(t, IsErrorWithCode(err, ErrorFilterCompile))
+	assert.Equal(t, `LDAP Result Code 201 "Filter Compile Error": ldap: unexpected end of filter at offset 14, expected '(' or ')'`, err.Error())
+
+	_, err = CompileFilter("(cn=a)x")
+	assert.EqualError(t, err, `LDAP Result Code 201 "Filter Compile Error": ldap: unexpected "x" at offset 6 of filter, expected end of filter`)
+}
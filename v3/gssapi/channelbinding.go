@@ -0,0 +1,28 @@
+package gssapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+
+	"github.com/go-ldap/ldap/v3/internal/channelbinding"
+)
+
+// tlsServerEndPointBinding returns the application data of the
+// tls-server-end-point channel binding for the server certificate.
+// https://www.rfc-editor.org/rfc/rfc5929.html#section-4
+func tlsServerEndPointBinding(cert *x509.Certificate) ([]byte, error) {
+	certHash, err := channelbinding.TLSServerEndPointHash(cert)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("tls-server-end-point:"), certHash...), nil
+}
+
+// peerCertificate returns the certificate of the server of a TLS connection
+func peerCertificate(state tls.ConnectionState) (*x509.Certificate, error) {
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.New("no server certificate in TLS connection state")
+	}
+	return state.PeerCertificates[0], nil
+}
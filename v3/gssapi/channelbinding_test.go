@@ -0,0 +1,113 @@
+package gssapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+
+	"github.com/go-ldap/ldap/v3/internal/channelbinding"
+)
+
+// createTestCertificate creates a test certificate with the specified signature algorithm.
+func createTestCertificate(sigAlg x509.SignatureAlgorithm) (*x509.Certificate, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	template := x509.Certificate{
+		SignatureAlgorithm: sigAlg,
+		SerialNumber:       big.NewInt(1),
+		Subject: pkix.Name{
+			Organization:  []string{"Test Company"},
+			Country:       []string{"US"},
+			Province:      []string{""},
+			Locality:      []string{"San Francisco"},
+			StreetAddress: []string{""},
+			PostalCode:    []string{""},
+		},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		SubjectKeyId: []byte{1, 2, 3, 4, 6},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+func TestClientSetChannelBinding(t *testing.T) {
+	cert, err := createTestCertificate(x509.SHA256WithRSA)
+	if err != nil {
+		t.Fatalf("Failed to create test certificate: %v", err)
+	}
+	certHash := sha256.Sum256(cert.Raw)
+
+	c := &Client{}
+	if err := c.SetChannelBindingFromConnectionState(tls.ConnectionState{}); err == nil {
+		t.Error("Expected an error without server certificate")
+	}
+	if err := c.SetChannelBindingFromConnectionState(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := append([]byte("tls-server-end-point:"), certHash[:]...); !bytes.Equal(c.channelBindings, expected) {
+		t.Errorf("Expected channel bindings %q, got %q", expected, c.channelBindings)
+	}
+}
+
+func TestClientChannelBoundAPReq(t *testing.T) {
+	c := &Client{
+		Client:          client.NewWithPassword("user", "EXAMPLE.COM", "password", config.New()),
+		channelBindings: []byte("tls-server-end-point:hash"),
+	}
+	ekey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: bytes.Repeat([]byte{1}, 32)}
+	tkt := messages.Ticket{
+		Realm: "EXAMPLE.COM",
+		SName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "ldap/host"),
+	}
+
+	apReq, err := c.newChannelBoundAPReq(tkt, ekey, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagMutual}, []int{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apReq.DecryptAuthenticator(ekey); err != nil {
+		t.Fatal(err)
+	}
+
+	checksum := apReq.Authenticator.Cksum.Checksum
+	if len(checksum) != 24 || binary.LittleEndian.Uint32(checksum) != 16 {
+		t.Fatalf("Unexpected authenticator checksum %x", checksum)
+	}
+	if expected := channelbinding.BindingsHash(c.channelBindings); !bytes.Equal(checksum[4:20], expected) {
+		t.Errorf("Unexpected channel bindings hash %x", checksum[4:20])
+	}
+	if flags := binary.LittleEndian.Uint32(checksum[20:]); flags != uint32(gssapi.ContextFlagInteg|gssapi.ContextFlagMutual) {
+		t.Errorf("Unexpected flags %#x", flags)
+	}
+}
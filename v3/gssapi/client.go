@@ -2,10 +2,15 @@ package gssapi
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/jcmturner/gokrb5/v8/client"
 	"github.com/jcmturner/gokrb5/v8/config"
@@ -16,10 +21,14 @@ import (
 	"github.com/jcmturner/gokrb5/v8/spnego"
 
 	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
 	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/messages"
 
 	"github.com/jcmturner/gokrb5/v8/credentials"
+
+	"github.com/go-ldap/ldap/v3/internal/channelbinding"
 )
 
 // Client implements ldap.GSSAPIClient interface.
@@ -28,12 +37,25 @@ type Client struct {
 
 	ekey   types.EncryptionKey
 	Subkey types.EncryptionKey
+
+	// sequence numbers of the next wrap tokens sent and received
+	sendSeqNum uint64
+	recvSeqNum uint64
+
+	// application data of the channel bindings, if any
+	channelBindings []byte
+
+	// credential cache reloaded when modified, e.g. by kinit or k5start
+	ccachePath    string
+	ccacheModTime time.Time
+	settings      []func(*client.Settings)
 }
 
 // NewClientWithKeytab creates a new client from a keytab credential.
-// Set the realm to empty string to use the default realm from config.
+// Set the realm to empty string to use the default realm from config and the
+// krb5confPath to empty string to use DefaultConfigPath.
 func NewClientWithKeytab(username, realm, keytabPath, krb5confPath string, settings ...func(*client.Settings)) (*Client, error) {
-	krb5conf, err := config.Load(krb5confPath)
+	krb5conf, err := loadConfig(krb5confPath)
 	if err != nil {
 		return nil, err
 	}
@@ -46,14 +68,16 @@ func NewClientWithKeytab(username, realm, keytabPath, krb5confPath string, setti
 	client := client.NewWithKeytab(username, realm, keytab, krb5conf, settings...)
 
 	return &Client{
-		Client: client,
+		Client:   client,
+		settings: settings,
 	}, nil
 }
 
 // NewClientWithPassword creates a new client from a password credential.
-// Set the realm to empty string to use the default realm from config.
+// Set the realm to empty string to use the default realm from config and the
+// krb5confPath to empty string to use DefaultConfigPath.
 func NewClientWithPassword(username, realm, password string, krb5confPath string, settings ...func(*client.Settings)) (*Client, error) {
-	krb5conf, err := config.Load(krb5confPath)
+	krb5conf, err := loadConfig(krb5confPath)
 	if err != nil {
 		return nil, err
 	}
@@ -61,32 +85,85 @@ func NewClientWithPassword(username, realm, password string, krb5confPath string
 	client := client.NewWithPassword(username, realm, password, krb5conf, settings...)
 
 	return &Client{
-		Client: client,
+		Client:   client,
+		settings: settings,
 	}, nil
 }
 
 // NewClientFromCCache creates a new client from a populated client cache.
+// The cache is reloaded whenever the file is modified, so tickets renewed by
+// an external tool like kinit or k5start are picked up.
+// Set the ccachePath to empty string to use DefaultCCachePath and the
+// krb5confPath to empty string to use DefaultConfigPath.
 func NewClientFromCCache(ccachePath, krb5confPath string, settings ...func(*client.Settings)) (*Client, error) {
-	krb5conf, err := config.Load(krb5confPath)
+	krb5conf, err := loadConfig(krb5confPath)
 	if err != nil {
 		return nil, err
 	}
 
-	ccache, err := credentials.LoadCCache(ccachePath)
+	if ccachePath == "" {
+		ccachePath, err = DefaultCCachePath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	info, err := os.Stat(ccachePath)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := client.NewFromCCache(ccache, krb5conf, settings...)
+	client, err := loadCCache(ccachePath, krb5conf, settings)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Client{
-		Client: client,
+		Client:        client,
+		ccachePath:    ccachePath,
+		ccacheModTime: info.ModTime(),
+		settings:      settings,
 	}, nil
 }
 
+func loadCCache(ccachePath string, krb5conf *config.Config, settings []func(*client.Settings)) (*client.Client, error) {
+	ccache, err := credentials.LoadCCache(ccachePath)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewFromCCache(ccache, krb5conf, settings...)
+}
+
+func loadConfig(krb5confPath string) (*config.Config, error) {
+	if krb5confPath == "" {
+		krb5confPath = DefaultConfigPath()
+	}
+	return config.Load(krb5confPath)
+}
+
+// SetChannelBinding binds the security context to the TLS connection with
+// the given server certificate using the tls-server-end-point channel
+// binding, as required by servers enforcing LDAP channel binding.
+// See RFC 5929 section 4.
+func (client *Client) SetChannelBinding(cert *x509.Certificate) error {
+	channelBindings, err := tlsServerEndPointBinding(cert)
+	if err != nil {
+		return err
+	}
+	client.channelBindings = channelBindings
+	return nil
+}
+
+// SetChannelBindingFromConnectionState binds the security context to the TLS
+// connection with the given state, e.g. as returned by
+// ldap.Conn.TLSConnectionState.
+func (client *Client) SetChannelBindingFromConnectionState(state tls.ConnectionState) error {
+	cert, err := peerCertificate(state)
+	if err != nil {
+		return err
+	}
+	return client.SetChannelBinding(cert)
+}
+
 // Close deletes any established secure context and closes the client.
 func (client *Client) Close() error {
 	client.Client.Destroy()
@@ -97,6 +174,8 @@ func (client *Client) Close() error {
 func (client *Client) DeleteSecContext() error {
 	client.ekey = types.EncryptionKey{}
 	client.Subkey = types.EncryptionKey{}
+	client.sendSeqNum = 0
+	client.recvSeqNum = 0
 	return nil
 }
 
@@ -115,7 +194,7 @@ func (client *Client) InitSecContextWithOptions(target string, input []byte, APO
 
 	switch input {
 	case nil:
-		tkt, ekey, err := client.Client.GetServiceTicket(target)
+		tkt, ekey, err := client.serviceTicket(target)
 		if err != nil {
 			return nil, false, err
 		}
@@ -125,6 +204,18 @@ func (client *Client) InitSecContextWithOptions(target string, input []byte, APO
 		if err != nil {
 			return nil, false, err
 		}
+		if len(client.channelBindings) > 0 {
+			token.APReq, err = client.newChannelBoundAPReq(tkt, ekey, gssapiFlags, APOptions)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+
+		// wrap tokens continue the sequence number of the authenticator
+		if err := token.APReq.DecryptAuthenticator(ekey); err != nil {
+			return nil, false, err
+		}
+		client.sendSeqNum = uint64(token.APReq.Authenticator.SeqNumber)
 
 		output, err := token.Marshal()
 		if err != nil {
@@ -157,6 +248,7 @@ func (client *Client) InitSecContextWithOptions(target string, input []byte, APO
 				return nil, false, err
 			}
 			client.Subkey = part.Subkey
+			client.recvSeqNum = uint64(part.SequenceNumber)
 		}
 
 		if token.IsKRBError() {
@@ -167,6 +259,87 @@ func (client *Client) InitSecContextWithOptions(target string, input []byte, APO
 	}
 }
 
+// serviceTicket returns a service ticket for the target. gokrb5 renews the
+// TGT before it expires and logs in again once the renewal limit is reached.
+// If the KDC rejects the TGT as expired or revoked nonetheless, clients
+// holding a keytab or password log in again and retry once. Clients created
+// from a credential cache first reload it if it was modified.
+func (client *Client) serviceTicket(target string) (messages.Ticket, types.EncryptionKey, error) {
+	client.reloadCCache()
+
+	tkt, ekey, err := client.Client.GetServiceTicket(target)
+	if err == nil || !tgtRejected(err) || !(client.Credentials.HasKeytab() || client.Credentials.HasPassword()) {
+		return tkt, ekey, err
+	}
+	if loginErr := client.Client.Login(); loginErr != nil {
+		return tkt, ekey, err
+	}
+	return client.Client.GetServiceTicket(target)
+}
+
+// tgtRejected reports whether the KDC rejected the TGT as expired or revoked.
+// gokrb5 wraps the KRB-ERROR of the KDC in an error keeping only its text, so
+// the error code is matched by name.
+func tgtRejected(err error) bool {
+	var krbErr messages.KRBError
+	if errors.As(err, &krbErr) {
+		return krbErr.ErrorCode == errorcode.KRB_AP_ERR_TKT_EXPIRED || krbErr.ErrorCode == errorcode.KDC_ERR_TGT_REVOKED
+	}
+	message := err.Error()
+	return strings.Contains(message, "KRB_AP_ERR_TKT_EXPIRED") || strings.Contains(message, "KDC_ERR_TGT_REVOKED")
+}
+
+// reloadCCache replaces the underlying client if the credential cache it was
+// created from has been modified. Errors keep the current client in use.
+func (client *Client) reloadCCache() {
+	if client.ccachePath == "" {
+		return
+	}
+	info, err := os.Stat(client.ccachePath)
+	if err != nil || info.ModTime().Equal(client.ccacheModTime) {
+		return
+	}
+	cl, err := loadCCache(client.ccachePath, client.Client.Config, client.settings)
+	if err != nil {
+		return
+	}
+	client.Client.Destroy()
+	client.Client = cl
+	client.ccacheModTime = info.ModTime()
+}
+
+// newChannelBoundAPReq returns an AP-REQ whose authenticator checksum
+// contains the hash of the channel bindings.
+// See RFC 4121 section 4.1.1.
+func (client *Client) newChannelBoundAPReq(tkt messages.Ticket, ekey types.EncryptionKey, gssapiFlags []int, APOptions []int) (messages.APReq, error) {
+	auth, err := types.NewAuthenticator(client.Credentials.Domain(), client.Credentials.CName())
+	if err != nil {
+		return messages.APReq{}, err
+	}
+
+	checksum := make([]byte, 24)
+	binary.LittleEndian.PutUint32(checksum[:4], 16)
+	copy(checksum[4:20], channelbinding.BindingsHash(client.channelBindings))
+	var flags uint32
+	for _, flag := range gssapiFlags {
+		flags |= uint32(flag)
+	}
+	binary.LittleEndian.PutUint32(checksum[20:24], flags)
+	auth.Cksum = types.Checksum{
+		CksumType: chksumtype.GSSAPI,
+		Checksum:  checksum,
+	}
+
+	apReq, err := messages.NewAPReq(tkt, ekey, auth)
+	if err != nil {
+		return messages.APReq{}, err
+	}
+	for _, option := range APOptions {
+		types.SetFlag(&apReq.APOptions, option)
+	}
+	return apReq, nil
+}
+
 // NegotiateSaslAuth performs the last step of the SASL handshake.
 // See RFC 4752 section 3.1.
 func (client *Client) NegotiateSaslAuth(input []byte, authzid string) ([]byte, error) {
@@ -2,9 +2,17 @@ package gssapi
 
 import (
 	"encoding/binary"
+	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
 )
 
 // wrapTokenHeader builds a valid 16-byte acceptor WrapToken header with the
@@ -52,3 +60,63 @@ func TestUnmarshalWrapTokenSplit(t *testing.T) {
 		t.Errorf("payload: got %q, want %q", wt.Payload, payload)
 	}
 }
+
+// serveTestKDC answers every request with a KRB-ERROR with the given code and
+// counts the requests
+func serveTestKDC(t *testing.T, code int32) (*config.Config, *atomic.Int32) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	krbErr := messages.NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", code, "")
+	response, err := krbErr.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := new(atomic.Int32)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			_, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			requests.Add(1)
+			_, _ = conn.WriteTo(response, addr)
+		}
+	}()
+
+	krb5conf, err := config.NewFromString(strings.Replace(testKrb5Conf, "127.0.0.1:88", conn.LocalAddr().String(), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return krb5conf, requests
+}
+
+func TestClientServiceTicketLogin(t *testing.T) {
+	for _, tc := range []struct {
+		code     int32
+		requests int32
+	}{
+		// a rejected TGT leads to a new login
+		{errorcode.KRB_AP_ERR_TKT_EXPIRED, 2},
+		{errorcode.KDC_ERR_TGT_REVOKED, 2},
+		// other errors are returned immediately
+		{errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, 1},
+	} {
+		krb5conf, requests := serveTestKDC(t, tc.code)
+		client, err := NewClientWithPasswordConfig("testuser1", "TEST.GOKRB5", "passwordvalue", krb5conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := client.serviceTicket("ldap/host.test.gokrb5"); err == nil {
+			t.Errorf("%s: expected an error", errorcode.Lookup(tc.code))
+		}
+		if n := requests.Load(); n != tc.requests {
+			t.Errorf("%s: expected %d requests to the KDC, got %d", errorcode.Lookup(tc.code), tc.requests, n)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package gssapi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+// DefaultConfigPath returns the path of the krb5.conf file used when none is
+// given: the first entry of KRB5_CONFIG, or /etc/krb5.conf.
+func DefaultConfigPath() string {
+	if paths := filepath.SplitList(os.Getenv("KRB5_CONFIG")); len(paths) > 0 && paths[0] != "" {
+		return paths[0]
+	}
+	return "/etc/krb5.conf"
+}
+
+// DefaultCCachePath returns the path of the credential cache used when none
+// is given: the file named by KRB5CCNAME, or /tmp/krb5cc_<uid>. Only caches
+// of type FILE are supported.
+func DefaultCCachePath() (string, error) {
+	name := os.Getenv("KRB5CCNAME")
+	if name == "" {
+		return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid()), nil
+	}
+	if cacheType, path, found := strings.Cut(name, ":"); found && len(cacheType) > 1 {
+		if cacheType != "FILE" {
+			return "", fmt.Errorf("unsupported credential cache type %q", cacheType)
+		}
+		return path, nil
+	}
+	return name, nil
+}
+
+// NewClientWithKeytabData creates a new client from the contents of a keytab
+// file. Use config.NewFromString to parse a krb5.conf held in memory.
+// Set the realm to empty string to use the default realm from config.
+func NewClientWithKeytabData(username, realm string, keytabData []byte, krb5conf *config.Config, settings ...func(*client.Settings)) (*Client, error) {
+	if krb5conf == nil {
+		return nil, errors.New("missing krb5.conf")
+	}
+
+	kt := keytab.New()
+	if err := kt.Unmarshal(keytabData); err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		Client:   client.NewWithKeytab(username, realm, kt, krb5conf, settings...),
+		settings: settings,
+	}, nil
+}
+
+// NewClientWithPasswordConfig creates a new client from a password credential
+// and a parsed krb5.conf.
+// Set the realm to empty string to use the default realm from config.
+func NewClientWithPasswordConfig(username, realm, password string, krb5conf *config.Config, settings ...func(*client.Settings)) (*Client, error) {
+	if krb5conf == nil {
+		return nil, errors.New("missing krb5.conf")
+	}
+
+	return &Client{
+		Client:   client.NewWithPassword(username, realm, password, krb5conf, settings...),
+		settings: settings,
+	}, nil
+}
+
+// NewClientFromCCacheData creates a new client from the contents of a
+// populated credential cache file.
+func NewClientFromCCacheData(ccacheData []byte, krb5conf *config.Config, settings ...func(*client.Settings)) (*Client, error) {
+	if krb5conf == nil {
+		return nil, errors.New("missing krb5.conf")
+	}
+
+	ccache := new(credentials.CCache)
+	if err := ccache.Unmarshal(ccacheData); err != nil {
+		return nil, err
+	}
+
+	cl, err := client.NewFromCCache(ccache, krb5conf, settings...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		Client:   cl,
+		settings: settings,
+	}, nil
+}
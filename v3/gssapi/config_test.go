@@ -0,0 +1,150 @@
+package gssapi
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+)
+
+const testKrb5Conf = `[libdefaults]
+  default_realm = TEST.GOKRB5
+
+[realms]
+  TEST.GOKRB5 = {
+    kdc = 127.0.0.1:88
+  }
+`
+
+func TestDefaultConfigPath(t *testing.T) {
+	t.Setenv("KRB5_CONFIG", "")
+	if path := DefaultConfigPath(); path != "/etc/krb5.conf" {
+		t.Errorf("got %q", path)
+	}
+	t.Setenv("KRB5_CONFIG", "/etc/krb5/service.conf"+string(os.PathListSeparator)+"/etc/krb5.conf")
+	if path := DefaultConfigPath(); path != "/etc/krb5/service.conf" {
+		t.Errorf("got %q", path)
+	}
+}
+
+func TestDefaultCCachePath(t *testing.T) {
+	for _, tc := range []struct {
+		env      string
+		expected string
+		err      bool
+	}{
+		{"/tmp/krb5cc_service", "/tmp/krb5cc_service", false},
+		{"FILE:/tmp/krb5cc_service", "/tmp/krb5cc_service", false},
+		{"KEYRING:persistent:1000", "", true},
+	} {
+		t.Setenv("KRB5CCNAME", tc.env)
+		path, err := DefaultCCachePath()
+		if (err != nil) != tc.err || path != tc.expected {
+			t.Errorf("%s: got %q, %v", tc.env, path, err)
+		}
+	}
+}
+
+func TestNewClientWithKeytabData(t *testing.T) {
+	krb5conf, err := config.NewFromString(testKrb5Conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keytabData, err := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClientWithKeytabData("testuser1", "", keytabData, krb5conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !client.Credentials.HasKeytab() || client.Config.LibDefaults.DefaultRealm != "TEST.GOKRB5" {
+		t.Errorf("unexpected credentials %+v", client.Credentials)
+	}
+
+	if _, err := NewClientWithKeytabData("testuser1", "", []byte("invalid"), krb5conf); err == nil {
+		t.Error("expected an error for an invalid keytab")
+	}
+	if _, err := NewClientWithKeytabData("testuser1", "", keytabData, nil); err == nil {
+		t.Error("expected an error for a missing krb5.conf")
+	}
+}
+
+func TestNewClientFromCCacheReload(t *testing.T) {
+	krb5conf, err := config.NewFromString(testKrb5Conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ccacheData, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClientFromCCacheData(ccacheData, krb5conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Credentials.UserName() != "testuser1" {
+		t.Errorf("unexpected credentials %+v", client.Credentials)
+	}
+	if _, err := NewClientFromCCacheData(ccacheData, nil); err == nil {
+		t.Error("expected an error for a missing krb5.conf")
+	}
+
+	path := filepath.Join(t.TempDir(), "krb5cc")
+	if err := os.WriteFile(path, ccacheData, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	confPath := filepath.Join(t.TempDir(), "krb5.conf")
+	t.Setenv("KRB5CCNAME", "FILE:"+path)
+	t.Setenv("KRB5_CONFIG", confPath)
+	if _, err := NewClientFromCCache("", ""); err == nil {
+		t.Fatal("expected an error for a missing krb5.conf")
+	}
+	if err := os.WriteFile(confPath, []byte(testKrb5Conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client, err = NewClientFromCCache("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := client.Client
+	client.reloadCCache()
+	if client.Client != current {
+		t.Error("unmodified credential cache was reloaded")
+	}
+
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	client.reloadCCache()
+	if client.Client == current || !client.ccacheModTime.Equal(modTime) {
+		t.Error("modified credential cache was not reloaded")
+	}
+}
+
+func TestNewClientWithPasswordConfig(t *testing.T) {
+	krb5conf, err := config.NewFromString(testKrb5Conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClientWithPasswordConfig("testuser1", "TEST.GOKRB5", "passwordvalue", krb5conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !client.Credentials.HasPassword() || client.Credentials.Realm() != "TEST.GOKRB5" {
+		t.Errorf("unexpected credentials %+v", client.Credentials)
+	}
+
+	if _, err := NewClientWithPasswordConfig("testuser1", "", "passwordvalue", nil); err == nil {
+		t.Error("expected an error for a missing krb5.conf")
+	}
+}
@@ -0,0 +1,54 @@
+package gssapi
+
+import (
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+)
+
+// GetMIC returns a MIC token protecting the integrity of the message, e.g.
+// the mechListMIC of SPNEGO. Each call consumes a sequence number.
+// See RFC 4121 section 4.2.6.1.
+func (client *Client) GetMIC(message []byte) ([]byte, error) {
+	key, flags := client.wrapKey()
+	if _, err := wrapTokenEType(key); err != nil {
+		return nil, err
+	}
+	token := &gssapi.MICToken{
+		Flags:     flags,
+		SndSeqNum: client.sendSeqNum,
+		Payload:   message,
+	}
+	if err := token.SetChecksum(key, keyusage.GSSAPI_INITIATOR_SIGN); err != nil {
+		return nil, err
+	}
+	output, err := token.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	client.sendSeqNum++
+	return output, nil
+}
+
+// VerifyMIC verifies a MIC token of the server for the message.
+// See RFC 4121 section 4.2.6.1.
+func (client *Client) VerifyMIC(message, token []byte) error {
+	mic := &gssapi.MICToken{}
+	if err := mic.Unmarshal(token, true); err != nil {
+		return err
+	}
+	key := client.ekey
+	if mic.Flags&wrapFlagAcceptorSubkey != 0 {
+		key = client.Subkey
+	}
+	mic.Payload = message
+	if _, err := mic.Verify(key, keyusage.GSSAPI_ACCEPTOR_SIGN); err != nil {
+		return err
+	}
+	if mic.SndSeqNum < client.recvSeqNum {
+		return fmt.Errorf("MIC token sequence number %d was already used", mic.SndSeqNum)
+	}
+	client.recvSeqNum = mic.SndSeqNum + 1
+	return nil
+}
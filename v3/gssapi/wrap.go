@@ -0,0 +1,240 @@
+package gssapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Flags of a wrap token, see RFC 4121 section 4.2.2.
+const (
+	wrapFlagSentByAcceptor = 0x01
+	wrapFlagSealed         = 0x02
+	wrapFlagAcceptorSubkey = 0x04
+)
+
+// SASL security layers of the GSSAPI mechanism, see RFC 4752 section 3.3.
+const (
+	securityLayerNone            = 0x01
+	securityLayerConfidentiality = 0x04
+)
+
+// NegotiateSaslAuthWithSecurityLayer performs the last step of the SASL
+// handshake like NegotiateSaslAuth, but selects the given security layer,
+// which has to be offered by the server, and the maximum size of the buffers
+// the client accepts. It returns the maximum number of bytes which may be
+// passed to Wrap at once.
+// See RFC 4752 section 3.1.
+func (client *Client) NegotiateSaslAuthWithSecurityLayer(input []byte, authzid string, securityLayer byte, maxReceiveSize uint32) ([]byte, int, error) {
+	payload, err := client.Unwrap(input)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(payload) != 4 {
+		return nil, 0, fmt.Errorf("server send bad final token for SASL GSSAPI Handshake")
+	}
+	if payload[0]&securityLayer == 0 {
+		return nil, 0, fmt.Errorf("server does not offer the security layer %#x, offered are %#x", securityLayer, payload[0])
+	}
+
+	maxWrapSize := 0
+	if securityLayer != securityLayerNone {
+		key, _ := client.wrapKey()
+		overhead, err := wrapTokenOverhead(key, securityLayer == securityLayerConfidentiality)
+		if err != nil {
+			return nil, 0, err
+		}
+		maxWrapSize = int(binary.BigEndian.Uint32(payload)&0xffffff) - overhead
+		if maxWrapSize <= 0 {
+			return nil, 0, errors.New("server maximum buffer size is too small for the security layer")
+		}
+		maxReceiveSize &= 0xffffff
+	} else {
+		maxReceiveSize = 0
+	}
+
+	response := make([]byte, 4, 4+len(authzid))
+	binary.BigEndian.PutUint32(response, maxReceiveSize)
+	response[0] = securityLayer
+	response = append(response, authzid...)
+
+	output, err := client.Wrap(response, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	return output, maxWrapSize, nil
+}
+
+// Wrap protects the data sent to the server with a wrap token, encrypting it
+// if confidential is true. Each call consumes a sequence number.
+// See RFC 4121 section 4.2.6.2.
+func (client *Client) Wrap(data []byte, confidential bool) ([]byte, error) {
+	key, flags := client.wrapKey()
+	if confidential {
+		flags |= wrapFlagSealed
+	}
+	token, err := newWrapToken(key, flags, client.sendSeqNum, data, keyusage.GSSAPI_INITIATOR_SEAL)
+	if err != nil {
+		return nil, err
+	}
+	client.sendSeqNum++
+	return token, nil
+}
+
+// Unwrap verifies a wrap token of the server and returns its payload. Tokens
+// with a sequence number below the one expected next are rejected as replays.
+// See RFC 4121 section 4.2.6.2.
+func (client *Client) Unwrap(token []byte) ([]byte, error) {
+	if len(token) < gssapi.HdrLen {
+		return nil, errors.New("bytes shorter than header length")
+	}
+	key := client.ekey
+	if token[2]&wrapFlagAcceptorSubkey != 0 {
+		key = client.Subkey
+	}
+	payload, seqNum, err := parseWrapToken(key, token, keyusage.GSSAPI_ACCEPTOR_SEAL)
+	if err != nil {
+		return nil, err
+	}
+	if seqNum < client.recvSeqNum {
+		return nil, fmt.Errorf("wrap token sequence number %d was already used", seqNum)
+	}
+	client.recvSeqNum = seqNum + 1
+	return payload, nil
+}
+
+// wrapKey returns the key protecting wrap tokens and the flags signalling it,
+// preferring the subkey of the acceptor
+func (client *Client) wrapKey() (types.EncryptionKey, byte) {
+	if len(client.Subkey.KeyValue) > 0 {
+		return client.Subkey, wrapFlagAcceptorSubkey
+	}
+	return client.ekey, 0
+}
+
+// wrapTokenOverhead returns the number of bytes a wrap token adds to its
+// payload
+func wrapTokenOverhead(key types.EncryptionKey, sealed bool) (int, error) {
+	encType, err := wrapTokenEType(key)
+	if err != nil {
+		return 0, err
+	}
+	overhead := gssapi.HdrLen + encType.GetHMACBitLength()/8
+	if sealed {
+		overhead += encType.GetConfounderByteSize() + gssapi.HdrLen
+	}
+	return overhead, nil
+}
+
+// wrapTokenEType returns the encryption type of the key, which has to be one
+// of the types RFC 4121 wrap tokens are defined for
+func wrapTokenEType(key types.EncryptionKey) (etype.EType, error) {
+	switch key.KeyType {
+	case etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96,
+		etypeID.AES128_CTS_HMAC_SHA256_128, etypeID.AES256_CTS_HMAC_SHA384_192:
+		return crypto.GetEtype(key.KeyType)
+	}
+	return nil, fmt.Errorf("security layers are not supported with encryption type %d", key.KeyType)
+}
+
+// newWrapToken returns a wrap token protecting the payload with the given
+// flags and sequence number. Sealed tokens are encrypted without filler, the
+// payload of other tokens is followed by its checksum.
+func newWrapToken(key types.EncryptionKey, flags byte, seqNum uint64, payload []byte, usage uint32) ([]byte, error) {
+	encType, err := wrapTokenEType(key)
+	if err != nil {
+		return nil, err
+	}
+	if flags&wrapFlagSealed == 0 {
+		token := &gssapi.WrapToken{
+			Flags:     flags,
+			EC:        uint16(encType.GetHMACBitLength() / 8),
+			SndSeqNum: seqNum,
+			Payload:   payload,
+		}
+		if err := token.SetCheckSum(key, usage); err != nil {
+			return nil, err
+		}
+		return token.Marshal()
+	}
+
+	header := make([]byte, gssapi.HdrLen)
+	copy(header, getGssWrapTokenId()[:])
+	header[2] = flags
+	header[3] = gssapi.FillerByte
+	binary.BigEndian.PutUint64(header[8:], seqNum)
+
+	plaintext := make([]byte, 0, len(payload)+len(header))
+	plaintext = append(append(plaintext, payload...), header...)
+	_, encrypted, err := encType.EncryptMessage(key.KeyValue, plaintext, usage)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, encrypted...), nil
+}
+
+// parseWrapToken verifies a wrap token and returns its payload and sequence
+// number, undoing the rotation of the data by RRC bytes
+func parseWrapToken(key types.EncryptionKey, token []byte, usage uint32) ([]byte, uint64, error) {
+	if len(token) < gssapi.HdrLen {
+		return nil, 0, errors.New("bytes shorter than header length")
+	}
+	if !bytes.Equal(getGssWrapTokenId()[:], token[0:2]) || token[3] != gssapi.FillerByte {
+		return nil, 0, errors.New("invalid wrap token header")
+	}
+	flags := token[2]
+	if (flags&wrapFlagSentByAcceptor != 0) != (usage == keyusage.GSSAPI_ACCEPTOR_SEAL) {
+		return nil, 0, errors.New("unexpected acceptor flag of wrap token")
+	}
+	ec := int(binary.BigEndian.Uint16(token[4:6]))
+	seqNum := binary.BigEndian.Uint64(token[8:16])
+
+	data := token[gssapi.HdrLen:]
+	if len(data) > 0 {
+		rrc := int(binary.BigEndian.Uint16(token[6:8])) % len(data)
+		data = append(append(make([]byte, 0, len(data)), data[rrc:]...), data[:rrc]...)
+	}
+
+	if flags&wrapFlagSealed == 0 {
+		if ec > len(data) {
+			return nil, 0, fmt.Errorf("inconsistent checksum length: %d bytes to parse, checksum length is %d", len(data), ec)
+		}
+		wt := &gssapi.WrapToken{
+			Flags:     flags,
+			EC:        uint16(ec),
+			SndSeqNum: seqNum,
+			Payload:   data[:len(data)-ec],
+			CheckSum:  data[len(data)-ec:],
+		}
+		if _, err := wt.Verify(key, usage); err != nil {
+			return nil, 0, err
+		}
+		return wt.Payload, seqNum, nil
+	}
+
+	encType, err := wrapTokenEType(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	plaintext, err := encType.DecryptMessage(key.KeyValue, data, usage)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(plaintext) < ec+gssapi.HdrLen {
+		return nil, 0, errors.New("sealed wrap token is too short")
+	}
+	// the encrypted copy of the header has to match except for the RRC
+	header := plaintext[len(plaintext)-gssapi.HdrLen:]
+	if !bytes.Equal(header[:6], token[:6]) || !bytes.Equal(header[8:], token[8:gssapi.HdrLen]) {
+		return nil, 0, errors.New("encrypted header of wrap token does not match")
+	}
+	return plaintext[:len(plaintext)-gssapi.HdrLen-ec], seqNum, nil
+}
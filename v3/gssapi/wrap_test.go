@@ -0,0 +1,115 @@
+package gssapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+func newTestWrapClient() *Client {
+	return &Client{
+		ekey:       types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: bytes.Repeat([]byte{1}, 32)},
+		Subkey:     types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: bytes.Repeat([]byte{2}, 32)},
+		sendSeqNum: 100,
+		recvSeqNum: 200,
+	}
+}
+
+// acceptorWrapToken returns a wrap token of the server with the data rotated
+// by rrc bytes
+func acceptorWrapToken(t *testing.T, client *Client, seqNum uint64, payload []byte, sealed bool, rrc int) []byte {
+	flags := byte(wrapFlagSentByAcceptor | wrapFlagAcceptorSubkey)
+	if sealed {
+		flags |= wrapFlagSealed
+	}
+	token, err := newWrapToken(client.Subkey, flags, seqNum, payload, keyusage.GSSAPI_ACCEPTOR_SEAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := token[16:]
+	rotated := append(append([]byte{}, data[len(data)-rrc:]...), data[:len(data)-rrc]...)
+	binary.BigEndian.PutUint16(token[6:8], uint16(rrc))
+	return append(token[:16], rotated...)
+}
+
+func TestClientWrap(t *testing.T) {
+	for _, confidential := range []bool{false, true} {
+		client := newTestWrapClient()
+		token, err := client.Wrap([]byte("message"), confidential)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if confidential && bytes.Contains(token, []byte("message")) {
+			t.Error("sealed token contains the plaintext")
+		}
+		payload, seqNum, err := parseWrapToken(client.Subkey, token, keyusage.GSSAPI_INITIATOR_SEAL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(payload) != "message" || seqNum != 100 || client.sendSeqNum != 101 {
+			t.Errorf("got payload %q with sequence number %d", payload, seqNum)
+		}
+	}
+}
+
+func TestClientUnwrap(t *testing.T) {
+	client := newTestWrapClient()
+	for i, tc := range []struct {
+		sealed bool
+		rrc    int
+	}{
+		{false, 0},
+		{false, 12},
+		{true, 0},
+		{true, 28},
+	} {
+		token := acceptorWrapToken(t, client, uint64(200+i), []byte("message"), tc.sealed, tc.rrc)
+		payload, err := client.Unwrap(token)
+		if err != nil {
+			t.Fatalf("sealed %v, rrc %d: %v", tc.sealed, tc.rrc, err)
+		}
+		if string(payload) != "message" {
+			t.Errorf("sealed %v, rrc %d: got payload %q", tc.sealed, tc.rrc, payload)
+		}
+
+		if _, err := client.Unwrap(token); err == nil {
+			t.Error("expected replayed token to be rejected")
+		}
+	}
+
+	token := acceptorWrapToken(t, client, 300, []byte("message"), true, 0)
+	token[len(token)-1] ^= 1
+	if _, err := client.Unwrap(token); err == nil {
+		t.Error("expected modified token to be rejected")
+	}
+}
+
+func TestClientNegotiateSaslAuthWithSecurityLayer(t *testing.T) {
+	client := newTestWrapClient()
+	// the server offers all security layers and a buffer size of 65535 bytes
+	token := acceptorWrapToken(t, client, 200, []byte{0x07, 0x00, 0xff, 0xff}, false, 0)
+	output, maxWrapSize, err := client.NegotiateSaslAuthWithSecurityLayer(token, "u:admin", securityLayerConfidentiality, 1<<24-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxWrapSize != 65535-16-12-16-16 {
+		t.Errorf("unexpected maximum wrap size %d", maxWrapSize)
+	}
+	payload, _, err := parseWrapToken(client.Subkey, output, keyusage.GSSAPI_INITIATOR_SEAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\x04\xff\xff\xffu:admin"; string(payload) != expected {
+		t.Errorf("got %q, expected %q", payload, expected)
+	}
+
+	// the server only offers no security layer
+	token = acceptorWrapToken(t, client, 201, []byte{0x01, 0x00, 0x00, 0x00}, false, 0)
+	if _, _, err := client.NegotiateSaslAuthWithSecurityLayer(token, "", securityLayerConfidentiality, 1<<24-1); err == nil {
+		t.Error("expected an error for a security layer not offered")
+	}
+}
@@ -0,0 +1,45 @@
+// Package channelbinding computes the channel binding data shared by the
+// SASL mechanisms of the ldap package and the gssapi package.
+package channelbinding
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+)
+
+// TLSServerEndPointHash returns the hash of the certificate used by the
+// tls-server-end-point channel binding. The hash function of the signature
+// algorithm of the certificate is used, SHA-256 instead of MD5 and SHA-1.
+// See https://www.rfc-editor.org/rfc/rfc5929#section-4.1
+func TLSServerEndPointHash(cert *x509.Certificate) ([]byte, error) {
+	var hash crypto.Hash
+	switch cert.SignatureAlgorithm {
+	case x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.ECDSAWithSHA256, x509.DSAWithSHA256,
+		x509.MD5WithRSA, x509.SHA1WithRSA, x509.ECDSAWithSHA1, x509.DSAWithSHA1:
+		hash = crypto.SHA256
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+		hash = crypto.SHA384
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512:
+		hash = crypto.SHA512
+	default:
+		return nil, fmt.Errorf("no tls-server-end-point hash for signature algorithm %s", cert.SignatureAlgorithm)
+	}
+	h := hash.New()
+	h.Write(cert.Raw)
+	return h.Sum(nil), nil
+}
+
+// BindingsHash returns the MD5 hash of the gss_channel_bindings_struct with
+// the given application data and without addresses, as sent by Kerberos in
+// the authenticator checksum and by NTLM in the MsvAvChannelBindings pair.
+// See RFC 4121 section 4.1.1.2.
+func BindingsHash(applicationData []byte) []byte {
+	// initiator and acceptor address types and lengths are all 0
+	buf := make([]byte, 20, 20+len(applicationData))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(len(applicationData)))
+	sum := md5.Sum(append(buf, applicationData...))
+	return sum[:]
+}
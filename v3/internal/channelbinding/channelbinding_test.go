@@ -0,0 +1,47 @@
+package channelbinding
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSServerEndPointHash(t *testing.T) {
+	raw := []byte("certificate")
+	sha256Hash := sha256.Sum256(raw)
+	sha384Hash := sha512.Sum384(raw)
+	sha512Hash := sha512.Sum512(raw)
+	for _, tt := range []struct {
+		algorithm x509.SignatureAlgorithm
+		expected  []byte
+	}{
+		{x509.SHA1WithRSA, sha256Hash[:]},
+		{x509.ECDSAWithSHA256, sha256Hash[:]},
+		{x509.SHA384WithRSAPSS, sha384Hash[:]},
+		{x509.ECDSAWithSHA512, sha512Hash[:]},
+		{x509.PureEd25519, nil},
+	} {
+		hash, err := TLSServerEndPointHash(&x509.Certificate{Raw: raw, SignatureAlgorithm: tt.algorithm})
+		if tt.expected == nil {
+			assert.Error(t, err, tt.algorithm.String())
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tt.expected, hash, tt.algorithm.String())
+	}
+}
+
+func TestBindingsHash(t *testing.T) {
+	for applicationData, expected := range map[string]string{
+		"":                          "441018525208457705bf09a8ee3c1093",
+		"tls-server-end-point:hash": "ebd7d15f01284b358388c3231531a4f4",
+	} {
+		assert.Equal(t, expected, hex.EncodeToString(BindingsHash([]byte(applicationData))), applicationData)
+	}
+}
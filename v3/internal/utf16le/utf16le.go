@@ -0,0 +1,18 @@
+// Package utf16le encodes strings as UTF-16 in little-endian byte order, as
+// used by NTLM and the unicodePwd attribute of Active Directory.
+package utf16le
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// Encode returns the UTF-16LE encoding of s
+func Encode(s string) []byte {
+	codes := utf16.Encode([]rune(s))
+	output := make([]byte, 0, 2*len(codes))
+	for _, c := range codes {
+		output = binary.LittleEndian.AppendUint16(output, c)
+	}
+	return output
+}
@@ -0,0 +1,14 @@
+package utf16le
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	assert.Empty(t, Encode(""))
+	assert.Equal(t, []byte{'"', 0, 'a', 0, 0xe9, 0, '"', 0}, Encode("\"aé\""))
+	// characters outside the BMP are encoded as surrogate pairs
+	assert.Equal(t, []byte{0x3d, 0xd8, 0x00, 0xde}, Encode("\U0001f600"))
+}
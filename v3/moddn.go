@@ -78,6 +78,11 @@ func (req *ModifyDNRequest) appendTo(envelope *ber.Packet) error {
 // ModifyDN renames the given DN and optionally move to another base (when the "newSup" argument
 // to NewModifyDNRequest() is not "").
 func (l *Conn) ModifyDN(m *ModifyDNRequest) error {
+	if controls, removed := l.negotiateControls("modify DN", m.DN, m.Controls); len(removed) > 0 {
+		req := *m
+		req.Controls = controls
+		m = &req
+	}
 	msgCtx, err := l.doRequest(m)
 	if err != nil {
 		return err
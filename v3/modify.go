@@ -108,8 +108,14 @@ func NewModifyRequest(dn string, controls []Control) *ModifyRequest {
 	}
 }
 
-// Modify performs the ModifyRequest
+// Modify performs the ModifyRequest. A modification rejected by the password
+// policy returns a PasswordPolicyError.
 func (l *Conn) Modify(modifyRequest *ModifyRequest) error {
+	if controls, removed := l.negotiateControls("modify", modifyRequest.DN, modifyRequest.Controls); len(removed) > 0 {
+		req := *modifyRequest
+		req.Controls = controls
+		modifyRequest = &req
+	}
 	msgCtx, err := l.doRequest(modifyRequest)
 	if err != nil {
 		return err
@@ -127,7 +133,7 @@ func (l *Conn) Modify(modifyRequest *ModifyRequest) error {
 	if packet.Children[1].Tag == ApplicationModifyResponse {
 		err := GetLDAPError(packet)
 		if err != nil {
-			return err
+			return passwordPolicyError(err, nil)
 		}
 	} else {
 		return fmt.Errorf("ldap: unexpected response: %d", packet.Children[1].Tag)
@@ -144,8 +150,19 @@ type ModifyResult struct {
 	Referral string
 }
 
+// PasswordPolicyWarning returns the warning of the password policy response
+// controls, or nil if there is none
+func (r *ModifyResult) PasswordPolicyWarning() *PasswordPolicyWarning {
+	return passwordPolicyWarning(r.Controls)
+}
+
 // ModifyWithResult performs the ModifyRequest and returns the result
 func (l *Conn) ModifyWithResult(modifyRequest *ModifyRequest) (*ModifyResult, error) {
+	if controls, removed := l.negotiateControls("modify", modifyRequest.DN, modifyRequest.Controls); len(removed) > 0 {
+		req := *modifyRequest
+		req.Controls = controls
+		modifyRequest = &req
+	}
 	msgCtx, err := l.doRequest(modifyRequest)
 	if err != nil {
 		return nil, err
@@ -169,9 +186,11 @@ func (l *Conn) ModifyWithResult(modifyRequest *ModifyRequest) (*ModifyResult, er
 	switch packet.Children[1].Tag {
 	case ApplicationModifyResponse:
 		if err = GetLDAPError(packet); err != nil {
+			// controls which can not be decoded are skipped to return the error
+			result.Controls = append(result.Controls, errorControls(packet)...)
 			result.Referral = getReferral(err, packet)
 
-			return result, err
+			return result, passwordPolicyError(err, result.Controls)
 		}
 		if len(packet.Children) == 3 {
 			for _, child := range packet.Children[2].Children {
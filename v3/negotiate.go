@@ -0,0 +1,207 @@
+package ldap
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ControlNegotiationAction describes how an unsupported control was handled
+type ControlNegotiationAction int
+
+// Control negotiation actions
+const (
+	// ControlDropped means the unsupported control was not sent to the server
+	ControlDropped ControlNegotiationAction = 1
+	// ControlEmulated means the unsupported control was not sent to the server
+	// and its effect was applied by the client instead
+	ControlEmulated ControlNegotiationAction = 2
+)
+
+// ControlNegotiationActionMap contains human readable descriptions of the control negotiation actions
+var ControlNegotiationActionMap = map[ControlNegotiationAction]string{
+	ControlDropped:  "Dropped",
+	ControlEmulated: "Emulated",
+}
+
+// ControlNegotiationEvent reports a control which was not sent to the server
+// because the server does not advertise it
+type ControlNegotiationEvent struct {
+	// Operation is the name of the operation, e.g. "search" or "delete"
+	Operation string
+	// DN is the DN the operation applies to
+	DN string
+	// Control is the control which was not sent
+	Control Control
+	// Action tells whether the control was dropped or emulated
+	Action ControlNegotiationAction
+}
+
+type controlNegotiation struct {
+	report func(ControlNegotiationEvent)
+
+	mu        sync.Mutex
+	supported map[string]bool
+	err       error
+}
+
+// EnableControlNegotiation makes the connection consult the supportedControl
+// list of the root DSE before sending requests. The list is read the first
+// time a request with controls is sent. Unsupported controls are then
+// handled as follows:
+//   - ControlServerSideSorting is removed and the results of Search are sorted by the client
+//   - ControlSubtreeDelete is removed and Del deletes the subtree recursively
+//   - ControlPaging is removed and the results are returned in a single page
+//   - other non-critical controls are removed
+//   - other critical controls are sent, and the server rejects the operation
+//
+// report, if not nil, is called for every control which was not sent.
+// Negotiation applies to Search, SearchWithPaging, Add, Del, Modify,
+// ModifyWithResult and ModifyDN. If the root DSE cannot be read, all controls
+// are sent unchanged and the root DSE is read again with the next request,
+// see ControlNegotiationError.
+func (l *Conn) EnableControlNegotiation(report func(ControlNegotiationEvent)) {
+	l.negotiation = &controlNegotiation{report: report}
+}
+
+// ControlNegotiationError returns the error of the last attempt to read the
+// root DSE for control negotiation, or nil if it was read
+func (l *Conn) ControlNegotiationError() error {
+	if l.negotiation == nil {
+		return nil
+	}
+	l.negotiation.mu.Lock()
+	defer l.negotiation.mu.Unlock()
+	return l.negotiation.err
+}
+
+// supportedControls returns the controls advertised by the root DSE, or nil
+// if it could not be read. Only a successfully read list is kept.
+func (l *Conn) supportedControls() map[string]bool {
+	n := l.negotiation
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.supported != nil {
+		return n.supported
+	}
+
+	dse, err := l.RootDSE(context.Background())
+	if err != nil {
+		l.Debug.Printf("control negotiation skipped, unable to read root DSE: %s", err)
+		n.err = err
+		return nil
+	}
+	n.supported, n.err = make(map[string]bool), nil
+	for _, oid := range dse.SupportedControls {
+		n.supported[oid] = true
+	}
+	return n.supported
+}
+
+// negotiateControls splits the controls into the ones to send and the ones
+// removed because the server does not support them. Unsupported controls are
+// removed if they are not critical or if their type is one of emulated, in
+// which case the caller must apply their effect.
+func (l *Conn) negotiateControls(operation, dn string, controls []Control, emulated ...string) (kept, removed []Control) {
+	if l == nil || l.negotiation == nil || len(controls) == 0 {
+		return controls, nil
+	}
+	supported := l.supportedControls()
+	if supported == nil {
+		return controls, nil
+	}
+	for _, control := range controls {
+		controlType := control.GetControlType()
+		if supported[controlType] {
+			kept = append(kept, control)
+			continue
+		}
+		action := ControlDropped
+		if containsString(emulated, controlType) {
+			action = ControlEmulated
+		} else if controlCriticality(control) {
+			kept = append(kept, control)
+			continue
+		}
+		removed = append(removed, control)
+		l.Debug.Printf("%s %q: server does not support control %s, %s", operation, dn, controlType, strings.ToLower(ControlNegotiationActionMap[action]))
+		if l.negotiation.report != nil {
+			l.negotiation.report(ControlNegotiationEvent{
+				Operation: operation,
+				DN:        dn,
+				Control:   control,
+				Action:    action,
+			})
+		}
+	}
+	return kept, removed
+}
+
+// controlCriticality returns the criticality of a control as it is encoded
+func controlCriticality(control Control) bool {
+	packet := control.Encode()
+	if len(packet.Children) < 2 {
+		return false
+	}
+	criticality, ok := packet.Children[1].Value.(bool)
+	return ok && criticality
+}
+
+// sortEntries sorts the entries by the given sort keys as described in
+// https://www.rfc-editor.org/rfc/rfc2891#section-1.2. Values are compared
+// case-insensitively and a missing value is larger than all other values.
+func sortEntries(entries []*Entry, keys []*SortKey) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		for _, key := range keys {
+			a := minFoldValue(entries[i].GetEqualFoldAttributeValues(key.AttributeType))
+			b := minFoldValue(entries[j].GetEqualFoldAttributeValues(key.AttributeType))
+			var cmp int
+			switch {
+			case a == nil && b == nil:
+				continue
+			case a == nil:
+				cmp = 1
+			case b == nil:
+				cmp = -1
+			default:
+				cmp = strings.Compare(*a, *b)
+			}
+			if key.Reverse {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+}
+
+// minFoldValue returns the lowest of the lowercased values, or nil if there are none
+func minFoldValue(values []string) *string {
+	var lowest *string
+	for _, value := range values {
+		value = strings.ToLower(value)
+		if lowest == nil || value < *lowest {
+			lowest = &value
+		}
+	}
+	return lowest
+}
+
+// deleteSubtree deletes the children of the entry and then the entry itself
+func (l *Conn) deleteSubtree(delRequest *DelRequest) error {
+	searchRequest := NewSearchRequest(delRequest.DN, ScopeSingleLevel, NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)", []string{"1.1"}, nil)
+	result, err := l.Search(searchRequest)
+	if err != nil {
+		return err
+	}
+	for _, entry := range result.Entries {
+		if err := l.deleteSubtree(&DelRequest{DN: entry.DN, Controls: delRequest.Controls}); err != nil {
+			return err
+		}
+	}
+	return l.del(delRequest)
+}
@@ -0,0 +1,212 @@
+package ldap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// negotiationTestServer answers root DSE searches advertising only the paging
+// control, single level searches with the children in tree and deletes with
+// success, recording the requests it received. The first rootDSEFailures
+// root DSE searches fail.
+type negotiationTestServer struct {
+	ptc  *packetTranslatorConn
+	tree map[string][]string
+
+	mu              sync.Mutex
+	deleted         []string
+	controls        map[string]int
+	rootDSEFailures int
+}
+
+func newNegotiationTestServer(ptc *packetTranslatorConn, tree map[string][]string) *negotiationTestServer {
+	s := &negotiationTestServer{ptc: ptc, tree: tree, controls: make(map[string]int)}
+	go s.serve()
+	return s
+}
+
+func (s *negotiationTestServer) serve() {
+	for {
+		req, err := s.ptc.ReceiveRequest()
+		if err != nil {
+			return
+		}
+		msgID := req.Children[0].Value.(int64)
+		if len(req.Children) > 2 {
+			s.mu.Lock()
+			for _, control := range req.Children[2].Children {
+				s.controls[control.Children[0].Value.(string)]++
+			}
+			s.mu.Unlock()
+		}
+
+		switch op := req.Children[1]; op.Tag {
+		case ApplicationSearchRequest:
+			baseDN := op.Children[0].Value.(string)
+			s.mu.Lock()
+			fail := baseDN == "" && s.rootDSEFailures > 0
+			if fail {
+				s.rootDSEFailures--
+			}
+			s.mu.Unlock()
+			if fail {
+				_ = s.ptc.SendResponse(encodeTestResult(msgID, ApplicationSearchResultDone, LDAPResultBusy))
+				continue
+			}
+			if baseDN == "" {
+				_ = s.ptc.SendResponse(encodeTestSearchEntry(msgID, "", map[string][]string{
+					"supportedControl": {ControlTypePaging},
+				}))
+			} else {
+				for _, child := range s.tree[baseDN] {
+					_ = s.ptc.SendResponse(encodeTestSearchEntry(msgID, child, map[string][]string{
+						"cn": {child[3:4]},
+					}))
+				}
+			}
+			_ = s.ptc.SendResponse(encodeTestResult(msgID, ApplicationSearchResultDone, LDAPResultSuccess))
+		case ApplicationDelRequest:
+			s.mu.Lock()
+			s.deleted = append(s.deleted, op.Data.String())
+			s.mu.Unlock()
+			_ = s.ptc.SendResponse(encodeTestResult(msgID, ApplicationDelResponse, LDAPResultSuccess))
+		}
+	}
+}
+
+func TestConn_ControlNegotiation(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	server := newNegotiationTestServer(ptc, map[string][]string{
+		"ou=people,dc=example,dc=com":      {"cn=c,ou=people,dc=example,dc=com", "cn=a,ou=people,dc=example,dc=com", "cn=b,ou=people,dc=example,dc=com"},
+		"cn=a,ou=people,dc=example,dc=com": {"cn=x,cn=a,ou=people,dc=example,dc=com"},
+	})
+
+	var events []ControlNegotiationEvent
+	conn.EnableControlNegotiation(func(event ControlNegotiationEvent) {
+		events = append(events, event)
+	})
+
+	t.Run("client-side sort", func(t *testing.T) {
+		events = nil
+		searchRequest := NewSearchRequest("ou=people,dc=example,dc=com", ScopeSingleLevel, NeverDerefAliases, 0, 0, false,
+			"(objectClass=*)", []string{"cn"}, []Control{
+				NewControlServerSideSortingWithSortKeys([]*SortKey{{AttributeType: "cn", Reverse: true}}),
+				NewControlManageDsaIT(false),
+			})
+		result, err := conn.Search(searchRequest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range result.Entries {
+			names = append(names, entry.GetAttributeValue("cn"))
+		}
+		assert.Equal(t, []string{"c", "b", "a"}, names)
+		assert.Len(t, searchRequest.Controls, 2, "the request of the caller must not be modified")
+
+		if assert.Len(t, events, 2) {
+			assert.Equal(t, ControlTypeServerSideSorting, events[0].Control.GetControlType())
+			assert.Equal(t, ControlEmulated, events[0].Action)
+			assert.Equal(t, "search", events[0].Operation)
+			assert.Equal(t, ControlTypeManageDsaIT, events[1].Control.GetControlType())
+			assert.Equal(t, ControlDropped, events[1].Action)
+		}
+	})
+
+	t.Run("critical unsupported control is sent", func(t *testing.T) {
+		events = nil
+		searchRequest := NewSearchRequest("ou=empty,dc=example,dc=com", ScopeSingleLevel, NeverDerefAliases, 0, 0, false,
+			"(objectClass=*)", nil, []Control{NewControlManageDsaIT(true), NewControlPaging(10)})
+		if _, err := conn.Search(searchRequest); err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, events)
+		server.mu.Lock()
+		assert.Equal(t, 1, server.controls[ControlTypeManageDsaIT])
+		assert.Equal(t, 1, server.controls[ControlTypePaging])
+		server.mu.Unlock()
+	})
+
+	t.Run("recursive delete", func(t *testing.T) {
+		events = nil
+		err := conn.Del(NewDelRequest("ou=people,dc=example,dc=com", []Control{NewControlSubtreeDelete()}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.mu.Lock()
+		assert.Equal(t, []string{
+			"cn=c,ou=people,dc=example,dc=com",
+			"cn=x,cn=a,ou=people,dc=example,dc=com",
+			"cn=a,ou=people,dc=example,dc=com",
+			"cn=b,ou=people,dc=example,dc=com",
+			"ou=people,dc=example,dc=com",
+		}, server.deleted)
+		assert.Zero(t, server.controls[ControlTypeSubtreeDelete])
+		server.mu.Unlock()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, ControlEmulated, events[0].Action)
+			assert.Equal(t, "delete", events[0].Operation)
+		}
+	})
+}
+
+func TestSortEntries(t *testing.T) {
+	entries := []*Entry{
+		NewEntry("cn=1", map[string][]string{"sn": {"Smith"}, "givenName": {"bob"}}),
+		NewEntry("cn=2", map[string][]string{"givenName": {"alice"}}),
+		NewEntry("cn=3", map[string][]string{"sn": {"jones"}}),
+		NewEntry("cn=4", map[string][]string{"sn": {"smith"}, "givenName": {"Alice"}}),
+	}
+	sortEntries(entries, []*SortKey{{AttributeType: "sn"}, {AttributeType: "givenName"}})
+
+	var dns []string
+	for _, entry := range entries {
+		dns = append(dns, entry.DN)
+	}
+	assert.Equal(t, []string{"cn=3", "cn=4", "cn=1", "cn=2"}, dns)
+}
+
+func TestControlCriticality(t *testing.T) {
+	assert.True(t, controlCriticality(NewControlManageDsaIT(true)))
+	assert.False(t, controlCriticality(NewControlManageDsaIT(false)))
+	assert.False(t, controlCriticality(NewControlPaging(10)))
+	assert.True(t, controlCriticality(&ControlString{ControlType: "1.2.3", Criticality: true}))
+}
+
+func TestConn_ControlNegotiationRetry(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	server := &negotiationTestServer{ptc: ptc, controls: make(map[string]int), rootDSEFailures: 1}
+	go server.serve()
+	conn.EnableControlNegotiation(nil)
+
+	// the controls are sent unchanged while the root DSE can not be read
+	searchRequest := NewSearchRequest("ou=empty,dc=example,dc=com", ScopeSingleLevel, NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)", nil, []Control{NewControlManageDsaIT(false)})
+	if _, err := conn.Search(searchRequest); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, IsErrorWithCode(conn.ControlNegotiationError(), LDAPResultBusy))
+
+	// the next request reads the root DSE again
+	if _, err := conn.Search(searchRequest); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, conn.ControlNegotiationError())
+	server.mu.Lock()
+	assert.Equal(t, 1, server.controls[ControlTypeManageDsaIT])
+	server.mu.Unlock()
+}
@@ -0,0 +1,458 @@
+package ldap
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/md4" //nolint:staticcheck
+
+	"github.com/go-ldap/ldap/v3/internal/channelbinding"
+	"github.com/go-ldap/ldap/v3/internal/utf16le"
+)
+
+// NTLM negotiate flags, see MS-NLMP section 2.2.2.5
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateSign                    = 0x00000010
+	ntlmNegotiateSeal                    = 0x00000020
+	ntlmNegotiateLMKey                   = 0x00000080
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiateVersion                 = 0x02000000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiateKeyExchange             = 0x40000000
+	ntlmNegotiate56                      = 0x80000000
+)
+
+// NTLM AV_PAIR IDs of the target info, see MS-NLMP section 2.2.2.1
+const (
+	ntlmAvEOL             = 0x0000
+	ntlmAvFlags           = 0x0006
+	ntlmAvTimestamp       = 0x0007
+	ntlmAvChannelBindings = 0x000a
+
+	// ntlmAvFlagsMICPresent signals the MIC in the AUTHENTICATE message
+	ntlmAvFlagsMICPresent = 0x00000002
+)
+
+// ntlmVersion is the VERSION structure sent by the client, claiming
+// Windows 6.1 build 7601 and NTLM revision 15
+var ntlmVersion = []byte{6, 1, 0xb1, 0x1d, 0, 0, 0, 15}
+
+// ntlmSession is the client side of an NTLMv2 authentication with extended
+// session security, as described in MS-NLMP. It protects the messages
+// following the authentication with signatures and, if sealing was
+// negotiated, RC4 encryption, and implements SASLSecurityLayer to do so.
+type ntlmSession struct {
+	domain   string
+	username string
+	// ntHash is the NT one-way function of the password, see MS-NLMP
+	// section 3.3.1
+	ntHash        []byte
+	securityLayer byte
+	// keyExchange requests a random session key without a security layer,
+	// which protects the mechListMIC of SPNEGO without requesting signing,
+	// so the server does not expect signed LDAP messages
+	keyExchange bool
+	// channelBindings is the tls-server-end-point application data of the
+	// channel bindings, if any
+	channelBindings []byte
+
+	negotiateMessage []byte
+	flags            uint32
+	// withMIC is set if the AUTHENTICATE message carries a MIC
+	withMIC bool
+
+	clientSigningKey []byte
+	serverSigningKey []byte
+	clientSealing    *rc4.Cipher
+	serverSealing    *rc4.Cipher
+	sendSeqNum       uint32
+	recvSeqNum       uint32
+}
+
+// newNTLMSession returns a session authenticating with the password, or with
+// the hex encoded NT hash if hash is not empty. Like go-ntlmssp, the domain is
+// only taken from a username of the form DOMAIN\user, other usernames
+// including UPNs are sent without a domain.
+func newNTLMSession(username, password, hash string, securityLayer byte) (*ntlmSession, error) {
+	var domain string
+	if userDomain, user, found := strings.Cut(username, `\`); found {
+		domain, username = userDomain, user
+	}
+	session := &ntlmSession{
+		domain:        domain,
+		username:      username,
+		securityLayer: securityLayer,
+	}
+	if hash != "" {
+		// LM:NT hashes are accepted as well
+		if _, ntHash, found := strings.Cut(hash, ":"); found {
+			hash = ntHash
+		}
+		ntHash, err := hex.DecodeString(hash)
+		if err != nil {
+			return nil, fmt.Errorf("ldap: invalid NTLM hash: %w", err)
+		}
+		session.ntHash = ntHash
+	} else {
+		h := md4.New()
+		h.Write(utf16le.Encode(password))
+		session.ntHash = h.Sum(nil)
+	}
+	return session, nil
+}
+
+// setChannelBinding binds the authentication to the TLS connection using
+// the tls-server-end-point channel binding, as required by Extended
+// Protection for Authentication
+func (s *ntlmSession) setChannelBinding(state tls.ConnectionState) error {
+	data, err := channelBindingData(state, ChannelBindingTLSServerEndPoint)
+	if err != nil {
+		return err
+	}
+	s.channelBindings = append([]byte(ChannelBindingTLSServerEndPoint+":"), data...)
+	return nil
+}
+
+// negotiate returns the NEGOTIATE message, see MS-NLMP section 2.2.1.1.
+// Signing is only requested for a security layer, the key exchange also if
+// keyExchange is set.
+func (s *ntlmSession) negotiate() []byte {
+	flags := uint32(ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateExtendedSessionSecurity | ntlmNegotiateTargetInfo | ntlmNegotiateVersion |
+		ntlmNegotiate128 | ntlmNegotiate56)
+	switch {
+	case s.securityLayer == GSSAPISecurityLayerConfidentiality:
+		flags |= ntlmNegotiateAlwaysSign | ntlmNegotiateKeyExchange | ntlmNegotiateSign | ntlmNegotiateSeal
+	case s.securityLayer == GSSAPISecurityLayerIntegrity:
+		flags |= ntlmNegotiateAlwaysSign | ntlmNegotiateKeyExchange | ntlmNegotiateSign
+	case s.keyExchange:
+		flags |= ntlmNegotiateKeyExchange
+	}
+
+	// the domain and workstation fields are left empty
+	message := make([]byte, 40)
+	copy(message, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(message[8:], 1)
+	binary.LittleEndian.PutUint32(message[12:], flags)
+	binary.LittleEndian.PutUint32(message[20:], 40)
+	binary.LittleEndian.PutUint32(message[28:], 40)
+	copy(message[32:], ntlmVersion)
+	s.negotiateMessage = message
+	return message
+}
+
+// authenticate processes the CHALLENGE message of the server and returns the
+// AUTHENTICATE message, deriving the session keys.
+// See MS-NLMP sections 2.2.1.2, 2.2.1.3 and 3.1.5.1.2.
+func (s *ntlmSession) authenticate(challenge []byte) ([]byte, error) {
+	if len(challenge) < 48 || !bytes.Equal(challenge[:8], []byte("NTLMSSP\x00")) || binary.LittleEndian.Uint32(challenge[8:]) != 2 {
+		return nil, errors.New("ldap: invalid NTLM challenge message")
+	}
+	flags := binary.LittleEndian.Uint32(challenge[20:])
+	serverChallenge := challenge[24:32]
+	targetInfo, err := ntlmField(challenge, 40)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case flags&ntlmNegotiateUnicode == 0:
+		return nil, errors.New("ldap: NTLM server does not support unicode")
+	case flags&ntlmNegotiateLMKey != 0:
+		return nil, errors.New("ldap: NTLM server requested LM session keys, only NTLMv2 is supported")
+	case s.securityLayer == GSSAPISecurityLayerIntegrity && flags&ntlmNegotiateSign == 0,
+		s.securityLayer == GSSAPISecurityLayerConfidentiality && flags&(ntlmNegotiateSign|ntlmNegotiateSeal) != ntlmNegotiateSign|ntlmNegotiateSeal:
+		return nil, errors.New("ldap: NTLM server does not support the requested security layer")
+	}
+	s.flags = flags
+
+	targetInfo, timestamp, err := s.clientTargetInfo(targetInfo)
+	if err != nil {
+		return nil, err
+	}
+	// a MIC is sent if the server provides a timestamp
+	withMIC := timestamp != nil
+	if timestamp == nil {
+		timestamp = make([]byte, 8)
+		binary.LittleEndian.PutUint64(timestamp, uint64(time.Now().UnixNano()/100+116444736000000000))
+	}
+
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+	responseKey := ntlmV2ResponseKey(s.ntHash, s.username, s.domain)
+	ntResponse, sessionBaseKey := ntlmV2Response(responseKey, serverChallenge, clientChallenge, timestamp, targetInfo)
+	lmResponse := make([]byte, 24)
+	if !withMIC {
+		lmResponse = append(ntlmHMAC(responseKey, serverChallenge, clientChallenge), clientChallenge...)
+	}
+
+	// the key exchange key of NTLMv2 is the session base key
+	exportedSessionKey := sessionBaseKey
+	var encryptedSessionKey []byte
+	if flags&ntlmNegotiateKeyExchange != 0 {
+		exportedSessionKey = make([]byte, 16)
+		if _, err := rand.Read(exportedSessionKey); err != nil {
+			return nil, err
+		}
+		encryptedSessionKey = ntlmRC4(sessionBaseKey, exportedSessionKey)
+	}
+
+	message := encodeNTLMAuthenticate(flags, lmResponse, ntResponse, utf16le.Encode(s.domain),
+		utf16le.Encode(s.username), encryptedSessionKey)
+	s.withMIC = withMIC
+	if withMIC {
+		mic := ntlmHMAC(exportedSessionKey, s.negotiateMessage, challenge, message)
+		copy(message[72:88], mic)
+	}
+	if err := s.deriveKeys(exportedSessionKey); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// clientTargetInfo returns the target info of the server with the AV_PAIRs
+// added by the client, and the timestamp of the server if any
+func (s *ntlmSession) clientTargetInfo(targetInfo []byte) ([]byte, []byte, error) {
+	var output, timestamp []byte
+	var avFlags uint32
+	for {
+		if len(targetInfo) < 4 {
+			return nil, nil, errors.New("ldap: invalid NTLM target info")
+		}
+		id := binary.LittleEndian.Uint16(targetInfo)
+		size := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if len(targetInfo) < 4+size {
+			return nil, nil, errors.New("ldap: invalid NTLM target info")
+		}
+		value := targetInfo[4 : 4+size]
+		switch id {
+		case ntlmAvEOL:
+		case ntlmAvFlags:
+			if size == 4 {
+				avFlags = binary.LittleEndian.Uint32(value)
+			}
+		case ntlmAvTimestamp:
+			timestamp = value
+			fallthrough
+		default:
+			output = append(output, targetInfo[:4+size]...)
+		}
+		if id == ntlmAvEOL {
+			break
+		}
+		targetInfo = targetInfo[4+size:]
+	}
+
+	if timestamp != nil {
+		avFlags |= ntlmAvFlagsMICPresent
+	}
+	if avFlags != 0 {
+		output = appendNTLMAvPair(output, ntlmAvFlags, binary.LittleEndian.AppendUint32(nil, avFlags))
+	}
+	if s.channelBindings != nil {
+		output = appendNTLMAvPair(output, ntlmAvChannelBindings, channelbinding.BindingsHash(s.channelBindings))
+	}
+	return appendNTLMAvPair(output, ntlmAvEOL, nil), timestamp, nil
+}
+
+// deriveKeys derives the signing and sealing keys from the exported session
+// key, see MS-NLMP section 3.4.5
+func (s *ntlmSession) deriveKeys(exportedSessionKey []byte) error {
+	sealingKey := exportedSessionKey
+	switch {
+	case s.flags&ntlmNegotiate128 != 0:
+	case s.flags&ntlmNegotiate56 != 0:
+		sealingKey = sealingKey[:7]
+	default:
+		sealingKey = sealingKey[:5]
+	}
+	s.clientSigningKey = ntlmMD5(exportedSessionKey, "session key to client-to-server signing key magic constant\x00")
+	s.serverSigningKey = ntlmMD5(exportedSessionKey, "session key to server-to-client signing key magic constant\x00")
+
+	var err error
+	s.clientSealing, err = rc4.NewCipher(ntlmMD5(sealingKey, "session key to client-to-server sealing key magic constant\x00"))
+	if err != nil {
+		return err
+	}
+	s.serverSealing, err = rc4.NewCipher(ntlmMD5(sealingKey, "session key to server-to-client sealing key magic constant\x00"))
+	return err
+}
+
+// SecurityLayer reports whether signing or sealing was negotiated. Wrapped
+// messages have no size limit.
+func (s *ntlmSession) SecurityLayer() (bool, int) {
+	return s.securityLayer > GSSAPISecurityLayerNone && s.flags&(ntlmNegotiateSign|ntlmNegotiateSeal) != 0, 0
+}
+
+// Wrap returns the message signature followed by the data, which is
+// encrypted if sealing was negotiated.
+// See MS-NLMP section 3.4.3.
+func (s *ntlmSession) Wrap(data []byte) ([]byte, error) {
+	output := make([]byte, 16+len(data))
+	if s.flags&ntlmNegotiateSeal != 0 {
+		s.clientSealing.XORKeyStream(output[16:], data)
+	} else {
+		copy(output[16:], data)
+	}
+	copy(output, s.signature(s.clientSigningKey, s.clientSealing, s.sendSeqNum, data))
+	s.sendSeqNum++
+	return output, nil
+}
+
+// Unwrap verifies the message signature preceding the data of the server and
+// returns the data, decrypting it if sealing was negotiated.
+func (s *ntlmSession) Unwrap(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, errors.New("ldap: NTLM wrapped message is too short")
+	}
+	output := make([]byte, len(data)-16)
+	if s.flags&ntlmNegotiateSeal != 0 {
+		s.serverSealing.XORKeyStream(output, data[16:])
+	} else {
+		copy(output, data[16:])
+	}
+	if !hmac.Equal(data[:16], s.signature(s.serverSigningKey, s.serverSealing, s.recvSeqNum, output)) {
+		return nil, errors.New("ldap: invalid NTLM message signature")
+	}
+	s.recvSeqNum++
+	return output, nil
+}
+
+// GetMIC returns the signature of the message, as sent for the mechListMIC of
+// SPNEGO. See MS-NLMP section 3.4.4.
+func (s *ntlmSession) GetMIC(message []byte) ([]byte, error) {
+	if !s.signed() {
+		return nil, errors.New("ldap: NTLM authentication is not complete")
+	}
+	signature := s.signature(s.clientSigningKey, s.clientSealing, s.sendSeqNum, message)
+	s.sendSeqNum++
+	return signature, nil
+}
+
+// VerifyMIC verifies the signature of the server for the message
+func (s *ntlmSession) VerifyMIC(message, token []byte) error {
+	if !s.signed() {
+		return errors.New("ldap: NTLM authentication is not complete")
+	}
+	if !hmac.Equal(token, s.signature(s.serverSigningKey, s.serverSealing, s.recvSeqNum, message)) {
+		return errors.New("ldap: invalid NTLM message signature")
+	}
+	s.recvSeqNum++
+	return nil
+}
+
+// signed reports whether the authentication completed and derived the keys
+// to sign messages
+func (s *ntlmSession) signed() bool {
+	return s.clientSigningKey != nil
+}
+
+// confidential reports whether sealing was negotiated
+func (s *ntlmSession) confidential() bool {
+	return s.flags&ntlmNegotiateSeal != 0
+}
+
+// signature returns the NTLMSSP_MESSAGE_SIGNATURE of the message with
+// extended session security, see MS-NLMP section 3.4.4.2
+func (s *ntlmSession) signature(signingKey []byte, sealing *rc4.Cipher, seqNum uint32, message []byte) []byte {
+	seq := binary.LittleEndian.AppendUint32(nil, seqNum)
+	checksum := ntlmHMAC(signingKey, seq, message)[:8]
+	if s.flags&ntlmNegotiateKeyExchange != 0 {
+		sealing.XORKeyStream(checksum, checksum)
+	}
+	signature := binary.LittleEndian.AppendUint32(nil, 1)
+	return append(append(signature, checksum...), seq...)
+}
+
+// ntlmV2ResponseKey returns NTOWFv2 of MS-NLMP section 3.3.2
+func ntlmV2ResponseKey(ntHash []byte, username, domain string) []byte {
+	return ntlmHMAC(ntHash, utf16le.Encode(strings.ToUpper(username)+domain))
+}
+
+// ntlmV2Response returns the NTLMv2 response and the session base key, see
+// MS-NLMP section 3.3.2
+func ntlmV2Response(responseKey, serverChallenge, clientChallenge, timestamp, targetInfo []byte) ([]byte, []byte) {
+	temp := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+
+	ntProof := ntlmHMAC(responseKey, serverChallenge, temp)
+	return append(ntProof, temp...), ntlmHMAC(responseKey, ntProof)
+}
+
+// encodeNTLMAuthenticate returns an AUTHENTICATE message with version and
+// an empty MIC, see MS-NLMP section 2.2.1.3
+func encodeNTLMAuthenticate(flags uint32, lmResponse, ntResponse, domain, username, encryptedSessionKey []byte) []byte {
+	message := make([]byte, 88)
+	copy(message, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(message[8:], 3)
+	// the workstation field is left empty
+	offset := 12
+	for _, field := range [][]byte{lmResponse, ntResponse, domain, username, nil, encryptedSessionKey} {
+		binary.LittleEndian.PutUint16(message[offset:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(message[offset+2:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(message[offset+4:], uint32(len(message)))
+		message = append(message, field...)
+		offset += 8
+	}
+	binary.LittleEndian.PutUint32(message[60:], flags|ntlmNegotiateVersion)
+	copy(message[64:], ntlmVersion)
+	return message
+}
+
+// ntlmField returns the payload referenced by the field at the offset of the
+// message, see MS-NLMP section 2.2
+func ntlmField(message []byte, offset int) ([]byte, error) {
+	size := int(binary.LittleEndian.Uint16(message[offset:]))
+	start := int(binary.LittleEndian.Uint32(message[offset+4:]))
+	if start > len(message) || size > len(message)-start {
+		return nil, errors.New("ldap: invalid NTLM message field")
+	}
+	return message[start : start+size], nil
+}
+
+func appendNTLMAvPair(targetInfo []byte, id uint16, value []byte) []byte {
+	targetInfo = binary.LittleEndian.AppendUint16(targetInfo, id)
+	targetInfo = binary.LittleEndian.AppendUint16(targetInfo, uint16(len(value)))
+	return append(targetInfo, value...)
+}
+
+func ntlmHMAC(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func ntlmMD5(key []byte, magic string) []byte {
+	sum := md5.Sum(append(append([]byte{}, key...), magic...))
+	return sum[:]
+}
+
+func ntlmRC4(key, data []byte) []byte {
+	cipher, _ := rc4.NewCipher(key)
+	output := make([]byte, len(data))
+	cipher.XORKeyStream(output, data)
+	return output
+}
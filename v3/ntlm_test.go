@@ -0,0 +1,324 @@
+package ldap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/Azure/go-ntlmssp"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-ldap/ldap/v3/internal/channelbinding"
+	"github.com/go-ldap/ldap/v3/internal/utf16le"
+)
+
+func decodeTestHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// TestNTLMv2Vectors checks the NTLMv2 test vectors of MS-NLMP section 4.2.4
+func TestNTLMv2Vectors(t *testing.T) {
+	session, err := newNTLMSession(`Domain\User`, "Password", "", GSSAPISecurityLayerConfidentiality)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Domain", session.domain)
+
+	responseKey := ntlmV2ResponseKey(session.ntHash, session.username, session.domain)
+	assert.Equal(t, "0c868a403bfd7a93a3001ef22ef02e3f", hex.EncodeToString(responseKey))
+
+	serverChallenge := decodeTestHex(t, "0123456789abcdef")
+	clientChallenge := bytes.Repeat([]byte{0xaa}, 8)
+	targetInfo := appendNTLMAvPair(nil, 2, utf16le.Encode("Domain"))
+	targetInfo = appendNTLMAvPair(targetInfo, 1, utf16le.Encode("Server"))
+	targetInfo = appendNTLMAvPair(targetInfo, ntlmAvEOL, nil)
+	ntResponse, sessionBaseKey := ntlmV2Response(responseKey, serverChallenge, clientChallenge, make([]byte, 8), targetInfo)
+	assert.Equal(t, "68cd0ab851e51c96aabc927bebef6a1c", hex.EncodeToString(ntResponse[:16]))
+	assert.Equal(t, "8de40ccadbc14a82f15cb0ad0de95ca3", hex.EncodeToString(sessionBaseKey))
+
+	exportedSessionKey := bytes.Repeat([]byte{0x55}, 16)
+	assert.Equal(t, "c5dad2544fc9799094ce1ce90bc9d03e", hex.EncodeToString(ntlmRC4(sessionBaseKey, exportedSessionKey)))
+
+	session.flags = 0xe28a8233
+	if err := session.deriveKeys(exportedSessionKey); err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := session.Wrap(utf16le.Encode("Plaintext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "010000007fb38ec5c55d497600000000"+"54e50165bf1936dc996020c1811b0f06fb5f", hex.EncodeToString(wrapped))
+}
+
+// newTestNTLMServer returns a server side session matching the client
+// session, which wraps with the server keys
+func newTestNTLMServer(t *testing.T, client *ntlmSession, exportedSessionKey []byte) *ntlmSession {
+	server := &ntlmSession{flags: client.flags}
+	if err := server.deriveKeys(exportedSessionKey); err != nil {
+		t.Fatal(err)
+	}
+	server.clientSigningKey, server.serverSigningKey = server.serverSigningKey, server.clientSigningKey
+	server.clientSealing, server.serverSealing = server.serverSealing, server.clientSealing
+	return server
+}
+
+func TestNTLMSessionWrap(t *testing.T) {
+	for _, flags := range []uint32{
+		ntlmNegotiateSign | ntlmNegotiateKeyExchange | ntlmNegotiate128,
+		ntlmNegotiateSign | ntlmNegotiateSeal | ntlmNegotiateKeyExchange | ntlmNegotiate128,
+		ntlmNegotiateSign | ntlmNegotiateSeal | ntlmNegotiate56,
+	} {
+		client := &ntlmSession{flags: flags}
+		exportedSessionKey := bytes.Repeat([]byte{0x42}, 16)
+		if err := client.deriveKeys(exportedSessionKey); err != nil {
+			t.Fatal(err)
+		}
+		server := newTestNTLMServer(t, client, exportedSessionKey)
+
+		for i := 0; i < 3; i++ {
+			wrapped, err := server.Wrap([]byte("message"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, flags&ntlmNegotiateSeal == 0, bytes.HasSuffix(wrapped, []byte("message")))
+			data, err := client.Unwrap(wrapped)
+			if err != nil {
+				t.Fatalf("flags %#x: %v", flags, err)
+			}
+			assert.Equal(t, "message", string(data))
+		}
+
+		wrapped, _ := server.Wrap([]byte("message"))
+		wrapped[len(wrapped)-1] ^= 1
+		_, err := client.Unwrap(wrapped)
+		assert.Error(t, err)
+	}
+}
+
+// testNTLMChallengeWithTargetInfo returns an NTLM CHALLENGE message with the
+// given flags and target info
+func testNTLMChallengeWithTargetInfo(flags uint32, targetInfo []byte) []byte {
+	challenge := make([]byte, 48)
+	copy(challenge, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(challenge[8:], 2)
+	binary.LittleEndian.PutUint32(challenge[16:], 48)
+	binary.LittleEndian.PutUint32(challenge[20:], flags)
+	copy(challenge[24:], []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef})
+	binary.LittleEndian.PutUint16(challenge[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(challenge[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(challenge[44:], 48)
+	return append(challenge, targetInfo...)
+}
+
+func TestNTLMSessionAuthenticate(t *testing.T) {
+	session, err := newNTLMSession(`EXAMPLE\user`, "", "aad3b435b51404eeaad3b435b51404ee:8846f7eaee8fb117ad06bdd830b7586c", GSSAPISecurityLayerConfidentiality)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.channelBindings = []byte("tls-server-end-point:hash")
+	negotiate := session.negotiate()
+	flags := binary.LittleEndian.Uint32(negotiate[12:])
+	assert.Equal(t, uint32(ntlmNegotiateSign|ntlmNegotiateSeal), flags&(ntlmNegotiateSign|ntlmNegotiateSeal))
+
+	targetInfo := appendNTLMAvPair(nil, ntlmAvTimestamp, make([]byte, 8))
+	targetInfo = appendNTLMAvPair(targetInfo, ntlmAvEOL, nil)
+	challenge := testNTLMChallengeWithTargetInfo(flags, targetInfo)
+	message, err := session.authenticate(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server recovers the exported session key and verifies the MIC
+	ntResponse, err := ntlmField(message, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedSessionKey, err := ntlmField(message, 52)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseKey := ntlmV2ResponseKey(decodeTestHex(t, "8846f7eaee8fb117ad06bdd830b7586c"), "user", "EXAMPLE")
+	exportedSessionKey := ntlmRC4(ntlmHMAC(responseKey, ntResponse[:16]), encryptedSessionKey)
+	mic := append([]byte{}, message[72:88]...)
+	copy(message[72:88], make([]byte, 16))
+	assert.Equal(t, ntlmHMAC(exportedSessionKey, negotiate, challenge, message), mic)
+
+	// the client adds the MIC flag and the channel bindings to the target info
+	clientTargetInfo := ntResponse[16+28 : len(ntResponse)-4]
+	assert.Contains(t, string(clientTargetInfo), string(appendNTLMAvPair(nil, ntlmAvFlags, []byte{ntlmAvFlagsMICPresent, 0, 0, 0})))
+	assert.Contains(t, string(clientTargetInfo), string(appendNTLMAvPair(nil, ntlmAvChannelBindings, channelbinding.BindingsHash(session.channelBindings))))
+
+	server := newTestNTLMServer(t, session, exportedSessionKey)
+	wrapped, err := server.Wrap([]byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := session.Unwrap(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "message", string(data))
+
+	_, err = session.authenticate(testNTLMChallengeWithTargetInfo(flags&^ntlmNegotiateSeal, targetInfo))
+	assert.ErrorContains(t, err, "security layer")
+}
+
+// encodeTestNTLMChallenge returns a bind response with the NTLM challenge,
+// which is returned in the matchedDN
+func encodeTestNTLMChallenge(msgID int64, challenge []byte) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationBindResponse, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(LDAPResultSuccess), "resultCode"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(challenge), "matchedDN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+	response.AppendChild(result)
+	return response
+}
+
+func TestNTLMSessionWithoutSecurityLayer(t *testing.T) {
+	// the domain is not taken from UPNs
+	session, err := newNTLMSession("user@example.org", "password", "", GSSAPISecurityLayerNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", session.domain)
+	assert.Equal(t, "user@example.org", session.username)
+
+	// key exchange and signing are only requested for a security layer
+	flags := binary.LittleEndian.Uint32(session.negotiate()[12:])
+	assert.Zero(t, flags&(ntlmNegotiateKeyExchange|ntlmNegotiateAlwaysSign|ntlmNegotiateSign|ntlmNegotiateSeal))
+}
+
+func TestConn_NTLMBind(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	go func() {
+		// without TLS and security layer, go-ntlmssp is used
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		negotiate, err := ntlmssp.NewNegotiateMessage("EXAMPLE", "")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, negotiate, req.Children[1].Children[2].Data.Bytes())
+		flags := uint32(ntlmNegotiateUnicode | ntlmNegotiateNTLM | ntlmNegotiateExtendedSessionSecurity | ntlmNegotiateTargetInfo)
+		challenge := testNTLMChallengeWithTargetInfo(flags, appendNTLMAvPair(nil, ntlmAvEOL, nil))
+		_ = ptc.SendResponse(encodeTestNTLMChallenge(req.Children[0].Value.(int64), challenge))
+
+		// the Domain of the request is not used for the authentication
+		req, err = ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		message := req.Children[1].Children[2].Data.Bytes()
+		domain, _ := ntlmField(message, 28)
+		username, _ := ntlmField(message, 36)
+		assert.Empty(t, domain)
+		assert.Equal(t, utf16le.Encode("user@example.org"), username)
+		_ = ptc.SendResponse(encodeTestResult(req.Children[0].Value.(int64), ApplicationBindResponse, LDAPResultSuccess))
+	}()
+
+	if err := conn.NTLMBind("EXAMPLE", "user@example.org", "password"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConn_NTLMBindSecurityLayerTLS(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, true)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	_, err := conn.NTLMChallengeBind(&NTLMBindRequest{Username: "user", Password: "password", SecurityLayer: GSSAPISecurityLayerIntegrity})
+	assert.ErrorContains(t, err, "not supported over TLS")
+}
+
+func TestConn_NTLMBindSecurityLayer(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	go func() {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		negotiate := req.Children[1].Children[2]
+		assert.Equal(t, ber.Tag(ber.TagEnumerated), negotiate.Tag)
+		flags := binary.LittleEndian.Uint32(negotiate.Data.Bytes()[12:])
+		targetInfo := appendNTLMAvPair(nil, ntlmAvEOL, nil)
+		challenge := testNTLMChallengeWithTargetInfo(flags, targetInfo)
+
+		_ = ptc.SendResponse(encodeTestNTLMChallenge(req.Children[0].Value.(int64), challenge))
+
+		req, err = ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		message := req.Children[1].Children[2].Data.Bytes()
+		ntResponse, _ := ntlmField(message, 20)
+		encryptedSessionKey, _ := ntlmField(message, 52)
+		responseKey := ntlmV2ResponseKey(decodeTestHex(t, "8846f7eaee8fb117ad06bdd830b7586c"), "user", "EXAMPLE")
+		exportedSessionKey := ntlmRC4(ntlmHMAC(responseKey, ntResponse[:16]), encryptedSessionKey)
+		server := newTestNTLMServer(t, &ntlmSession{flags: flags}, exportedSessionKey)
+		_ = ptc.SendResponse(encodeTestResult(req.Children[0].Value.(int64), ApplicationBindResponse, LDAPResultSuccess))
+
+		// the WhoAmI request and its response are wrapped
+		frame, err := ptc.receiveFrame()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, err := server.Unwrap(frame)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		req = ber.DecodePacket(data)
+		response := encodeTestResponse(req.Children[0].Value.(int64), ApplicationExtendedResponse, LDAPResultSuccess,
+			ber.NewString(ber.ClassContext, ber.TypePrimitive, 11, "u:EXAMPLE\\user", "Response Value"))
+		wrapped, _ := server.Wrap(response.Bytes())
+		ptc.sendFrame(wrapped)
+	}()
+
+	_, err := conn.NTLMChallengeBind(&NTLMBindRequest{
+		Username:      `EXAMPLE\user`,
+		Hash:          "8846f7eaee8fb117ad06bdd830b7586c",
+		SecurityLayer: GSSAPISecurityLayerConfidentiality,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := conn.WhoAmI(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `u:EXAMPLE\user`, result.AuthzID)
+
+	_, err = conn.NTLMChallengeBind(&NTLMBindRequest{Username: "user", Password: "password", SecurityLayer: 3})
+	assert.ErrorContains(t, err, "invalid NTLM security layer")
+}
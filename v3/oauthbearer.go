@@ -0,0 +1,123 @@
+package ldap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// OAuthBearerBindRequest represents a SASL OAUTHBEARER bind request, see
+// https://www.rfc-editor.org/rfc/rfc7628
+type OAuthBearerBindRequest struct {
+	// Token is the OAuth 2.0 bearer token
+	Token string
+	// (Optional) Authorization identity
+	AuthZID string
+	// (Optional) Host is the host name of the server the client connected to
+	Host string
+	// (Optional) Port is the port of the server the client connected to
+	Port int
+	// (Optional) Controls to send with the bind request
+	Controls []Control
+}
+
+// OAuthBearerError is returned if the server rejected the bearer token. It
+// holds the error details sent by the server, see
+// https://www.rfc-editor.org/rfc/rfc7628#section-3.2.2
+type OAuthBearerError struct {
+	// Status is the error code, e.g. "invalid_token" or "insufficient_scope"
+	Status string `json:"status"`
+	// Scope is the scope a token must have to be accepted, if sent by the server
+	Scope string `json:"scope,omitempty"`
+	// OpenIDConfiguration is the URL of the OpenID Provider Configuration, if sent by the server
+	OpenIDConfiguration string `json:"openid-configuration,omitempty"`
+	// Err is the error of the bind response
+	Err error `json:"-"`
+}
+
+func (e *OAuthBearerError) Error() string {
+	message := "ldap: OAUTHBEARER token rejected with status " + strconv.Quote(e.Status)
+	if e.Scope != "" {
+		message += ", required scope " + strconv.Quote(e.Scope)
+	}
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *OAuthBearerError) Unwrap() error {
+	return e.Err
+}
+
+// OAuthBearerBind performs a SASL OAUTHBEARER bind with the given bearer
+// token. The host and port of the server are optional.
+func (l *Conn) OAuthBearerBind(token, authzid, host string, port int) error {
+	_, err := l.OAuthBearerBindWithResult(context.Background(), &OAuthBearerBindRequest{
+		Token:   token,
+		AuthZID: authzid,
+		Host:    host,
+		Port:    port,
+	})
+	return err
+}
+
+// OAuthBearerBindWithResult performs the SASL OAUTHBEARER bind defined in the
+// given request. If the server rejects the token with an error challenge, the
+// returned error is an *OAuthBearerError.
+func (l *Conn) OAuthBearerBindWithResult(ctx context.Context, req *OAuthBearerBindRequest) (*SASLBindResult, error) {
+	if req.Token == "" {
+		return nil, NewError(ErrorEmptyPassword, errors.New("ldap: empty bearer token not allowed by the client"))
+	}
+	mechanism := &oauthBearerMechanism{req: req}
+	result, err := l.SASLBind(ctx, mechanism, req.Controls)
+	if err != nil && mechanism.failure != nil {
+		mechanism.failure.Err = err
+		return result, mechanism.failure
+	}
+	return result, err
+}
+
+// oauthBearerMechanism is the client side of the SASL OAUTHBEARER mechanism
+type oauthBearerMechanism struct {
+	req     *OAuthBearerBindRequest
+	failure *OAuthBearerError
+}
+
+func (m *oauthBearerMechanism) Name() string {
+	return "OAUTHBEARER"
+}
+
+func (m *oauthBearerMechanism) Start() ([]byte, error) {
+	const kvsep = "\x01"
+	var b strings.Builder
+	b.WriteString("n,")
+	if m.req.AuthZID != "" {
+		b.WriteString("a=" + scramName(m.req.AuthZID))
+	}
+	b.WriteString("," + kvsep)
+	if m.req.Host != "" {
+		b.WriteString("host=" + m.req.Host + kvsep)
+	}
+	if m.req.Port != 0 {
+		b.WriteString("port=" + strconv.Itoa(m.req.Port) + kvsep)
+	}
+	b.WriteString("auth=Bearer " + m.req.Token + kvsep + kvsep)
+	return []byte(b.String()), nil
+}
+
+// Next handles the error challenge of the server, which has to be answered
+// with a single kvsep to receive the final result
+func (m *oauthBearerMechanism) Next(challenge []byte) ([]byte, error) {
+	if m.failure != nil {
+		return nil, errors.New("ldap: unexpected challenge for SASL OAUTHBEARER")
+	}
+	m.failure = &OAuthBearerError{}
+	if err := json.Unmarshal(challenge, m.failure); err != nil {
+		return nil, fmt.Errorf("ldap: invalid OAUTHBEARER error challenge: %w", err)
+	}
+	return []byte{0x01}, nil
+}
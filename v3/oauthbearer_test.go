@@ -0,0 +1,74 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuthBearerMechanism(t *testing.T) {
+	m := &oauthBearerMechanism{req: &OAuthBearerBindRequest{Token: "vF9dft4qmT", AuthZID: "user@example.com", Host: "server.example.com", Port: 389}}
+	initial, err := m.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "n,a=user@example.com,\x01host=server.example.com\x01port=389\x01auth=Bearer vF9dft4qmT\x01\x01", string(initial))
+
+	m = &oauthBearerMechanism{req: &OAuthBearerBindRequest{Token: "vF9dft4qmT"}}
+	initial, _ = m.Start()
+	assert.Equal(t, "n,,\x01auth=Bearer vF9dft4qmT\x01\x01", string(initial))
+
+	_, err = m.Next([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestConn_OAuthBearerBind(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	go func() {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, "OAUTHBEARER", req.Children[1].Children[2].Children[0].Value)
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSaslBindInProgress,
+			`{"status":"invalid_token","scope":"example_scope","openid-configuration":"https://example.com/.well-known/openid-configuration"}`))
+
+		req, err = ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, "\x01", req.Children[1].Children[2].Children[1].Value)
+		_ = ptc.SendResponse(encodeTestResult(req.Children[0].Value.(int64), ApplicationBindResponse, LDAPResultInvalidCredentials))
+	}()
+
+	err := conn.OAuthBearerBind("token", "", "localhost", 389)
+	var oauthErr *OAuthBearerError
+	if !errors.As(err, &oauthErr) {
+		t.Fatalf("expected OAuthBearerError, got %v", err)
+	}
+	assert.Equal(t, "invalid_token", oauthErr.Status)
+	assert.Equal(t, "example_scope", oauthErr.Scope)
+	assert.Equal(t, "https://example.com/.well-known/openid-configuration", oauthErr.OpenIDConfiguration)
+	assert.True(t, IsErrorWithCode(err, LDAPResultInvalidCredentials))
+
+	go func() {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_ = ptc.SendResponse(encodeTestResult(req.Children[0].Value.(int64), ApplicationBindResponse, LDAPResultSuccess))
+	}()
+	assert.NoError(t, conn.OAuthBearerBind("token", "", "", 0))
+
+	assert.True(t, IsErrorWithCode(conn.OAuthBearerBind("", "", "", 0), ErrorEmptyPassword))
+}
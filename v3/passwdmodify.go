@@ -20,6 +20,8 @@ type PasswordModifyRequest struct {
 	OldPassword string
 	// NewPassword, if present, contains the desired password for this user
 	NewPassword string
+	// Controls hold optional controls to send with the request
+	Controls []Control
 }
 
 // PasswordModifyResult holds the server response to a PasswordModifyRequest
@@ -28,6 +30,14 @@ type PasswordModifyResult struct {
 	GeneratedPassword string
 	// Referral are the returned referral
 	Referral string
+	// Controls are the returned controls
+	Controls []Control
+}
+
+// PasswordPolicyWarning returns the warning of the password policy response
+// controls, or nil if there is none
+func (r *PasswordModifyResult) PasswordPolicyWarning() *PasswordPolicyWarning {
+	return passwordPolicyWarning(r.Controls)
 }
 
 func (req *PasswordModifyRequest) appendTo(envelope *ber.Packet) error {
@@ -50,6 +60,9 @@ func (req *PasswordModifyRequest) appendTo(envelope *ber.Packet) error {
 	pkt.AppendChild(extendedRequestValue)
 
 	envelope.AppendChild(pkt)
+	if len(req.Controls) > 0 {
+		envelope.AppendChild(encodeControls(req.Controls))
+	}
 
 	return nil
 }
@@ -98,9 +111,20 @@ func (l *Conn) PasswordModify(passwordModifyRequest *PasswordModifyRequest) (*Pa
 	}
 	if packet.Children[1].Tag == ApplicationExtendedResponse {
 		if err = GetLDAPError(packet); err != nil {
+			// controls which can not be decoded are skipped to return the error
+			result.Controls = errorControls(packet)
 			result.Referral = getReferral(err, packet)
 
-			return result, err
+			return result, passwordPolicyError(err, result.Controls)
+		}
+		if len(packet.Children) == 3 {
+			for _, child := range packet.Children[2].Children {
+				decodedChild, err := DecodeControl(child)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode child control: %s", err)
+				}
+				result.Controls = append(result.Controls, decodedChild)
+			}
 		}
 	} else {
 		return nil, NewError(ErrorUnexpectedResponse, fmt.Errorf("unexpected Response: %d", packet.Children[1].Tag))
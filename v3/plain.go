@@ -0,0 +1,64 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+)
+
+// PlainBindRequest represents a SASL PLAIN bind request, see
+// https://www.rfc-editor.org/rfc/rfc4616. The password is sent in the clear,
+// so the connection should be protected by TLS.
+type PlainBindRequest struct {
+	// (Optional) AuthZID is the identity to act as, e.g. for proxy logins
+	AuthZID string
+	// Username is the authentication identity, usually not a DN
+	Username string
+	// Password is the credentials to bind with
+	Password string
+	// (Optional) Controls to send with the bind request
+	Controls []Control
+}
+
+// PlainBind performs a SASL PLAIN bind with the given authorization identity,
+// authentication identity and password
+func (l *Conn) PlainBind(authzid, authcid, password string) error {
+	_, err := l.PlainBindWithResult(context.Background(), &PlainBindRequest{
+		AuthZID:  authzid,
+		Username: authcid,
+		Password: password,
+	})
+	return err
+}
+
+// PlainBindWithResult performs the SASL PLAIN bind defined in the given request
+func (l *Conn) PlainBindWithResult(ctx context.Context, req *PlainBindRequest) (*SASLBindResult, error) {
+	if req.Password == "" {
+		return nil, NewError(ErrorEmptyPassword, errors.New("ldap: empty password not allowed by the client"))
+	}
+	message := make([]string, 3)
+	for i, value := range []string{req.AuthZID, req.Username, req.Password} {
+		prepared, err := saslPrep(value)
+		if err != nil {
+			return nil, err
+		}
+		message[i] = prepared
+	}
+	return l.SASLBind(ctx, &plainMechanism{message: []byte(message[0] + "\x00" + message[1] + "\x00" + message[2])}, req.Controls)
+}
+
+// plainMechanism is the client side of the SASL PLAIN mechanism
+type plainMechanism struct {
+	message []byte
+}
+
+func (m *plainMechanism) Name() string {
+	return "PLAIN"
+}
+
+func (m *plainMechanism) Start() ([]byte, error) {
+	return m.message, nil
+}
+
+func (m *plainMechanism) Next(challenge []byte) ([]byte, error) {
+	return nil, errors.New("ldap: unexpected challenge for SASL PLAIN")
+}
@@ -0,0 +1,34 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn_PlainBind(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	go func() {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		auth := req.Children[1].Children[2]
+		assert.Equal(t, "PLAIN", auth.Children[0].Value)
+		assert.Equal(t, "u:admin\x00user\x00pass word", auth.Children[1].Value)
+		_ = ptc.SendResponse(encodeTestResult(req.Children[0].Value.(int64), ApplicationBindResponse, LDAPResultSuccess))
+	}()
+	if err := conn.PlainBind("u:admin", "user", "pass word"); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, IsErrorWithCode(conn.PlainBind("", "user", ""), ErrorEmptyPassword))
+	assert.Error(t, conn.PlainBind("", "user\u0007", "password"))
+}
@@ -0,0 +1,112 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrAccountLocked matches a PasswordPolicyError for a locked account
+	ErrAccountLocked = errors.New("ldap: account locked")
+	// ErrPasswordExpired matches a PasswordPolicyError for an expired
+	// password without remaining grace logins
+	ErrPasswordExpired = errors.New("ldap: password expired")
+)
+
+// PasswordPolicyError is returned by Bind, SimpleBind, Modify,
+// ModifyWithResult and PasswordModify if the password policy of the server
+// rejected the operation, as reported by the Behera password policy response
+// control or the diagnostic message of Active Directory. Use errors.As to
+// inspect the Code:
+//
+//	var ppolicyErr *ldap.PasswordPolicyError
+//	if errors.As(err, &ppolicyErr) && ppolicyErr.Code == ldap.BeheraChangeAfterReset {
+//		// ask the user for a new password
+//	}
+//
+// The password policy response control is only returned if it was requested,
+// which Bind does automatically. Add NewControlBeheraPasswordPolicy to the
+// controls of the other requests.
+type PasswordPolicyError struct {
+	// Code is the password policy error, e.g. BeheraAccountLocked
+	Code int8
+	// Err is the error returned by the server
+	Err error
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return fmt.Sprintf("ldap: password policy: %s: %s", BeheraPasswordPolicyErrorMap[e.Code], e.Err)
+}
+
+func (e *PasswordPolicyError) Unwrap() error { return e.Err }
+
+// Is reports whether the error is ErrAccountLocked or ErrPasswordExpired
+func (e *PasswordPolicyError) Is(target error) bool {
+	switch target {
+	case ErrAccountLocked:
+		return e.Code == BeheraAccountLocked
+	case ErrPasswordExpired:
+		return e.Code == BeheraPasswordExpired
+	}
+	return false
+}
+
+// PasswordPolicyWarning is a password policy warning returned with a
+// successful operation
+type PasswordPolicyWarning struct {
+	// Expire is the number of seconds before the password expires, or -1
+	Expire int64
+	// Grace is the number of remaining logins with the expired password, or
+	// -1
+	Grace int64
+	// MustChange is set if the password has to be changed before any other
+	// operation, e.g. after an administrative reset
+	MustChange bool
+}
+
+// passwordPolicyWarning returns the warning of the Behera or VChu password
+// policy controls, or nil if there is none
+func passwordPolicyWarning(controls []Control) *PasswordPolicyWarning {
+	warning := &PasswordPolicyWarning{Expire: -1, Grace: -1}
+	found := false
+	if c, ok := FindControl(controls, ControlTypeBeheraPasswordPolicy).(*ControlBeheraPasswordPolicy); ok {
+		warning.Expire = c.Expire
+		warning.Grace = c.Grace
+		warning.MustChange = c.Error == BeheraChangeAfterReset
+		found = c.Expire >= 0 || c.Grace >= 0 || warning.MustChange
+	}
+	if c, ok := FindControl(controls, ControlTypeVChuPasswordWarning).(*ControlVChuPasswordWarning); ok && warning.Expire < 0 {
+		warning.Expire = c.Expire
+		found = true
+	}
+	if FindControl(controls, ControlTypeVChuPasswordMustChange) != nil {
+		warning.MustChange = true
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	return warning
+}
+
+// passwordPolicyError returns a PasswordPolicyError wrapping err if the
+// controls, which default to the controls of the LDAP error, or the
+// diagnostic message report a password policy error, and err otherwise
+func passwordPolicyError(err error, controls []Control) error {
+	if err == nil {
+		return nil
+	}
+	var ldapErr *Error
+	if controls == nil && errors.As(err, &ldapErr) {
+		controls = ldapErr.Controls
+	}
+	if c, ok := FindControl(controls, ControlTypeBeheraPasswordPolicy).(*ControlBeheraPasswordPolicy); ok && c.Error >= 0 {
+		return &PasswordPolicyError{Code: c.Error, Err: err}
+	}
+	if diagnostic, ok := GetADDiagnostic(err); ok {
+		if code, ok := adPasswordPolicyCodes[diagnostic.Reason]; ok {
+			return &PasswordPolicyError{Code: code, Err: err}
+		}
+	}
+	return err
+}
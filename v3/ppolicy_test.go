@@ -0,0 +1,175 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicyErrorActiveDirectory(t *testing.T) {
+	for _, tt := range []struct {
+		message string
+		code    int8
+	}{
+		{"80090308: LdapErr: DSID-0C09041C, comment: AcceptSecurityContext error, data 775, v4563", BeheraAccountLocked},
+		{"80090308: LdapErr: DSID-0C09041C, comment: AcceptSecurityContext error, data 532, v4563", BeheraPasswordExpired},
+		{"80090308: LdapErr: DSID-0C09041C, comment: AcceptSecurityContext error, data 773, v4563", BeheraChangeAfterReset},
+		{"80090308: LdapErr: DSID-0C09041C, comment: AcceptSecurityContext error, data 52e, v4563", -1},
+		{"invalid credentials", -1},
+	} {
+		ldapErr := NewError(LDAPResultInvalidCredentials, errors.New(tt.message))
+		err := passwordPolicyError(ldapErr, nil)
+		assert.True(t, IsErrorWithCode(err, LDAPResultInvalidCredentials), tt.message)
+
+		var ppolicyErr *PasswordPolicyError
+		if tt.code < 0 {
+			assert.False(t, errors.As(err, &ppolicyErr), tt.message)
+			continue
+		}
+		if assert.True(t, errors.As(err, &ppolicyErr), tt.message) {
+			assert.Equal(t, tt.code, ppolicyErr.Code)
+		}
+	}
+
+	err := passwordPolicyError(NewError(LDAPResultInvalidCredentials, errors.New("AcceptSecurityContext error, data 775")), nil)
+	assert.ErrorIs(t, err, ErrAccountLocked)
+	assert.False(t, errors.Is(err, ErrPasswordExpired))
+}
+
+// serveTestPasswordPolicy answers the next request with the result and a
+// Behera password policy response control, and returns the request
+func serveTestPasswordPolicy(t *testing.T, ptc *packetTranslatorConn, application ber.Tag, resultCode uint16, ppolicy *ber.Packet) *ber.Packet {
+	req, err := ptc.ReceiveRequest()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	response := encodeTestResult(req.Children[0].Value.(int64), application, resultCode)
+	controls := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+	controls.AppendChild(ppolicy)
+	response.AppendChild(controls)
+	_ = ptc.SendResponse(response)
+	return req
+}
+
+func TestConn_PasswordPolicy(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	// Bind requests the password policy control
+	requests := make(chan *ber.Packet, 1)
+	go func() {
+		requests <- serveTestPasswordPolicy(t, ptc, ApplicationBindResponse, LDAPResultInvalidCredentials,
+			encodeTestPasswordPolicy(-1, -1, BeheraAccountLocked))
+	}()
+	err := conn.Bind("uid=jdoe,dc=example,dc=org", "secret")
+	var ppolicyErr *PasswordPolicyError
+	if assert.True(t, errors.As(err, &ppolicyErr)) {
+		assert.Equal(t, int8(BeheraAccountLocked), ppolicyErr.Code)
+	}
+	assert.ErrorIs(t, err, ErrAccountLocked)
+	assert.True(t, IsErrorWithCode(err, LDAPResultInvalidCredentials))
+	if req := <-requests; assert.Len(t, req.Children, 3) {
+		control, err := DecodeControl(req.Children[2].Children[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ControlTypeBeheraPasswordPolicy, control.GetControlType())
+	}
+
+	go serveTestPasswordPolicy(t, ptc, ApplicationBindResponse, LDAPResultSuccess,
+		encodeTestPasswordPolicy(3600, -1, -1))
+	result, err := conn.SimpleBind(NewSimpleBindRequest("uid=jdoe,dc=example,dc=org", "secret", []Control{NewControlBeheraPasswordPolicy()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &PasswordPolicyWarning{Expire: 3600, Grace: -1}, result.PasswordPolicyWarning())
+
+	modifyRequest := NewModifyRequest("uid=jdoe,dc=example,dc=org", []Control{NewControlBeheraPasswordPolicy()})
+	modifyRequest.Replace("userPassword", []string{"short"})
+	go serveTestPasswordPolicy(t, ptc, ApplicationModifyResponse, LDAPResultConstraintViolation,
+		encodeTestPasswordPolicy(-1, -1, BeheraPasswordTooShort))
+	err = conn.Modify(modifyRequest)
+	if assert.True(t, errors.As(err, &ppolicyErr)) {
+		assert.Equal(t, int8(BeheraPasswordTooShort), ppolicyErr.Code)
+	}
+
+	go serveTestPasswordPolicy(t, ptc, ApplicationModifyResponse, LDAPResultConstraintViolation,
+		encodeTestPasswordPolicy(-1, -1, BeheraPasswordInHistory))
+	modifyResult, err := conn.ModifyWithResult(modifyRequest)
+	if assert.True(t, errors.As(err, &ppolicyErr)) {
+		assert.Equal(t, int8(BeheraPasswordInHistory), ppolicyErr.Code)
+	}
+	assert.Len(t, modifyResult.Controls, 1)
+
+	passwordModifyRequest := NewPasswordModifyRequest("", "old", "new")
+	passwordModifyRequest.Controls = []Control{NewControlBeheraPasswordPolicy()}
+	go serveTestPasswordPolicy(t, ptc, ApplicationExtendedResponse, LDAPResultConstraintViolation,
+		encodeTestPasswordPolicy(-1, -1, BeheraPasswordTooYoung))
+	_, err = conn.PasswordModify(passwordModifyRequest)
+	if assert.True(t, errors.As(err, &ppolicyErr)) {
+		assert.Equal(t, int8(BeheraPasswordTooYoung), ppolicyErr.Code)
+	}
+
+	go serveTestPasswordPolicy(t, ptc, ApplicationExtendedResponse, LDAPResultSuccess,
+		encodeTestPasswordPolicy(-1, 1, -1))
+	passwordModifyResult, err := conn.PasswordModify(passwordModifyRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &PasswordPolicyWarning{Expire: -1, Grace: 1}, passwordModifyResult.PasswordPolicyWarning())
+}
+
+func TestConn_PasswordPolicyUndecodableControl(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	// a control which can not be decoded does not hide the error
+	serve := func(application ber.Tag) {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		response := encodeTestResult(req.Children[0].Value.(int64), application, LDAPResultConstraintViolation)
+		dirSync := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+		dirSync.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ControlTypeDirSync, "Control Type"))
+		controls := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		controls.AppendChild(dirSync)
+		controls.AppendChild(encodeTestPasswordPolicy(-1, -1, BeheraPasswordTooShort))
+		response.AppendChild(controls)
+		_ = ptc.SendResponse(response)
+	}
+
+	modifyRequest := NewModifyRequest("uid=jdoe,dc=example,dc=org", nil)
+	modifyRequest.Replace("userPassword", []string{"short"})
+	go serve(ApplicationModifyResponse)
+	modifyResult, err := conn.ModifyWithResult(modifyRequest)
+	var ppolicyErr *PasswordPolicyError
+	if assert.True(t, errors.As(err, &ppolicyErr)) {
+		assert.Equal(t, int8(BeheraPasswordTooShort), ppolicyErr.Code)
+	}
+	assert.True(t, IsErrorWithCode(err, LDAPResultConstraintViolation))
+	if assert.NotNil(t, modifyResult) {
+		assert.Len(t, modifyResult.Controls, 1)
+	}
+
+	go serve(ApplicationExtendedResponse)
+	passwordModifyResult, err := conn.PasswordModify(NewPasswordModifyRequest("", "old", "short"))
+	if assert.True(t, errors.As(err, &ppolicyErr)) {
+		assert.Equal(t, int8(BeheraPasswordTooShort), ppolicyErr.Code)
+	}
+	if assert.NotNil(t, passwordModifyResult) {
+		assert.Len(t, passwordModifyResult.Controls, 1)
+	}
+}
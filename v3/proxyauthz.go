@@ -0,0 +1,177 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+)
+
+var _ Client = &ProxiedAuthorizationClient{}
+
+// ProxiedAuthorizationClient is a Client which sends a proxied authorization
+// control with every operation, so the server applies its access controls
+// for the authorization identity instead of the bound identity, without
+// rebinding. The bound identity requires the proxy right, e.g. the
+// authzTo attribute in OpenLDAP.
+//
+// Binds, StartTLS and Unbind are passed through unchanged, as the control
+// does not apply to them. A ProxiedAuthorizationClient shares the
+// connection of the wrapped Client, so one connection can serve several
+// identities concurrently.
+type ProxiedAuthorizationClient struct {
+	Client
+	// Control is added to the controls of every operation, replacing any
+	// proxied authorization control of the request
+	Control *ControlProxiedAuthorization
+}
+
+// NewProxiedAuthorizationClient returns a client performing all operations
+// through client as the authorization identity, e.g.
+// "dn:uid=jdoe,ou=people,dc=example,dc=org" or "u:jdoe".
+func NewProxiedAuthorizationClient(client Client, authzID string) *ProxiedAuthorizationClient {
+	return &ProxiedAuthorizationClient{
+		Client:  client,
+		Control: NewControlProxiedAuthorization(authzID),
+	}
+}
+
+// withControl returns a copy of the controls with the proxied authorization
+// control
+func (c *ProxiedAuthorizationClient) withControl(controls []Control) []Control {
+	result := make([]Control, 0, len(controls)+1)
+	for _, control := range controls {
+		if control.GetControlType() != ControlTypeProxiedAuthorization {
+			result = append(result, control)
+		}
+	}
+	return append(result, c.Control)
+}
+
+// Add performs the add operation as the authorization identity
+func (c *ProxiedAuthorizationClient) Add(addRequest *AddRequest) error {
+	if addRequest == nil {
+		return c.Client.Add(nil)
+	}
+	req := *addRequest
+	req.Controls = c.withControl(req.Controls)
+	return c.Client.Add(&req)
+}
+
+// Del performs the delete operation as the authorization identity
+func (c *ProxiedAuthorizationClient) Del(delRequest *DelRequest) error {
+	if delRequest == nil {
+		return c.Client.Del(nil)
+	}
+	req := *delRequest
+	req.Controls = c.withControl(req.Controls)
+	return c.Client.Del(&req)
+}
+
+// Modify performs the modify operation as the authorization identity
+func (c *ProxiedAuthorizationClient) Modify(modifyRequest *ModifyRequest) error {
+	if modifyRequest == nil {
+		return c.Client.Modify(nil)
+	}
+	req := *modifyRequest
+	req.Controls = c.withControl(req.Controls)
+	return c.Client.Modify(&req)
+}
+
+// ModifyDN performs the modify DN operation as the authorization identity
+func (c *ProxiedAuthorizationClient) ModifyDN(modifyDNRequest *ModifyDNRequest) error {
+	if modifyDNRequest == nil {
+		return c.Client.ModifyDN(nil)
+	}
+	req := *modifyDNRequest
+	req.Controls = c.withControl(req.Controls)
+	return c.Client.ModifyDN(&req)
+}
+
+// ModifyWithResult performs the modify operation as the authorization identity
+func (c *ProxiedAuthorizationClient) ModifyWithResult(modifyRequest *ModifyRequest) (*ModifyResult, error) {
+	if modifyRequest == nil {
+		return c.Client.ModifyWithResult(nil)
+	}
+	req := *modifyRequest
+	req.Controls = c.withControl(req.Controls)
+	return c.Client.ModifyWithResult(&req)
+}
+
+// Extended performs the extended operation as the authorization identity
+func (c *ProxiedAuthorizationClient) Extended(extendedRequest *ExtendedRequest) (*ExtendedResponse, error) {
+	if extendedRequest == nil {
+		return c.Client.Extended(nil)
+	}
+	req := *extendedRequest
+	req.Controls = c.withControl(req.Controls)
+	return c.Client.Extended(&req)
+}
+
+// Compare performs the compare operation as the authorization identity. The
+// wrapped Client has to support CompareWithRequest, like Conn.
+func (c *ProxiedAuthorizationClient) Compare(dn, attribute, value string) (bool, error) {
+	comparer, ok := c.Client.(interface {
+		CompareWithRequest(*CompareRequest) (bool, error)
+	})
+	if !ok {
+		return false, errors.New("ldap: the client does not support controls for compare operations")
+	}
+	return comparer.CompareWithRequest(&CompareRequest{
+		DN:        dn,
+		Attribute: attribute,
+		Value:     value,
+		Controls:  c.withControl(nil),
+	})
+}
+
+// PasswordModify performs the password modify operation as the
+// authorization identity
+func (c *ProxiedAuthorizationClient) PasswordModify(passwordModifyRequest *PasswordModifyRequest) (*PasswordModifyResult, error) {
+	if passwordModifyRequest == nil {
+		return c.Client.PasswordModify(nil)
+	}
+	req := *passwordModifyRequest
+	req.Controls = c.withControl(req.Controls)
+	return c.Client.PasswordModify(&req)
+}
+
+// Search performs the search as the authorization identity
+func (c *ProxiedAuthorizationClient) Search(searchRequest *SearchRequest) (*SearchResult, error) {
+	return c.Client.Search(c.searchRequest(searchRequest))
+}
+
+// SearchAsync performs the search as the authorization identity
+func (c *ProxiedAuthorizationClient) SearchAsync(ctx context.Context, searchRequest *SearchRequest, bufferSize int) Response {
+	return c.Client.SearchAsync(ctx, c.searchRequest(searchRequest), bufferSize)
+}
+
+// SearchWithPaging performs the search as the authorization identity
+func (c *ProxiedAuthorizationClient) SearchWithPaging(searchRequest *SearchRequest, pagingSize uint32) (*SearchResult, error) {
+	return c.Client.SearchWithPaging(c.searchRequest(searchRequest), pagingSize)
+}
+
+// DirSync performs the search as the authorization identity
+func (c *ProxiedAuthorizationClient) DirSync(searchRequest *SearchRequest, flags, maxAttrCount int64, cookie []byte) (*SearchResult, error) {
+	return c.Client.DirSync(c.searchRequest(searchRequest), flags, maxAttrCount, cookie)
+}
+
+// DirSyncAsync performs the search as the authorization identity
+func (c *ProxiedAuthorizationClient) DirSyncAsync(ctx context.Context, searchRequest *SearchRequest, bufferSize int, flags, maxAttrCount int64, cookie []byte) Response {
+	return c.Client.DirSyncAsync(ctx, c.searchRequest(searchRequest), bufferSize, flags, maxAttrCount, cookie)
+}
+
+// Syncrepl performs the search as the authorization identity
+func (c *ProxiedAuthorizationClient) Syncrepl(ctx context.Context, searchRequest *SearchRequest, bufferSize int, mode ControlSyncRequestMode, cookie []byte, reloadHint bool) Response {
+	return c.Client.Syncrepl(ctx, c.searchRequest(searchRequest), bufferSize, mode, cookie, reloadHint)
+}
+
+// searchRequest returns a copy of the search request with the proxied
+// authorization control, leaving the request of the caller unchanged. A nil
+// request is passed on to the wrapped Client.
+func (c *ProxiedAuthorizationClient) searchRequest(searchRequest *SearchRequest) *SearchRequest {
+	if searchRequest == nil {
+		return nil
+	}
+	req := *searchRequest
+	req.Controls = c.withControl(req.Controls)
+	return &req
+}
@@ -0,0 +1,154 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiveProxiedRequest answers the next request with a result of the given
+// application and returns the decoded request controls
+func receiveProxiedRequest(t *testing.T, ptc *packetTranslatorConn, application ber.Tag, code uint16) []Control {
+	t.Helper()
+
+	req, err := ptc.ReceiveRequest()
+	if err != nil {
+		t.Fatalf("receive request: %s", err)
+	}
+	if err := ptc.SendResponse(encodeTestResult(req.Children[0].Value.(int64), application, code)); err != nil {
+		t.Fatalf("send response: %s", err)
+	}
+	if len(req.Children) < 3 {
+		t.Fatal("expected request controls")
+	}
+	var controls []Control
+	for _, child := range req.Children[2].Children {
+		control, err := DecodeControl(child)
+		if err != nil {
+			t.Fatal(err)
+		}
+		controls = append(controls, control)
+	}
+	return controls
+}
+
+func TestProxiedAuthorizationClient(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	client := NewProxiedAuthorizationClient(conn, "u:jdoe")
+	expected := NewControlProxiedAuthorizationUser("jdoe")
+
+	// a proxied authorization control of the request is replaced
+	delRequest := NewDelRequest("cn=test,dc=example,dc=org", []Control{
+		NewControlManageDsaIT(false),
+		NewControlProxiedAuthorizationDN("cn=other"),
+	})
+	done := make(chan error, 1)
+	go func() { done <- client.Del(delRequest) }()
+	controls := receiveProxiedRequest(t, ptc, ApplicationDelResponse, LDAPResultSuccess)
+	assert.Equal(t, []Control{NewControlManageDsaIT(false), expected}, controls)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for Del")
+	}
+	assert.Len(t, delRequest.Controls, 2)
+	assert.Equal(t, NewControlProxiedAuthorizationDN("cn=other"), delRequest.Controls[1])
+
+	type compareResult struct {
+		matched bool
+		err     error
+	}
+	compared := make(chan compareResult, 1)
+	go func() {
+		matched, err := client.Compare("cn=test,dc=example,dc=org", "cn", "test")
+		compared <- compareResult{matched, err}
+	}()
+	controls = receiveProxiedRequest(t, ptc, ApplicationCompareResponse, LDAPResultCompareTrue)
+	assert.Equal(t, []Control{expected}, controls)
+	select {
+	case r := <-compared:
+		assert.NoError(t, r.err)
+		assert.True(t, r.matched)
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for Compare")
+	}
+}
+
+func TestControlProxiedAuthorizationEncoding(t *testing.T) {
+	packet := NewControlProxiedAuthorizationDN("cn=admin").Encode()
+	assert.Len(t, packet.Children, 3)
+	assert.Equal(t, ControlTypeProxiedAuthorization, packet.Children[0].Value)
+	assert.Equal(t, true, packet.Children[1].Value)
+	assert.Equal(t, "dn:cn=admin", packet.Children[2].Data.String())
+
+	// an empty authzId requests anonymous authorization
+	packet = NewControlProxiedAuthorization("").Encode()
+	assert.Len(t, packet.Children, 3)
+	assert.Equal(t, 0, packet.Children[2].Data.Len())
+}
+
+// nilRequestClient records the operations called with a nil request
+type nilRequestClient struct {
+	Client
+	calls []string
+}
+
+func (c *nilRequestClient) called(name string, isNil bool) error {
+	if isNil {
+		c.calls = append(c.calls, name)
+	}
+	return errors.New(name + " request is nil")
+}
+
+func (c *nilRequestClient) Add(r *AddRequest) error           { return c.called("add", r == nil) }
+func (c *nilRequestClient) Del(r *DelRequest) error           { return c.called("del", r == nil) }
+func (c *nilRequestClient) Modify(r *ModifyRequest) error     { return c.called("modify", r == nil) }
+func (c *nilRequestClient) ModifyDN(r *ModifyDNRequest) error { return c.called("modifyDN", r == nil) }
+func (c *nilRequestClient) ModifyWithResult(r *ModifyRequest) (*ModifyResult, error) {
+	return nil, c.called("modifyWithResult", r == nil)
+}
+
+func (c *nilRequestClient) Extended(r *ExtendedRequest) (*ExtendedResponse, error) {
+	return nil, c.called("extended", r == nil)
+}
+
+func (c *nilRequestClient) PasswordModify(r *PasswordModifyRequest) (*PasswordModifyResult, error) {
+	return nil, c.called("passwordModify", r == nil)
+}
+
+func (c *nilRequestClient) Search(r *SearchRequest) (*SearchResult, error) {
+	return nil, c.called("search", r == nil)
+}
+
+func TestProxiedAuthorizationClientNilRequest(t *testing.T) {
+	wrapped := &nilRequestClient{}
+	client := NewProxiedAuthorizationClient(wrapped, "u:jdoe")
+
+	assert.EqualError(t, client.Add(nil), "add request is nil")
+	assert.EqualError(t, client.Del(nil), "del request is nil")
+	assert.EqualError(t, client.Modify(nil), "modify request is nil")
+	assert.EqualError(t, client.ModifyDN(nil), "modifyDN request is nil")
+	_, err := client.ModifyWithResult(nil)
+	assert.EqualError(t, err, "modifyWithResult request is nil")
+	_, err = client.Extended(nil)
+	assert.EqualError(t, err, "extended request is nil")
+	_, err = client.PasswordModify(nil)
+	assert.EqualError(t, err, "passwordModify request is nil")
+	_, err = client.Search(nil)
+	assert.EqualError(t, err, "search request is nil")
+	assert.Len(t, wrapped.calls, 8)
+
+	// the error of a Conn is returned unchanged
+	conn := NewConn(newPacketTranslatorConn(), false)
+	client = NewProxiedAuthorizationClient(conn, "u:jdoe")
+	assert.Equal(t, conn.Add(nil), client.Add(nil))
+	assert.Equal(t, conn.Del(nil), client.Del(nil))
+}
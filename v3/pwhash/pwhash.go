@@ -0,0 +1,373 @@
+// Package pwhash hashes and verifies userPassword values in the RFC 2307
+// "{SCHEME}value" format used by OpenLDAP and 389 Directory Server, so
+// passwords can be provisioned without sending them to the server in the
+// clear.
+package pwhash
+
+import (
+	"bytes"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Scheme is a password storage scheme
+type Scheme string
+
+// Supported schemes
+const (
+	// SSHA is a salted SHA-1 hash
+	SSHA Scheme = "SSHA"
+	// SSHA256 is a salted SHA-256 hash
+	SSHA256 Scheme = "SSHA256"
+	// SSHA512 is a salted SHA-512 hash
+	SSHA512 Scheme = "SSHA512"
+	// PBKDF2SHA256 is PBKDF2 with HMAC-SHA256 in the format of the OpenLDAP
+	// pw-pbkdf2 module
+	PBKDF2SHA256 Scheme = "PBKDF2-SHA256"
+	// Argon2 is Argon2id in the format of the OpenLDAP argon2 module
+	Argon2 Scheme = "ARGON2"
+	// Crypt is SHA-512 crypt, verification also supports bcrypt
+	Crypt Scheme = "CRYPT"
+	// BCrypt is bcrypt
+	BCrypt Scheme = "BCRYPT"
+)
+
+// Parameters of the schemes used by Hash
+const (
+	// SaltSize is the salt size of the SSHA and PBKDF2 schemes in bytes
+	SaltSize = 16
+	// PBKDF2Iterations is the number of PBKDF2 iterations
+	PBKDF2Iterations = 600000
+	// Argon2Time, Argon2Memory in KiB and Argon2Threads are the Argon2id
+	// parameters recommended by RFC 9106
+	Argon2Time    = 3
+	Argon2Memory  = 64 * 1024
+	Argon2Threads = 4
+	// CryptRounds is the number of SHA-512 crypt rounds
+	CryptRounds = 656000
+	// BCryptCost is the bcrypt cost
+	BCryptCost = 12
+)
+
+// Limits of the parameters accepted by Verify, so stored hashes can not make
+// a verification take excessive time or memory
+const (
+	maxPBKDF2Iterations = 10000000
+	// maxArgon2Memory in KiB allows the 2 GiB of the first RFC 9106
+	// recommendation
+	maxArgon2Memory  = 2 * 1024 * 1024
+	maxArgon2Time    = 16
+	maxArgon2Threads = 64
+	maxCryptRounds   = 10000000
+	maxBCryptCost    = 16
+	// maxKeySize limits the length of PBKDF2 and Argon2 hashes in bytes
+	maxKeySize = 128
+)
+
+var (
+	// ErrUnsupportedScheme is returned for hashes of unknown schemes
+	ErrUnsupportedScheme = errors.New("pwhash: unsupported scheme")
+	// ErrMalformedHash is returned for hashes which can not be decoded
+	ErrMalformedHash = errors.New("pwhash: malformed hash")
+	// ErrExcessiveCost is returned by Verify for hashes whose parameters
+	// exceed the supported limits, e.g. billions of iterations
+	ErrExcessiveCost = errors.New("pwhash: hash parameters exceed the supported cost")
+)
+
+// Hash returns the userPassword value for the password hashed with the
+// scheme and a random salt
+func Hash(scheme Scheme, password string) (string, error) {
+	var (
+		hashed string
+		err    error
+	)
+	switch scheme {
+	case SSHA:
+		hashed, err = hashSSHA(sha1.New, password)
+	case SSHA256:
+		hashed, err = hashSSHA(sha256.New, password)
+	case SSHA512:
+		hashed, err = hashSSHA(sha512.New, password)
+	case PBKDF2SHA256:
+		hashed, err = hashPBKDF2(password, PBKDF2Iterations)
+	case Argon2:
+		hashed, err = hashArgon2(password)
+	case Crypt:
+		hashed, err = hashSHA512Crypt(password, CryptRounds)
+	case BCrypt:
+		var b []byte
+		b, err = bcrypt.GenerateFromPassword([]byte(password), BCryptCost)
+		hashed = string(b)
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedScheme, scheme)
+	}
+	if err != nil {
+		return "", err
+	}
+	return "{" + string(scheme) + "}" + hashed, nil
+}
+
+// Verify reports whether the password matches the hashed userPassword value.
+// An error is returned if the scheme is not supported, the value is malformed
+// or its parameters exceed the limits of ErrExcessiveCost.
+func Verify(hashed, password string) (bool, error) {
+	scheme, value, err := splitScheme(hashed)
+	if err != nil {
+		return false, err
+	}
+	switch scheme {
+	case SSHA:
+		return verifySSHA(sha1.New, value, password)
+	case SSHA256:
+		return verifySSHA(sha256.New, value, password)
+	case SSHA512:
+		return verifySSHA(sha512.New, value, password)
+	case PBKDF2SHA256:
+		return verifyPBKDF2(value, password)
+	case Argon2:
+		return verifyArgon2(value, password)
+	case Crypt:
+		if strings.HasPrefix(value, "$2") {
+			return verifyBCrypt(value, password)
+		}
+		return verifySHA512Crypt(value, password)
+	case BCrypt:
+		return verifyBCrypt(value, password)
+	}
+	return false, fmt.Errorf("%w: %q", ErrUnsupportedScheme, scheme)
+}
+
+// SchemeOf returns the scheme of the hashed userPassword value
+func SchemeOf(hashed string) (Scheme, error) {
+	scheme, _, err := splitScheme(hashed)
+	return scheme, err
+}
+
+// AddUserPassword hashes the password with the scheme and sets it as the
+// userPassword attribute of the request
+func AddUserPassword(req *ldap.AddRequest, scheme Scheme, password string) error {
+	hashed, err := Hash(scheme, password)
+	if err != nil {
+		return err
+	}
+	req.Attribute("userPassword", []string{hashed})
+	return nil
+}
+
+// ReplaceUserPassword hashes the password with the scheme and replaces the
+// userPassword attribute with it
+func ReplaceUserPassword(req *ldap.ModifyRequest, scheme Scheme, password string) error {
+	hashed, err := Hash(scheme, password)
+	if err != nil {
+		return err
+	}
+	req.Replace("userPassword", []string{hashed})
+	return nil
+}
+
+func splitScheme(hashed string) (Scheme, string, error) {
+	end := strings.IndexByte(hashed, '}')
+	if !strings.HasPrefix(hashed, "{") || end < 0 {
+		return "", "", fmt.Errorf("%w: missing {SCHEME} prefix", ErrMalformedHash)
+	}
+	return Scheme(strings.ToUpper(hashed[1:end])), hashed[end+1:], nil
+}
+
+func randomSalt(size int) ([]byte, error) {
+	salt := make([]byte, size)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func hashSSHA(newHash func() hash.Hash, password string) (string, error) {
+	salt, err := randomSalt(SaltSize)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(saltedHash(newHash, password, salt)), nil
+}
+
+// saltedHash returns the hash of the password and the salt followed by the
+// salt
+func saltedHash(newHash func() hash.Hash, password string, salt []byte) []byte {
+	h := newHash()
+	h.Write([]byte(password))
+	h.Write(salt)
+	return append(h.Sum(nil), salt...)
+}
+
+func verifySSHA(newHash func() hash.Hash, value, password string) (bool, error) {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	size := newHash().Size()
+	if err != nil || len(decoded) < size {
+		return false, ErrMalformedHash
+	}
+	expected := saltedHash(newHash, password, decoded[size:])
+	return subtle.ConstantTimeCompare(expected, decoded) == 1, nil
+}
+
+// pbkdf2Encoding is the adapted base64 encoding of passlib used by the
+// OpenLDAP pw-pbkdf2 module
+var pbkdf2Encoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789./").WithPadding(base64.NoPadding)
+
+func hashPBKDF2(password string, iterations int) (string, error) {
+	salt, err := randomSalt(SaltSize)
+	if err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(iterations) + "$" + pbkdf2Encoding.EncodeToString(salt) + "$" + pbkdf2Encoding.EncodeToString(key), nil
+}
+
+func verifyPBKDF2(value, password string) (bool, error) {
+	parts := strings.Split(value, "$")
+	if len(parts) != 3 {
+		return false, ErrMalformedHash
+	}
+	iterations, err := strconv.Atoi(parts[0])
+	if err != nil || iterations < 1 {
+		return false, ErrMalformedHash
+	}
+	salt, err := pbkdf2Encoding.DecodeString(parts[1])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	expected, err := pbkdf2Encoding.DecodeString(parts[2])
+	if err != nil || len(expected) == 0 {
+		return false, ErrMalformedHash
+	}
+	if iterations > maxPBKDF2Iterations || len(expected) > maxKeySize {
+		return false, fmt.Errorf("%w: %d iterations, %d bytes", ErrExcessiveCost, iterations, len(expected))
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+// argon2Encoding is the encoding of the salt and hash in the PHC string
+// format
+var argon2Encoding = base64.RawStdEncoding
+
+func hashArgon2(password string) (string, error) {
+	salt, err := randomSalt(SaltSize)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, Argon2Time, Argon2Memory, Argon2Threads, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, Argon2Memory, Argon2Time, Argon2Threads,
+		argon2Encoding.EncodeToString(salt), argon2Encoding.EncodeToString(key)), nil
+}
+
+func verifyArgon2(value, password string) (bool, error) {
+	// $argon2id$v=19$m=65536,t=3,p=4$salt$hash
+	parts := strings.Split(value, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return false, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrMalformedHash
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || time == 0 || threads == 0 {
+		return false, ErrMalformedHash
+	}
+	salt, err := argon2Encoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	expected, err := argon2Encoding.DecodeString(parts[5])
+	if err != nil || len(expected) == 0 {
+		return false, ErrMalformedHash
+	}
+	if memory > maxArgon2Memory || time > maxArgon2Time || threads > maxArgon2Threads || len(expected) > maxKeySize {
+		return false, fmt.Errorf("%w: m=%d,t=%d,p=%d, %d bytes", ErrExcessiveCost, memory, time, threads, len(expected))
+	}
+
+	var key []byte
+	switch parts[1] {
+	case "argon2id":
+		key = argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(expected)))
+	case "argon2i":
+		key = argon2.Key([]byte(password), salt, time, memory, threads, uint32(len(expected)))
+	default:
+		return false, fmt.Errorf("%w: %q", ErrUnsupportedScheme, parts[1])
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+func verifyBCrypt(value, password string) (bool, error) {
+	cost, err := bcrypt.Cost([]byte(value))
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", ErrMalformedHash, err)
+	}
+	if cost > maxBCryptCost {
+		return false, fmt.Errorf("%w: cost %d", ErrExcessiveCost, cost)
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(value), []byte(password))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: %s", ErrMalformedHash, err)
+}
+
+func verifySHA512Crypt(value, password string) (bool, error) {
+	if !strings.HasPrefix(value, sha512CryptPrefix) {
+		return false, fmt.Errorf("%w: only SHA-512 crypt and bcrypt are supported for {CRYPT}", ErrUnsupportedScheme)
+	}
+	params := strings.Split(value[len(sha512CryptPrefix):], "$")
+	rounds, customRounds := sha512CryptDefaultRounds, false
+	if len(params) == 3 && strings.HasPrefix(params[0], "rounds=") {
+		var err error
+		rounds, err = strconv.Atoi(strings.TrimPrefix(params[0], "rounds="))
+		if err != nil {
+			return false, ErrMalformedHash
+		}
+		if rounds > maxCryptRounds {
+			return false, fmt.Errorf("%w: %d rounds", ErrExcessiveCost, rounds)
+		}
+		params, customRounds = params[1:], true
+	}
+	if len(params) != 2 {
+		return false, ErrMalformedHash
+	}
+	expected := sha512Crypt(password, params[0], rounds, customRounds)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(value)) == 1, nil
+}
+
+func hashSHA512Crypt(password string, rounds int) (string, error) {
+	salt, err := randomSalt(sha512CryptMaxSaltSize)
+	if err != nil {
+		return "", err
+	}
+	encoded := bytes.Buffer{}
+	for _, b := range salt {
+		encoded.WriteByte(cryptAlphabet[b&0x3f])
+	}
+	return sha512Crypt(password, encoded.String(), rounds, true), nil
+}
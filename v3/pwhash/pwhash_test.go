@@ -0,0 +1,128 @@
+package pwhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashVerify(t *testing.T) {
+	for _, scheme := range []Scheme{SSHA, SSHA256, SSHA512, PBKDF2SHA256, Argon2, Crypt, BCrypt} {
+		hashed, err := Hash(scheme, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, strings.HasPrefix(hashed, "{"+string(scheme)+"}"), hashed)
+
+		actual, err := SchemeOf(hashed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, scheme, actual)
+
+		ok, err := Verify(hashed, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, ok, scheme)
+
+		ok, err = Verify(hashed, "wrong")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, ok, scheme)
+
+		other, err := Hash(scheme, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotEqual(t, hashed, other, "hashes of %s must be salted", scheme)
+	}
+}
+
+func TestVerifyKnownHashes(t *testing.T) {
+	for _, tt := range []struct {
+		hashed   string
+		password string
+	}{
+		// test vectors of https://www.akkadia.org/drepper/SHA-crypt.txt
+		{"{CRYPT}$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!"},
+		{"{CRYPT}$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.", "Hello world!"},
+		{"{CRYPT}$6$rounds=5000$toolongsaltstrin$lQ8jolhgVRVhY4b5pZKaysCLi0QBxGoNeKQzQ3glMhwllF7oGDZxUhx1yxdYcz/e1JSbq3y6JMxxl8audkUEm0", "This is just a test"},
+		// bcrypt hashes are accepted for {CRYPT}
+		{"{CRYPT}$2a$04$d2EtNT25Uw7lULIHSBmqGuuGK1Gg30b54wl4eBvLpw4sTKGqNi/pu", "secret"},
+	} {
+		ok, err := Verify(tt.hashed, tt.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, ok, tt.hashed)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	for _, tt := range []struct {
+		hashed string
+		err    error
+	}{
+		{"secret", ErrMalformedHash},
+		{"{MD5}Xr4ilOzQ4PCOq3aQ0qbuaQ==", ErrUnsupportedScheme},
+		{"{SSHA}c2hvcnQ=", ErrMalformedHash},
+		{"{SSHA}not base64", ErrMalformedHash},
+		{"{PBKDF2-SHA256}600000$salt", ErrMalformedHash},
+		{"{ARGON2}$argon2id$v=19$m=65536,t=3$salt$hash", ErrMalformedHash},
+		{"{CRYPT}$1$salt$hash", ErrUnsupportedScheme},
+		{"{CRYPT}$6$rounds=x$salt$hash", ErrMalformedHash},
+		{"{BCRYPT}$2a$04$short", ErrMalformedHash},
+		{"{PBKDF2-SHA256}2000000000$c2FsdA$aGFzaA", ErrExcessiveCost},
+		{"{PBKDF2-SHA256}1000$c2FsdA$" + strings.Repeat("A", 4096), ErrExcessiveCost},
+		{"{ARGON2}$argon2id$v=19$m=4294967295,t=3,p=4$c2FsdA$aGFzaA", ErrExcessiveCost},
+		{"{ARGON2}$argon2id$v=19$m=65536,t=4294967295,p=4$c2FsdA$aGFzaA", ErrExcessiveCost},
+		{"{ARGON2}$argon2id$v=19$m=65536,t=3,p=255$c2FsdA$aGFzaA", ErrExcessiveCost},
+		{"{CRYPT}$6$rounds=999999999$salt$hash", ErrExcessiveCost},
+		{"{BCRYPT}$2a$31$d2EtNT25Uw7lULIHSBmqGuuGK1Gg30b54wl4eBvLpw4sTKGqNi/pu", ErrExcessiveCost},
+	} {
+		ok, err := Verify(tt.hashed, "secret")
+		assert.False(t, ok, tt.hashed)
+		assert.True(t, errors.Is(err, tt.err), "%s: %v", tt.hashed, err)
+	}
+
+	_, err := Hash("MD5", "secret")
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+}
+
+func TestUserPasswordRequests(t *testing.T) {
+	addRequest := ldap.NewAddRequest("uid=jdoe,dc=example,dc=org", nil)
+	if err := AddUserPassword(addRequest, SSHA512, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, addRequest.Attributes, 1) {
+		assert.Equal(t, "userPassword", addRequest.Attributes[0].Type)
+		ok, err := Verify(addRequest.Attributes[0].Vals[0], "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, ok)
+	}
+
+	modifyRequest := ldap.NewModifyRequest("uid=jdoe,dc=example,dc=org", nil)
+	if err := ReplaceUserPassword(modifyRequest, SSHA256, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, modifyRequest.Changes, 1) {
+		change := modifyRequest.Changes[0]
+		assert.Equal(t, uint(ldap.ReplaceAttribute), change.Operation)
+		assert.Equal(t, "userPassword", change.Modification.Type)
+		ok, err := Verify(change.Modification.Vals[0], "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, ok)
+	}
+
+	assert.ErrorIs(t, ReplaceUserPassword(modifyRequest, "MD5", "secret"), ErrUnsupportedScheme)
+	assert.Len(t, modifyRequest.Changes, 1)
+}
@@ -0,0 +1,124 @@
+package pwhash
+
+import (
+	"crypto/sha512"
+	"strconv"
+	"strings"
+)
+
+// SHA-512 crypt as specified in https://www.akkadia.org/drepper/SHA-crypt.txt
+const (
+	sha512CryptPrefix        = "$6$"
+	sha512CryptDefaultRounds = 5000
+	sha512CryptMinRounds     = 1000
+	sha512CryptMaxRounds     = 999999999
+	sha512CryptMaxSaltSize   = 16
+)
+
+// cryptAlphabet is the base64 alphabet of crypt
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// sha512CryptPermutation is the order in which the bytes of the final digest
+// are encoded, in groups of three
+var sha512CryptPermutation = [...]int{
+	0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4, 47, 5, 26, 6, 27, 48,
+	28, 49, 7, 50, 8, 29, 9, 30, 51, 31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55,
+	13, 56, 14, 35, 15, 36, 57, 37, 58, 16, 59, 17, 38, 18, 39, 60, 40, 61, 19,
+	62, 20, 41,
+}
+
+// sha512Crypt returns the SHA-512 crypt hash of the password, including the
+// "$6$" prefix and the salt. The rounds are included in the hash if
+// customRounds is set.
+func sha512Crypt(password, salt string, rounds int, customRounds bool) string {
+	if len(salt) > sha512CryptMaxSaltSize {
+		salt = salt[:sha512CryptMaxSaltSize]
+	}
+	rounds = min(max(rounds, sha512CryptMinRounds), sha512CryptMaxRounds)
+	key := []byte(password)
+
+	h := sha512.New()
+	h.Write(key)
+	h.Write([]byte(salt))
+	h.Write(key)
+	b := h.Sum(nil)
+
+	h.Reset()
+	h.Write(key)
+	h.Write([]byte(salt))
+	h.Write(repeatBytes(b, len(key)))
+	for n := len(key); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(key)
+		}
+	}
+	a := h.Sum(nil)
+
+	h.Reset()
+	for range key {
+		h.Write(key)
+	}
+	p := repeatBytes(h.Sum(nil), len(key))
+
+	h.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write([]byte(salt))
+	}
+	s := repeatBytes(h.Sum(nil), len(salt))
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	result := strings.Builder{}
+	result.WriteString(sha512CryptPrefix)
+	if customRounds {
+		result.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	result.WriteString(salt)
+	result.WriteByte('$')
+	for i := 0; i < len(sha512CryptPermutation); i += 3 {
+		encodeCrypt24(&result, c[sha512CryptPermutation[i]], c[sha512CryptPermutation[i+1]], c[sha512CryptPermutation[i+2]], 4)
+	}
+	encodeCrypt24(&result, 0, 0, c[63], 2)
+	return result.String()
+}
+
+// repeatBytes returns the sequence b repeated to the given length
+func repeatBytes(b []byte, length int) []byte {
+	result := make([]byte, 0, length)
+	for len(result) < length {
+		result = append(result, b[:min(len(b), length-len(result))]...)
+	}
+	return result
+}
+
+// encodeCrypt24 encodes the 24 bit value of the bytes as n characters, least
+// significant bits first
+func encodeCrypt24(result *strings.Builder, b2, b1, b0 byte, n int) {
+	w := uint32(b2)<<16 | uint32(b1)<<8 | uint32(b0)
+	for ; n > 0; n-- {
+		result.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
@@ -0,0 +1,239 @@
+package ldap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Attributes of the root DSE as defined in https://www.rfc-editor.org/rfc/rfc4512#section-5.1
+// and the Active Directory specific ones described in [MS-ADTS] 3.1.1.3.2
+const (
+	RootDSEAltServer               = "altServer"
+	RootDSENamingContexts          = "namingContexts"
+	RootDSESupportedControl        = "supportedControl"
+	RootDSESupportedExtension      = "supportedExtension"
+	RootDSESupportedFeatures       = "supportedFeatures"
+	RootDSESupportedLDAPVersion    = "supportedLDAPVersion"
+	RootDSESupportedSASLMechanisms = "supportedSASLMechanisms"
+	RootDSESubschemaSubentry       = "subschemaSubentry"
+	RootDSEVendorName              = "vendorName"
+	RootDSEVendorVersion           = "vendorVersion"
+
+	RootDSEDefaultNamingContext          = "defaultNamingContext"
+	RootDSERootDomainNamingContext       = "rootDomainNamingContext"
+	RootDSEConfigurationNamingContext    = "configurationNamingContext"
+	RootDSESchemaNamingContext           = "schemaNamingContext"
+	RootDSEDNSHostName                   = "dnsHostName"
+	RootDSEServerName                    = "serverName"
+	RootDSELDAPServiceName               = "ldapServiceName"
+	RootDSESupportedCapabilities         = "supportedCapabilities"
+	RootDSEDomainFunctionality           = "domainFunctionality"
+	RootDSEForestFunctionality           = "forestFunctionality"
+	RootDSEDomainControllerFunctionality = "domainControllerFunctionality"
+	RootDSEIsGlobalCatalogReady          = "isGlobalCatalogReady"
+	RootDSEIsSynchronized                = "isSynchronized"
+)
+
+var rootDSEAttributes = []string{
+	"*",
+	"+",
+	RootDSEAltServer,
+	RootDSENamingContexts,
+	RootDSESupportedControl,
+	RootDSESupportedExtension,
+	RootDSESupportedFeatures,
+	RootDSESupportedLDAPVersion,
+	RootDSESupportedSASLMechanisms,
+	RootDSESubschemaSubentry,
+	RootDSEVendorName,
+	RootDSEVendorVersion,
+}
+
+// RootDSE holds the information published by a server in its root DSE
+type RootDSE struct {
+	// AltServers lists URIs of alternative servers
+	AltServers []string
+	// NamingContexts lists the DNs of the naming contexts held by the server
+	NamingContexts []string
+	// SupportedControls lists the OIDs of the supported controls
+	SupportedControls []string
+	// SupportedExtensions lists the OIDs of the supported extended operations
+	SupportedExtensions []string
+	// SupportedFeatures lists the OIDs of the supported features
+	SupportedFeatures []string
+	// SupportedLDAPVersions lists the supported protocol versions
+	SupportedLDAPVersions []int
+	// SupportedSASLMechanisms lists the supported SASL mechanisms
+	SupportedSASLMechanisms []string
+	// SubschemaSubentry is the DN of the subschema subentry of the root DSE
+	SubschemaSubentry string
+	// VendorName is the name of the server implementation, if published
+	VendorName string
+	// VendorVersion is the version of the server implementation, if published
+	VendorVersion string
+
+	// DefaultNamingContext is the DN of the domain (Active Directory)
+	DefaultNamingContext string
+	// RootDomainNamingContext is the DN of the forest root domain (Active Directory)
+	RootDomainNamingContext string
+	// ConfigurationNamingContext is the DN of the configuration container (Active Directory)
+	ConfigurationNamingContext string
+	// SchemaNamingContext is the DN of the schema container (Active Directory)
+	SchemaNamingContext string
+	// DNSHostName is the DNS name of the domain controller (Active Directory)
+	DNSHostName string
+	// ServerName is the DN of the server object of the domain controller (Active Directory)
+	ServerName string
+	// LDAPServiceName is the service principal name of the LDAP server (Active Directory)
+	LDAPServiceName string
+	// SupportedCapabilities lists the OIDs of the capabilities of the domain controller (Active Directory)
+	SupportedCapabilities []string
+	// DomainFunctionality is the functional level of the domain (Active Directory)
+	DomainFunctionality int
+	// ForestFunctionality is the functional level of the forest (Active Directory)
+	ForestFunctionality int
+	// DomainControllerFunctionality is the functional level of the domain controller (Active Directory)
+	DomainControllerFunctionality int
+	// IsGlobalCatalogReady indicates the domain controller is a global catalog (Active Directory)
+	IsGlobalCatalogReady bool
+	// IsSynchronized indicates the domain controller has completed its initial synchronization (Active Directory)
+	IsSynchronized bool
+
+	// Entry is the root DSE as returned by the server, for vendor specific attributes
+	Entry *Entry
+}
+
+// RootDSE reads the root DSE of the server
+func (l *Conn) RootDSE(ctx context.Context) (*RootDSE, error) {
+	searchRequest := NewSearchRequest("", ScopeBaseObject, NeverDerefAliases, 0, 0, false,
+		subschemaDefaultFilter, rootDSEAttributes, nil)
+
+	entries, err := l.searchEntries(ctx, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, NewError(ErrorUnexpectedResponse, fmt.Errorf("ldap: expected 1 root DSE entry, got %d", len(entries)))
+	}
+	return ParseRootDSE(entries[0])
+}
+
+// searchEntries returns the entries found by the search, which is abandoned
+// when the context is done
+func (l *Conn) searchEntries(ctx context.Context, searchRequest *SearchRequest) ([]*Entry, error) {
+	var entries []*Entry
+	r := l.SearchAsync(ctx, searchRequest, 1)
+	for r.Next() {
+		entries = append(entries, r.Entry())
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ParseRootDSE fills a RootDSE from the given root DSE entry
+func ParseRootDSE(entry *Entry) (*RootDSE, error) {
+	dse := &RootDSE{
+		AltServers:              entry.GetEqualFoldAttributeValues(RootDSEAltServer),
+		NamingContexts:          entry.GetEqualFoldAttributeValues(RootDSENamingContexts),
+		SupportedControls:       entry.GetEqualFoldAttributeValues(RootDSESupportedControl),
+		SupportedExtensions:     entry.GetEqualFoldAttributeValues(RootDSESupportedExtension),
+		SupportedFeatures:       entry.GetEqualFoldAttributeValues(RootDSESupportedFeatures),
+		SupportedSASLMechanisms: entry.GetEqualFoldAttributeValues(RootDSESupportedSASLMechanisms),
+		SubschemaSubentry:       entry.GetEqualFoldAttributeValue(RootDSESubschemaSubentry),
+		VendorName:              entry.GetEqualFoldAttributeValue(RootDSEVendorName),
+		VendorVersion:           entry.GetEqualFoldAttributeValue(RootDSEVendorVersion),
+
+		DefaultNamingContext:       entry.GetEqualFoldAttributeValue(RootDSEDefaultNamingContext),
+		RootDomainNamingContext:    entry.GetEqualFoldAttributeValue(RootDSERootDomainNamingContext),
+		ConfigurationNamingContext: entry.GetEqualFoldAttributeValue(RootDSEConfigurationNamingContext),
+		SchemaNamingContext:        entry.GetEqualFoldAttributeValue(RootDSESchemaNamingContext),
+		DNSHostName:                entry.GetEqualFoldAttributeValue(RootDSEDNSHostName),
+		ServerName:                 entry.GetEqualFoldAttributeValue(RootDSEServerName),
+		LDAPServiceName:            entry.GetEqualFoldAttributeValue(RootDSELDAPServiceName),
+		SupportedCapabilities:      entry.GetEqualFoldAttributeValues(RootDSESupportedCapabilities),
+
+		Entry: entry,
+	}
+
+	for _, version := range entry.GetEqualFoldAttributeValues(RootDSESupportedLDAPVersion) {
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("ldap: invalid %s %q: %w", RootDSESupportedLDAPVersion, version, err)
+		}
+		dse.SupportedLDAPVersions = append(dse.SupportedLDAPVersions, v)
+	}
+
+	for attribute, target := range map[string]*int{
+		RootDSEDomainFunctionality:           &dse.DomainFunctionality,
+		RootDSEForestFunctionality:           &dse.ForestFunctionality,
+		RootDSEDomainControllerFunctionality: &dse.DomainControllerFunctionality,
+	} {
+		value := entry.GetEqualFoldAttributeValue(attribute)
+		if value == "" {
+			continue
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("ldap: invalid %s %q: %w", attribute, value, err)
+		}
+		*target = v
+	}
+
+	dse.IsGlobalCatalogReady = strings.EqualFold(entry.GetEqualFoldAttributeValue(RootDSEIsGlobalCatalogReady), "TRUE")
+	dse.IsSynchronized = strings.EqualFold(entry.GetEqualFoldAttributeValue(RootDSEIsSynchronized), "TRUE")
+
+	return dse, nil
+}
+
+// SupportsControl returns true if the server advertises the control with the given OID
+func (d *RootDSE) SupportsControl(oid string) bool {
+	return containsString(d.SupportedControls, oid)
+}
+
+// SupportsExtension returns true if the server advertises the extended operation with the given OID
+func (d *RootDSE) SupportsExtension(oid string) bool {
+	return containsString(d.SupportedExtensions, oid)
+}
+
+// SupportsFeature returns true if the server advertises the feature with the given OID
+func (d *RootDSE) SupportsFeature(oid string) bool {
+	return containsString(d.SupportedFeatures, oid)
+}
+
+// SupportsSASLMechanism returns true if the server advertises the given SASL
+// mechanism. Mechanism names are compared case-insensitively.
+func (d *RootDSE) SupportsSASLMechanism(mechanism string) bool {
+	return containsFold(d.SupportedSASLMechanisms, mechanism)
+}
+
+// SupportsLDAPVersion returns true if the server advertises the given protocol version
+func (d *RootDSE) SupportsLDAPVersion(version int) bool {
+	for _, v := range d.SupportedLDAPVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActiveDirectory returns true if the root DSE was published by an Active
+// Directory domain controller or AD LDS instance
+func (d *RootDSE) IsActiveDirectory() bool {
+	return len(d.SupportedCapabilities) > 0
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeTestSearchEntry(msgID int64, dn string, attributes map[string][]string) *ber.Packet {
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationSearchResultEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "Object Name"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range attributes {
+		attrs.AppendChild((&Attribute{Type: name, Vals: values}).encode())
+	}
+	entry.AppendChild(attrs)
+
+	response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+	response.AppendChild(entry)
+	return response
+}
+
+func encodeTestResult(msgID int64, application ber.Tag, resultCode uint16) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(resultCode), "resultCode"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+
+	response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+	response.AppendChild(result)
+	return response
+}
+
+func TestConn_RootDSE(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	go func() {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			return
+		}
+		msgID := req.Children[0].Value.(int64)
+		_ = ptc.SendResponse(encodeTestSearchEntry(msgID, "", map[string][]string{
+			"namingContexts":                {"DC=example,DC=com", "CN=Configuration,DC=example,DC=com"},
+			"supportedControl":              {ControlTypePaging, ControlTypeServerSideSorting},
+			"supportedExtension":            {ControlTypeWhoAmI},
+			"supportedLDAPVersion":          {"3", "2"},
+			"supportedSASLMechanisms":       {"GSSAPI", "GSS-SPNEGO"},
+			"supportedCapabilities":         {"1.2.840.113556.1.4.800"},
+			"defaultNamingContext":          {"DC=example,DC=com"},
+			"dnsHostName":                   {"dc1.example.com"},
+			"domainFunctionality":           {"7"},
+			"domainControllerFunctionality": {"10"},
+			"isGlobalCatalogReady":          {"TRUE"},
+			"isSynchronized":                {"FALSE"},
+		}))
+		_ = ptc.SendResponse(encodeTestResult(msgID, ApplicationSearchResultDone, LDAPResultSuccess))
+	}()
+
+	dse, err := conn.RootDSE(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"DC=example,DC=com", "CN=Configuration,DC=example,DC=com"}, dse.NamingContexts)
+	assert.True(t, dse.SupportsControl(ControlTypePaging))
+	assert.False(t, dse.SupportsControl(ControlTypeVLVRequest))
+	assert.True(t, dse.SupportsExtension(ControlTypeWhoAmI))
+	assert.True(t, dse.SupportsLDAPVersion(3))
+	assert.True(t, dse.SupportsSASLMechanism("gssapi"))
+	assert.False(t, dse.SupportsSASLMechanism("EXTERNAL"))
+	assert.True(t, dse.IsActiveDirectory())
+	assert.Equal(t, "DC=example,DC=com", dse.DefaultNamingContext)
+	assert.Equal(t, "dc1.example.com", dse.DNSHostName)
+	assert.Equal(t, 7, dse.DomainFunctionality)
+	assert.Equal(t, 10, dse.DomainControllerFunctionality)
+	assert.True(t, dse.IsGlobalCatalogReady)
+	assert.False(t, dse.IsSynchronized)
+}
+
+func TestParseRootDSE(t *testing.T) {
+	dse, err := ParseRootDSE(NewEntry("", map[string][]string{
+		"subschemaSubentry": {"cn=Subschema"},
+		"vendorName":        {"OpenLDAP"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "cn=Subschema", dse.SubschemaSubentry)
+	assert.Equal(t, "OpenLDAP", dse.VendorName)
+	assert.False(t, dse.IsActiveDirectory())
+	assert.Equal(t, 0, dse.DomainFunctionality)
+
+	_, err = ParseRootDSE(NewEntry("", map[string][]string{"supportedLDAPVersion": {"three"}}))
+	assert.Error(t, err)
+	_, err = ParseRootDSE(NewEntry("", map[string][]string{"domainFunctionality": {"x"}}))
+	assert.Error(t, err)
+}
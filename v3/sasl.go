@@ -0,0 +1,299 @@
+package ldap
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// SASLMechanism is the client side of a SASL mechanism as defined in
+// https://www.rfc-editor.org/rfc/rfc4422, used with Conn.SASLBind.
+//
+// Mechanisms which can negotiate a security layer additionally implement
+// SASLSecurityLayer.
+type SASLMechanism interface {
+	// Name returns the registered name of the mechanism, e.g. "GSSAPI"
+	Name() string
+	// Start returns the initial response of the client. A nil response is
+	// not sent at all, while an empty, non-nil response is sent as empty
+	// credentials.
+	Start() ([]byte, error)
+	// Next processes a challenge of the server and returns the response to
+	// it. Next is also called with non-empty additional data the server sends
+	// along with a successful result, in which case the response is ignored.
+	Next(challenge []byte) ([]byte, error)
+}
+
+// SASLSecurityLayer is implemented by a SASLMechanism which can negotiate
+// integrity or confidentiality protection of the connection. If a security
+// layer was negotiated, all messages following the successful bind are
+// wrapped as described in https://www.rfc-editor.org/rfc/rfc4422#section-3.7.
+type SASLSecurityLayer interface {
+	// SecurityLayer reports whether a security layer was negotiated and the
+	// maximum number of bytes which may be passed to Wrap at once, 0 meaning
+	// no limit.
+	SecurityLayer() (negotiated bool, maxSendSize int)
+	// Wrap protects data sent to the server
+	Wrap(data []byte) ([]byte, error)
+	// Unwrap verifies and returns data received from the server
+	Unwrap(data []byte) ([]byte, error)
+}
+
+// saslConfidentialityLayer is implemented by a SASLSecurityLayer which can
+// report whether it encrypts the messages or only protects their integrity
+type saslConfidentialityLayer interface {
+	confidential() bool
+}
+
+// SASLBindResult contains the response from the server
+type SASLBindResult struct {
+	Controls []Control
+}
+
+// AuthzID returns the authorization identity of the ControlAuthzIDResponse
+// returned by the server, if the bind was sent with a ControlAuthzIDRequest
+func (r *SASLBindResult) AuthzID() (string, bool) {
+	return authzIDFromControls(r.Controls)
+}
+
+// saslMaxBufferSize is the largest buffer accepted from the server once a
+// security layer is in effect
+const saslMaxBufferSize = 1<<24 - 1
+
+type saslBindRequest struct {
+	Mechanism   string
+	Credentials []byte
+	Controls    []Control
+}
+
+func (req *saslBindRequest) appendTo(envelope *ber.Packet) error {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationBindRequest, nil, "Bind Request")
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "User Name"))
+
+	auth := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, "", "authentication")
+	auth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, req.Mechanism, "SASL Mech"))
+	if req.Credentials != nil {
+		auth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(req.Credentials), "Credentials"))
+	}
+	request.AppendChild(auth)
+	envelope.AppendChild(request)
+	if len(req.Controls) > 0 {
+		envelope.AppendChild(encodeControls(req.Controls))
+	}
+	return nil
+}
+
+// SASLBind performs a SASL bind with the given mechanism, sending the
+// controls with every request of the exchange. The context is checked before
+// each step of the exchange, as binds can not be abandoned once sent.
+//
+// If the mechanism implements SASLSecurityLayer and negotiated a security
+// layer, it is installed on the connection after the bind succeeded. As the
+// connection switches to the security layer right after the final response,
+// there must be no outstanding requests during such a bind.
+func (l *Conn) SASLBind(ctx context.Context, mechanism SASLMechanism, controls []Control) (*SASLBindResult, error) {
+	if l == nil || l.conn == nil {
+		return nil, ErrNilConnection
+	}
+	securityLayer, _ := mechanism.(SASLSecurityLayer)
+
+	credentials, err := mechanism.Start()
+	if err != nil {
+		return nil, err
+	}
+	result := &SASLBindResult{Controls: make([]Control, 0)}
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		packet, err := l.bindStep(&saslBindRequest{
+			Mechanism:   mechanism.Name(),
+			Credentials: credentials,
+			Controls:    controls,
+		}, securityLayer)
+		if err != nil {
+			return result, err
+		}
+		if len(packet.Children) < 2 || packet.Children[1].Tag != ApplicationBindResponse || len(packet.Children[1].Children) < 3 {
+			return result, GetLDAPError(packet)
+		}
+		if len(packet.Children) == 3 {
+			for _, child := range packet.Children[2].Children {
+				decodedChild, decodeErr := DecodeControl(child)
+				if decodeErr != nil {
+					return result, fmt.Errorf("failed to decode child control: %s", decodeErr)
+				}
+				result.Controls = append(result.Controls, decodedChild)
+			}
+		}
+
+		response := packet.Children[1]
+		serverCredentials := saslServerCredentials(response)
+		resultCode, _ := response.Children[0].Value.(int64)
+		switch resultCode {
+		case LDAPResultSaslBindInProgress:
+			credentials, err = mechanism.Next(serverCredentials)
+			if err != nil {
+				return result, err
+			}
+			result.Controls = result.Controls[:0]
+		case LDAPResultSuccess:
+			if len(serverCredentials) > 0 {
+				if _, err := mechanism.Next(serverCredentials); err != nil {
+					return result, err
+				}
+			}
+			return result, nil
+		default:
+			return result, GetLDAPError(packet)
+		}
+	}
+}
+
+// bindStep sends one request of a multi-step bind like a SASL bind and
+// returns the response. If a security layer can be negotiated, the reader is
+// stopped after the response, so the security layer can be installed before
+// any further message is read.
+func (l *Conn) bindStep(req request, securityLayer SASLSecurityLayer) (*ber.Packet, error) {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, l.nextMessageID(), "MessageID"))
+	if err := req.appendTo(envelope); err != nil {
+		return nil, err
+	}
+	if l.Debug {
+		l.Debug.PrintPacket(envelope)
+	}
+
+	var flags sendMessageFlags
+	if securityLayer != nil {
+		// the reader has to stop after the response just like for StartTLS
+		flags |= startTLS
+	}
+	msgCtx, err := l.sendMessageWithFlags(envelope, flags)
+	if err != nil {
+		return nil, err
+	}
+	packet, err := l.readPacket(msgCtx)
+	if err != nil || securityLayer == nil {
+		l.finishMessage(msgCtx)
+		return packet, err
+	}
+
+	if len(packet.Children) >= 2 && len(packet.Children[1].Children) > 0 {
+		if resultCode, _ := packet.Children[1].Children[0].Value.(int64); resultCode == LDAPResultSuccess {
+			if negotiated, maxSendSize := securityLayer.SecurityLayer(); negotiated {
+				l.conn = &saslConn{Conn: l.conn, layer: securityLayer, maxSendSize: maxSendSize}
+			}
+		}
+	}
+	l.finishMessage(msgCtx)
+	go l.reader()
+	return packet, nil
+}
+
+// saslServerCredentials returns the serverSaslCreds of a bind response, or
+// nil if there are none
+func saslServerCredentials(response *ber.Packet) []byte {
+	for _, child := range response.Children[3:] {
+		if child.ClassType == ber.ClassContext && child.Tag == 7 {
+			if child.Data == nil || child.Data.Len() == 0 {
+				return []byte{}
+			}
+			return child.Data.Bytes()
+		}
+	}
+	return nil
+}
+
+// saslConn applies a SASL security layer to the messages sent and received
+// on the underlying connection
+type saslConn struct {
+	net.Conn
+	layer       SASLSecurityLayer
+	maxSendSize int
+	// buffered holds unwrapped data not read yet
+	buffered []byte
+}
+
+func (c *saslConn) Read(b []byte) (int, error) {
+	for len(c.buffered) == 0 {
+		var header [4]byte
+		if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+			return 0, err
+		}
+		size := binary.BigEndian.Uint32(header[:])
+		if size > saslMaxBufferSize {
+			return 0, fmt.Errorf("ldap: SASL buffer of %d bytes exceeds the maximum size", size)
+		}
+		wrapped := make([]byte, size)
+		if _, err := io.ReadFull(c.Conn, wrapped); err != nil {
+			return 0, err
+		}
+		data, err := c.layer.Unwrap(wrapped)
+		if err != nil {
+			return 0, err
+		}
+		c.buffered = data
+	}
+	n := copy(b, c.buffered)
+	c.buffered = c.buffered[n:]
+	return n, nil
+}
+
+func (c *saslConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		chunk := b[written:]
+		if c.maxSendSize > 0 && len(chunk) > c.maxSendSize {
+			chunk = chunk[:c.maxSendSize]
+		}
+		wrapped, err := c.layer.Wrap(chunk)
+		if err != nil {
+			return written, err
+		}
+		if len(wrapped) > saslMaxBufferSize {
+			return written, errors.New("ldap: wrapped SASL buffer exceeds the maximum size")
+		}
+		frame := make([]byte, 4+len(wrapped))
+		binary.BigEndian.PutUint32(frame, uint32(len(wrapped)))
+		copy(frame[4:], wrapped)
+		if _, err := c.Conn.Write(frame); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+	return written, nil
+}
+
+// saslPrep prepares a username or password as described in
+// https://www.rfc-editor.org/rfc/rfc4013, mapping non-ASCII spaces to
+// spaces, removing characters commonly mapped to nothing and rejecting
+// prohibited characters. Unicode normalization is not applied, so non-ASCII
+// strings should be passed in NFKC form.
+func saslPrep(s string) (string, error) {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\u00AD' || r == '\u034F' || r == '\u1806' || r >= '\u180B' && r <= '\u180D' ||
+			r >= '\u200B' && r <= '\u200D' || r == '\u2060' || r >= '\uFE00' && r <= '\uFE0F' || r == '\uFEFF':
+			// commonly mapped to nothing
+		case r > unicode.MaxASCII && unicode.Is(unicode.Zs, r):
+			b.WriteRune(' ')
+		case unicode.IsControl(r) || unicode.Is(unicode.Co, r) || unicode.Is(unicode.Cs, r) ||
+			r&0xFFFE == 0xFFFE || r >= '\uFDD0' && r <= '\uFDEF' || r == utf8.RuneError:
+			return "", fmt.Errorf("ldap: prohibited character %U in SASL string", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), nil
+}
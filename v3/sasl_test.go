@@ -0,0 +1,388 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSASLMechanism sends "hello", answers the challenge "challenge" with
+// "response" and expects "final" along with the successful result
+type testSASLMechanism struct {
+	final bool
+}
+
+func (m *testSASLMechanism) Name() string { return "X-TEST" }
+
+func (m *testSASLMechanism) Start() ([]byte, error) { return []byte("hello"), nil }
+
+func (m *testSASLMechanism) Next(challenge []byte) ([]byte, error) {
+	switch string(challenge) {
+	case "challenge":
+		return []byte("response"), nil
+	case "final":
+		m.final = true
+		return nil, nil
+	}
+	return nil, errors.New("unexpected challenge")
+}
+
+// testSASLSecurityLayerMechanism protects data by XORing it with 0x5a
+type testSASLSecurityLayerMechanism struct {
+	testSASLMechanism
+}
+
+func (m *testSASLSecurityLayerMechanism) SecurityLayer() (bool, int) { return true, 8 }
+
+func (m *testSASLSecurityLayerMechanism) Wrap(data []byte) ([]byte, error) {
+	return xorBytes(data), nil
+}
+
+func (m *testSASLSecurityLayerMechanism) Unwrap(data []byte) ([]byte, error) {
+	return xorBytes(data), nil
+}
+
+func xorBytes(data []byte) []byte {
+	result := make([]byte, len(data))
+	for i, c := range data {
+		result[i] = c ^ 0x5a
+	}
+	return result
+}
+
+// encodeTestResponse returns a response with the result and additional
+// children appended to it
+func encodeTestResponse(msgID int64, application ber.Tag, resultCode uint16, children ...*ber.Packet) *ber.Packet {
+	result := encodeTestResult(msgID, application, resultCode).Children[1]
+	for _, child := range children {
+		result.AppendChild(child)
+	}
+
+	response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+	response.AppendChild(result)
+	return response
+}
+
+func encodeTestBindResponse(msgID int64, resultCode uint16, serverCredentials string) *ber.Packet {
+	return encodeTestResponse(msgID, ApplicationBindResponse, resultCode,
+		ber.NewString(ber.ClassContext, ber.TypePrimitive, 7, serverCredentials, "serverSaslCreds"))
+}
+
+// serveTestSASLBind answers the requests of testSASLMechanism
+func serveTestSASLBind(t *testing.T, ptc *packetTranslatorConn) {
+	for _, step := range []struct {
+		credentials string
+		response    func(msgID int64) *ber.Packet
+	}{
+		{"hello", func(msgID int64) *ber.Packet {
+			return encodeTestBindResponse(msgID, LDAPResultSaslBindInProgress, "challenge")
+		}},
+		{"response", func(msgID int64) *ber.Packet {
+			response := encodeTestBindResponse(msgID, LDAPResultSuccess, "final")
+			response.AppendChild(encodeControls([]Control{NewControlManageDsaIT(false)}))
+			return response
+		}},
+	} {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		auth := req.Children[1].Children[2]
+		assert.Equal(t, "X-TEST", auth.Children[0].Value)
+		assert.Equal(t, step.credentials, auth.Children[1].Value)
+		_ = ptc.SendResponse(step.response(req.Children[0].Value.(int64)))
+	}
+}
+
+func TestConn_SASLBind(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	go serveTestSASLBind(t, ptc)
+
+	mechanism := &testSASLMechanism{}
+	result, err := conn.SASLBind(context.Background(), mechanism, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, mechanism.final)
+	if assert.Len(t, result.Controls, 1) {
+		assert.Equal(t, ControlTypeManageDsaIT, result.Controls[0].GetControlType())
+	}
+
+	go func() {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultInvalidCredentials, ""))
+	}()
+	_, err = conn.SASLBind(context.Background(), &testSASLMechanism{}, nil)
+	assert.True(t, IsErrorWithCode(err, LDAPResultInvalidCredentials))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = conn.SASLBind(ctx, &testSASLMechanism{}, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// receiveFrame reads a buffer protected by a SASL security layer
+func (c *packetTranslatorConn) receiveFrame() ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for !c.isClosed {
+		if c.requestBuf.Len() >= 4 {
+			size := int(binary.BigEndian.Uint32(c.requestBuf.Bytes()))
+			if c.requestBuf.Len() >= 4+size {
+				return c.requestBuf.Next(4 + size)[4:], nil
+			}
+		}
+		c.requestCond.Wait()
+	}
+	return nil, errPacketTranslatorConnClosed
+}
+
+func (c *packetTranslatorConn) sendFrame(data []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer c.responseCond.Broadcast()
+
+	_ = binary.Write(&c.responseBuf, binary.BigEndian, uint32(len(data)))
+	c.responseBuf.Write(data)
+}
+
+// serveTestWhoAmIFrames answers a WhoAmI request protected by the XOR
+// security layer
+func serveTestWhoAmIFrames(t *testing.T, ptc *packetTranslatorConn) {
+	// the request is split into frames of at most 8 bytes
+	var request bytes.Buffer
+	for {
+		frame, err := ptc.receiveFrame()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(frame) > 8 {
+			t.Errorf("frame of %d bytes exceeds the maximum send size", len(frame))
+		}
+		request.Write(xorBytes(frame))
+		if packet, err := ber.ReadPacket(bytes.NewReader(request.Bytes())); err == nil {
+			assert.Equal(t, ControlTypeWhoAmI, packet.Children[1].Children[0].Data.String())
+			response := encodeTestResponse(packet.Children[0].Value.(int64), ApplicationExtendedResponse, LDAPResultSuccess,
+				ber.NewString(ber.ClassContext, ber.TypePrimitive, 11, "dn:cn=test", "responseValue"))
+			// the response is sent in two frames
+			wrapped := xorBytes(response.Bytes())
+			ptc.sendFrame(wrapped[:5])
+			ptc.sendFrame(wrapped[5:])
+			return
+		} else if err != io.ErrUnexpectedEOF && err != io.EOF {
+			t.Error(err)
+			return
+		}
+	}
+}
+
+func TestConn_SASLBindSecurityLayer(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	go func() {
+		serveTestSASLBind(t, ptc)
+		serveTestWhoAmIFrames(t, ptc)
+	}()
+
+	if _, err := conn.SASLBind(context.Background(), &testSASLSecurityLayerMechanism{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	result, err := conn.WhoAmI(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "dn:cn=test", result.AuthzID)
+}
+
+type testGSSAPIClient struct {
+	deleted bool
+	options []int
+}
+
+func (c *testGSSAPIClient) InitSecContext(target string, token []byte) ([]byte, bool, error) {
+	return c.InitSecContextWithOptions(target, token, nil)
+}
+
+func (c *testGSSAPIClient) InitSecContextWithOptions(target string, token []byte, options []int) ([]byte, bool, error) {
+	if token == nil {
+		c.options = options
+		return []byte("ap-req " + target), true, nil
+	}
+	return nil, false, nil
+}
+
+func (c *testGSSAPIClient) NegotiateSaslAuth(token []byte, authzid string) ([]byte, error) {
+	return append(token, authzid...), nil
+}
+
+func (c *testGSSAPIClient) DeleteSecContext() error {
+	c.deleted = true
+	return nil
+}
+
+func TestConn_GSSAPIBind(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	serve := func() {
+		for _, step := range []struct {
+			credentials []string
+			response    string
+			resultCode  uint16
+		}{
+			{[]string{"ap-req ldap/host"}, "ap-rep", LDAPResultSaslBindInProgress},
+			{nil, "layers", LDAPResultSaslBindInProgress},
+			{[]string{"layersu:admin"}, "", LDAPResultSuccess},
+		} {
+			req, err := ptc.ReceiveRequest()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			var credentials []string
+			for _, child := range req.Children[1].Children[2].Children[1:] {
+				credentials = append(credentials, child.Value.(string))
+			}
+			assert.Equal(t, step.credentials, credentials)
+			_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), step.resultCode, step.response))
+		}
+	}
+
+	go serve()
+	client := &testGSSAPIClient{}
+	if err := conn.GSSAPIBind(client, "ldap/host", "u:admin"); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, client.deleted)
+
+	go serve()
+	client = &testGSSAPIClient{}
+	result, err := conn.GSSAPIBindWithResult(context.Background(), &GSSAPIBindRequest{
+		Client:               client,
+		ServicePrincipalName: "ldap/host",
+		AuthZID:              "u:admin",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, result.Controls)
+	assert.True(t, client.deleted)
+
+	// the arguments replace the fields of the request
+	go serve()
+	client, ignored := &testGSSAPIClient{}, &testGSSAPIClient{}
+	err = conn.GSSAPIBindRequestWithAPOptions(client, &GSSAPIBindRequest{
+		Client:               ignored,
+		ServicePrincipalName: "ldap/host",
+		AuthZID:              "u:admin",
+		APOptions:            []int{1},
+	}, []int{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{2}, client.options)
+	assert.False(t, ignored.deleted)
+
+	_, err = conn.GSSAPIBindWithResult(context.Background(), &GSSAPIBindRequest{ServicePrincipalName: "ldap/host"})
+	assert.Error(t, err)
+}
+
+// testGSSAPISecurityLayerClient protects data by XORing it with 0x5a
+type testGSSAPISecurityLayerClient struct {
+	testGSSAPIClient
+}
+
+func (c *testGSSAPISecurityLayerClient) NegotiateSaslAuthWithSecurityLayer(token []byte, authzid string, securityLayer byte, maxReceiveSize uint32) ([]byte, int, error) {
+	return append(append(token, securityLayer), authzid...), 8, nil
+}
+
+func (c *testGSSAPISecurityLayerClient) Wrap(data []byte, confidential bool) ([]byte, error) {
+	return xorBytes(data), nil
+}
+
+func (c *testGSSAPISecurityLayerClient) Unwrap(token []byte) ([]byte, error) {
+	return xorBytes(token), nil
+}
+
+func TestConn_GSSAPIBindSecurityLayer(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	go func() {
+		for _, step := range []struct {
+			credentials []string
+			response    string
+			resultCode  uint16
+		}{
+			{[]string{"ap-req ldap/host"}, "ap-rep", LDAPResultSaslBindInProgress},
+			{nil, "layers", LDAPResultSaslBindInProgress},
+			{[]string{"layers\x02u:admin"}, "", LDAPResultSuccess},
+		} {
+			req, err := ptc.ReceiveRequest()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			var credentials []string
+			for _, child := range req.Children[1].Children[2].Children[1:] {
+				credentials = append(credentials, child.Value.(string))
+			}
+			assert.Equal(t, step.credentials, credentials)
+			_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), step.resultCode, step.response))
+		}
+		serveTestWhoAmIFrames(t, ptc)
+	}()
+
+	client := &testGSSAPISecurityLayerClient{}
+	err := conn.GSSAPIBindRequest(client, &GSSAPIBindRequest{
+		ServicePrincipalName: "ldap/host",
+		AuthZID:              "u:admin",
+		SecurityLayer:        GSSAPISecurityLayerIntegrity,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, client.deleted)
+
+	result, err := conn.WhoAmI(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "dn:cn=test", result.AuthzID)
+
+	err = conn.GSSAPIBindRequest(&testGSSAPIClient{}, &GSSAPIBindRequest{SecurityLayer: GSSAPISecurityLayerConfidentiality})
+	assert.Error(t, err)
+}
@@ -0,0 +1,973 @@
+package ldap
+
+// This file contains the retrieval and parsing of the subschema subentry as
+// specified in rfc 4512
+//
+// https://www.rfc-editor.org/rfc/rfc4512#section-4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Attributes of the subschema subentry holding the schema definitions
+const (
+	SchemaAttributeTypes   = "attributeTypes"
+	SchemaObjectClasses    = "objectClasses"
+	SchemaMatchingRules    = "matchingRules"
+	SchemaLDAPSyntaxes     = "ldapSyntaxes"
+	SchemaDITContentRules  = "dITContentRules"
+	SchemaNameForms        = "nameForms"
+	subschemaSubentryAttr  = "subschemaSubentry"
+	subschemaObjectFilter  = "(objectClass=subschema)"
+	subschemaDefaultFilter = "(objectClass=*)"
+)
+
+// ObjectClassKind is the kind of an object class
+type ObjectClassKind int
+
+// Object class kinds as defined in https://www.rfc-editor.org/rfc/rfc4512#section-2.4
+const (
+	ObjectClassStructural ObjectClassKind = 0
+	ObjectClassAbstract   ObjectClassKind = 1
+	ObjectClassAuxiliary  ObjectClassKind = 2
+)
+
+// ObjectClassKindMap contains human readable descriptions of the object class kinds
+var ObjectClassKindMap = map[ObjectClassKind]string{
+	ObjectClassStructural: "STRUCTURAL",
+	ObjectClassAbstract:   "ABSTRACT",
+	ObjectClassAuxiliary:  "AUXILIARY",
+}
+
+// Attribute type usages as defined in https://www.rfc-editor.org/rfc/rfc4512#section-4.1.2
+const (
+	AttributeUsageUserApplications     = "userApplications"
+	AttributeUsageDirectoryOperation   = "directoryOperation"
+	AttributeUsageDistributedOperation = "distributedOperation"
+	AttributeUsageDSAOperation         = "dSAOperation"
+)
+
+// AttributeTypeDefinition is an AttributeTypeDescription as defined in
+// https://www.rfc-editor.org/rfc/rfc4512#section-4.1.2
+type AttributeTypeDefinition struct {
+	// OID is the numeric object identifier of the attribute type
+	OID string
+	// Names are the short names (descriptors) of the attribute type
+	Names []string
+	// Description is a short descriptive string
+	Description string
+	// Obsolete indicates the attribute type is not active
+	Obsolete bool
+	// Superior is the name or OID of the supertype, if any
+	Superior string
+	// Equality is the name or OID of the equality matching rule
+	Equality string
+	// Ordering is the name or OID of the ordering matching rule
+	Ordering string
+	// Substring is the name or OID of the substrings matching rule
+	Substring string
+	// Syntax is the numeric OID of the value syntax
+	Syntax string
+	// SyntaxLength is the suggested minimum upper bound of the value length, 0 if unset
+	SyntaxLength int
+	// SingleValue indicates the attribute type is restricted to a single value
+	SingleValue bool
+	// Collective indicates the attribute type is collective
+	Collective bool
+	// NoUserModification indicates the attribute type is not user modifiable
+	NoUserModification bool
+	// Usage is the application of the attribute type, userApplications by default
+	Usage string
+	// Extensions holds the X- extensions and their values
+	Extensions map[string][]string
+	// Raw is the definition as returned by the server
+	Raw string
+}
+
+// Name returns the first name of the attribute type or its OID if it has no name
+func (d *AttributeTypeDefinition) Name() string {
+	if len(d.Names) > 0 {
+		return d.Names[0]
+	}
+	return d.OID
+}
+
+// ObjectClassDefinition is an ObjectClassDescription as defined in
+// https://www.rfc-editor.org/rfc/rfc4512#section-4.1.1
+type ObjectClassDefinition struct {
+	// OID is the numeric object identifier of the object class
+	OID string
+	// Names are the short names (descriptors) of the object class
+	Names []string
+	// Description is a short descriptive string
+	Description string
+	// Obsolete indicates the object class is not active
+	Obsolete bool
+	// Superiors are the names or OIDs of the direct superclasses
+	Superiors []string
+	// Kind is the kind of the object class, STRUCTURAL by default
+	Kind ObjectClassKind
+	// Must lists the required attribute types
+	Must []string
+	// May lists the allowed attribute types
+	May []string
+	// Extensions holds the X- extensions and their values
+	Extensions map[string][]string
+	// Raw is the definition as returned by the server
+	Raw string
+}
+
+// Name returns the first name of the object class or its OID if it has no name
+func (d *ObjectClassDefinition) Name() string {
+	if len(d.Names) > 0 {
+		return d.Names[0]
+	}
+	return d.OID
+}
+
+// MatchingRuleDefinition is a MatchingRuleDescription as defined in
+// https://www.rfc-editor.org/rfc/rfc4512#section-4.1.3
+type MatchingRuleDefinition struct {
+	// OID is the numeric object identifier of the matching rule
+	OID string
+	// Names are the short names (descriptors) of the matching rule
+	Names []string
+	// Description is a short descriptive string
+	Description string
+	// Obsolete indicates the matching rule is not active
+	Obsolete bool
+	// Syntax is the numeric OID of the assertion syntax
+	Syntax string
+	// Extensions holds the X- extensions and their values
+	Extensions map[string][]string
+	// Raw is the definition as returned by the server
+	Raw string
+}
+
+// LDAPSyntaxDefinition is a SyntaxDescription as defined in
+// https://www.rfc-editor.org/rfc/rfc4512#section-4.1.5
+type LDAPSyntaxDefinition struct {
+	// OID is the numeric object identifier of the syntax
+	OID string
+	// Description is a short descriptive string
+	Description string
+	// Extensions holds the X- extensions and their values
+	Extensions map[string][]string
+	// Raw is the definition as returned by the server
+	Raw string
+}
+
+// DITContentRuleDefinition is a DITContentRuleDescription as defined in
+// https://www.rfc-editor.org/rfc/rfc4512#section-4.1.6
+type DITContentRuleDefinition struct {
+	// OID is the numeric object identifier of the structural object class the rule applies to
+	OID string
+	// Names are the short names (descriptors) of the rule
+	Names []string
+	// Description is a short descriptive string
+	Description string
+	// Obsolete indicates the rule is not active
+	Obsolete bool
+	// Auxiliary lists the auxiliary object classes allowed
+	Auxiliary []string
+	// Must lists the additional required attribute types
+	Must []string
+	// May lists the additional allowed attribute types
+	May []string
+	// Not lists the precluded attribute types
+	Not []string
+	// Extensions holds the X- extensions and their values
+	Extensions map[string][]string
+	// Raw is the definition as returned by the server
+	Raw string
+}
+
+// NameFormDefinition is a NameFormDescription as defined in
+// https://www.rfc-editor.org/rfc/rfc4512#section-4.1.7.2
+type NameFormDefinition struct {
+	// OID is the numeric object identifier of the name form
+	OID string
+	// Names are the short names (descriptors) of the name form
+	Names []string
+	// Description is a short descriptive string
+	Description string
+	// Obsolete indicates the name form is not active
+	Obsolete bool
+	// ObjectClass is the name or OID of the structural object class the name form applies to
+	ObjectClass string
+	// Must lists the attribute types required in the RDN
+	Must []string
+	// May lists the attribute types allowed in the RDN
+	May []string
+	// Extensions holds the X- extensions and their values
+	Extensions map[string][]string
+	// Raw is the definition as returned by the server
+	Raw string
+}
+
+// Schema holds the definitions published in a subschema subentry
+type Schema struct {
+	// DN is the distinguished name of the subschema subentry
+	DN string
+
+	AttributeTypes  []*AttributeTypeDefinition
+	ObjectClasses   []*ObjectClassDefinition
+	MatchingRules   []*MatchingRuleDefinition
+	LDAPSyntaxes    []*LDAPSyntaxDefinition
+	DITContentRules []*DITContentRuleDefinition
+	NameForms       []*NameFormDefinition
+
+	// Errors holds the errors of the definitions which could not be parsed
+	// and were skipped
+	Errors []error
+
+	// indexes by lowercased name and by OID
+	attributeTypes  map[string]*AttributeTypeDefinition
+	objectClasses   map[string]*ObjectClassDefinition
+	matchingRules   map[string]*MatchingRuleDefinition
+	ldapSyntaxes    map[string]*LDAPSyntaxDefinition
+	ditContentRules map[string]*DITContentRuleDefinition
+	nameForms       map[string]*NameFormDefinition
+}
+
+// SubschemaSubentry returns the DN of the subschema subentry controlling the
+// entry with the given DN. Use the empty DN to query the root DSE.
+func (l *Conn) SubschemaSubentry(ctx context.Context, dn string) (string, error) {
+	searchRequest := NewSearchRequest(dn, ScopeBaseObject, NeverDerefAliases, 0, 0, false,
+		subschemaDefaultFilter, []string{subschemaSubentryAttr}, nil)
+	entries, err := l.searchEntries(ctx, searchRequest)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) != 1 {
+		return "", NewError(ErrorUnexpectedResponse, fmt.Errorf("ldap: expected 1 entry for %q, got %d", dn, len(entries)))
+	}
+	subentry := entries[0].GetEqualFoldAttributeValue(subschemaSubentryAttr)
+	if subentry == "" {
+		return "", NewError(ErrorUnexpectedResponse, fmt.Errorf("ldap: no %s attribute returned for %q", subschemaSubentryAttr, dn))
+	}
+	return subentry, nil
+}
+
+// Schema reads and parses the subschema subentry with the given DN. If dn is
+// empty, the subschema subentry advertised by the root DSE is used.
+func (l *Conn) Schema(ctx context.Context, dn string) (*Schema, error) {
+	if dn == "" {
+		var err error
+		if dn, err = l.SubschemaSubentry(ctx, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	searchRequest := NewSearchRequest(dn, ScopeBaseObject, NeverDerefAliases, 0, 0, false,
+		subschemaObjectFilter, []string{
+			SchemaAttributeTypes,
+			SchemaObjectClasses,
+			SchemaMatchingRules,
+			SchemaLDAPSyntaxes,
+			SchemaDITContentRules,
+			SchemaNameForms,
+		}, nil)
+	entries, err := l.searchEntries(ctx, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, NewError(ErrorUnexpectedResponse, fmt.Errorf("ldap: expected 1 subschema entry for %q, got %d", dn, len(entries)))
+	}
+	return ParseSchema(entries[0]), nil
+}
+
+// ParseSchema parses the schema definitions held by the given subschema
+// subentry. Definitions which can not be parsed are skipped, their errors
+// are recorded in Errors.
+func ParseSchema(entry *Entry) *Schema {
+	s := &Schema{DN: entry.DN}
+	s.AttributeTypes = parseSchemaDefinitions(s, entry.GetEqualFoldAttributeValues(SchemaAttributeTypes), ParseAttributeTypeDefinition)
+	s.ObjectClasses = parseSchemaDefinitions(s, entry.GetEqualFoldAttributeValues(SchemaObjectClasses), ParseObjectClassDefinition)
+	s.MatchingRules = parseSchemaDefinitions(s, entry.GetEqualFoldAttributeValues(SchemaMatchingRules), ParseMatchingRuleDefinition)
+	s.LDAPSyntaxes = parseSchemaDefinitions(s, entry.GetEqualFoldAttributeValues(SchemaLDAPSyntaxes), ParseLDAPSyntaxDefinition)
+	s.DITContentRules = parseSchemaDefinitions(s, entry.GetEqualFoldAttributeValues(SchemaDITContentRules), ParseDITContentRuleDefinition)
+	s.NameForms = parseSchemaDefinitions(s, entry.GetEqualFoldAttributeValues(SchemaNameForms), ParseNameFormDefinition)
+	s.buildIndexes()
+	return s
+}
+
+// parseSchemaDefinitions parses the values of a schema attribute, recording
+// the errors in the schema
+func parseSchemaDefinitions[T any](s *Schema, values []string, parse func(string) (*T, error)) []*T {
+	var defs []*T
+	for _, raw := range values {
+		def, err := parse(raw)
+		if err != nil {
+			s.Errors = append(s.Errors, err)
+			continue
+		}
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+func (s *Schema) buildIndexes() {
+	s.attributeTypes = make(map[string]*AttributeTypeDefinition)
+	for _, def := range s.AttributeTypes {
+		indexDefinition(s.attributeTypes, def, def.OID, def.Names)
+	}
+	s.objectClasses = make(map[string]*ObjectClassDefinition)
+	for _, def := range s.ObjectClasses {
+		indexDefinition(s.objectClasses, def, def.OID, def.Names)
+	}
+	s.matchingRules = make(map[string]*MatchingRuleDefinition)
+	for _, def := range s.MatchingRules {
+		indexDefinition(s.matchingRules, def, def.OID, def.Names)
+	}
+	s.ldapSyntaxes = make(map[string]*LDAPSyntaxDefinition)
+	for _, def := range s.LDAPSyntaxes {
+		indexDefinition(s.ldapSyntaxes, def, def.OID, nil)
+	}
+	s.ditContentRules = make(map[string]*DITContentRuleDefinition)
+	for _, def := range s.DITContentRules {
+		indexDefinition(s.ditContentRules, def, def.OID, def.Names)
+	}
+	s.nameForms = make(map[string]*NameFormDefinition)
+	for _, def := range s.NameForms {
+		indexDefinition(s.nameForms, def, def.OID, def.Names)
+	}
+}
+
+func indexDefinition[T any](index map[string]T, def T, oid string, names []string) {
+	index[oid] = def
+	for _, name := range names {
+		index[strings.ToLower(name)] = def
+	}
+}
+
+func lookupDefinition[T any](index map[string]*T, nameOrOID string) *T {
+	if def, ok := index[nameOrOID]; ok {
+		return def
+	}
+	return index[strings.ToLower(nameOrOID)]
+}
+
+// AttributeType returns the attribute type with the given name or OID, or nil.
+// Names are compared case-insensitively.
+func (s *Schema) AttributeType(nameOrOID string) *AttributeTypeDefinition {
+	return lookupDefinition(s.attributeTypes, nameOrOID)
+}
+
+// ObjectClass returns the object class with the given name or OID, or nil.
+// Names are compared case-insensitively.
+func (s *Schema) ObjectClass(nameOrOID string) *ObjectClassDefinition {
+	return lookupDefinition(s.objectClasses, nameOrOID)
+}
+
+// MatchingRule returns the matching rule with the given name or OID, or nil.
+// Names are compared case-insensitively.
+func (s *Schema) MatchingRule(nameOrOID string) *MatchingRuleDefinition {
+	return lookupDefinition(s.matchingRules, nameOrOID)
+}
+
+// LDAPSyntax returns the syntax with the given OID, or nil
+func (s *Schema) LDAPSyntax(oid string) *LDAPSyntaxDefinition {
+	return lookupDefinition(s.ldapSyntaxes, oid)
+}
+
+// DITContentRule returns the DIT content rule with the given name or OID, or
+// nil. The OID of a DIT content rule is the OID of the structural object class
+// it applies to.
+func (s *Schema) DITContentRule(nameOrOID string) *DITContentRuleDefinition {
+	return lookupDefinition(s.ditContentRules, nameOrOID)
+}
+
+// NameForm returns the name form with the given name or OID, or nil.
+// Names are compared case-insensitively.
+func (s *Schema) NameForm(nameOrOID string) *NameFormDefinition {
+	return lookupDefinition(s.nameForms, nameOrOID)
+}
+
+// ObjectClassSuperiors returns all superclasses of the named object class,
+// nearest first, following SUP transitively. The class itself is not included.
+func (s *Schema) ObjectClassSuperiors(nameOrOID string) ([]*ObjectClassDefinition, error) {
+	oc := s.ObjectClass(nameOrOID)
+	if oc == nil {
+		return nil, fmt.Errorf("ldap: unknown object class %q", nameOrOID)
+	}
+
+	var superiors []*ObjectClassDefinition
+	seen := map[*ObjectClassDefinition]bool{oc: true}
+	queue := oc.Superiors
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		sup := s.ObjectClass(name)
+		if sup == nil {
+			return nil, fmt.Errorf("ldap: object class %q has unknown superclass %q", oc.Name(), name)
+		}
+		if sup == oc {
+			return nil, fmt.Errorf("ldap: object class %q is its own superclass", oc.Name())
+		}
+		if seen[sup] {
+			continue
+		}
+		seen[sup] = true
+		superiors = append(superiors, sup)
+		queue = append(queue, sup.Superiors...)
+	}
+	return superiors, nil
+}
+
+// ResolveObjectClass returns a copy of the named object class whose Must and
+// May lists include the attribute types inherited from all its superclasses.
+func (s *Schema) ResolveObjectClass(nameOrOID string) (*ObjectClassDefinition, error) {
+	superiors, err := s.ObjectClassSuperiors(nameOrOID)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *s.ObjectClass(nameOrOID)
+	resolved.Must = append([]string(nil), resolved.Must...)
+	resolved.May = append([]string(nil), resolved.May...)
+	for _, sup := range superiors {
+		resolved.Must = appendUniqueFold(resolved.Must, sup.Must...)
+		resolved.May = appendUniqueFold(resolved.May, sup.May...)
+	}
+	return &resolved, nil
+}
+
+// AttributeTypeSuperiors returns the supertypes of the named attribute type,
+// nearest first. The attribute type itself is not included.
+func (s *Schema) AttributeTypeSuperiors(nameOrOID string) ([]*AttributeTypeDefinition, error) {
+	at := s.AttributeType(nameOrOID)
+	if at == nil {
+		return nil, fmt.Errorf("ldap: unknown attribute type %q", nameOrOID)
+	}
+
+	var superiors []*AttributeTypeDefinition
+	seen := map[*AttributeTypeDefinition]bool{at: true}
+	for current := at; current.Superior != ""; {
+		sup := s.AttributeType(current.Superior)
+		if sup == nil {
+			return nil, fmt.Errorf("ldap: attribute type %q has unknown supertype %q", current.Name(), current.Superior)
+		}
+		if seen[sup] {
+			return nil, fmt.Errorf("ldap: attribute type %q has a cyclic supertype chain", at.Name())
+		}
+		seen[sup] = true
+		superiors = append(superiors, sup)
+		current = sup
+	}
+	return superiors, nil
+}
+
+// ResolveAttributeType returns a copy of the named attribute type where the
+// matching rules and syntax it does not define are inherited from its
+// supertypes, as described in https://www.rfc-editor.org/rfc/rfc4512#section-2.5.1
+func (s *Schema) ResolveAttributeType(nameOrOID string) (*AttributeTypeDefinition, error) {
+	superiors, err := s.AttributeTypeSuperiors(nameOrOID)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *s.AttributeType(nameOrOID)
+	for _, sup := range superiors {
+		if resolved.Equality == "" {
+			resolved.Equality = sup.Equality
+		}
+		if resolved.Ordering == "" {
+			resolved.Ordering = sup.Ordering
+		}
+		if resolved.Substring == "" {
+			resolved.Substring = sup.Substring
+		}
+		if resolved.Syntax == "" {
+			resolved.Syntax = sup.Syntax
+			resolved.SyntaxLength = sup.SyntaxLength
+		}
+	}
+	return &resolved, nil
+}
+
+func appendUniqueFold(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if strings.EqualFold(existing, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// ParseAttributeTypeDefinition parses an AttributeTypeDescription
+func ParseAttributeTypeDefinition(raw string) (*AttributeTypeDefinition, error) {
+	def := &AttributeTypeDefinition{Raw: raw, Usage: AttributeUsageUserApplications}
+	err := parseSchemaDefinition(raw, &def.OID, func(p *schemaParser, keyword string) error {
+		var err error
+		switch keyword {
+		case "NAME":
+			def.Names, err = p.qdescrs()
+		case "DESC":
+			def.Description, err = p.qdstring()
+		case "OBSOLETE":
+			def.Obsolete = true
+		case "SUP":
+			def.Superior, err = p.oid()
+		case "EQUALITY":
+			def.Equality, err = p.oid()
+		case "ORDERING":
+			def.Ordering, err = p.oid()
+		case "SUBSTR":
+			def.Substring, err = p.oid()
+		case "SYNTAX":
+			def.Syntax, def.SyntaxLength, err = p.noidlen()
+		case "SINGLE-VALUE":
+			def.SingleValue = true
+		case "COLLECTIVE":
+			def.Collective = true
+		case "NO-USER-MODIFICATION":
+			def.NoUserModification = true
+		case "USAGE":
+			def.Usage, err = p.oid()
+		default:
+			return errUnknownSchemaKeyword
+		}
+		return err
+	}, &def.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid attribute type definition %q: %w", raw, err)
+	}
+	return def, nil
+}
+
+// ParseObjectClassDefinition parses an ObjectClassDescription
+func ParseObjectClassDefinition(raw string) (*ObjectClassDefinition, error) {
+	def := &ObjectClassDefinition{Raw: raw, Kind: ObjectClassStructural}
+	err := parseSchemaDefinition(raw, &def.OID, func(p *schemaParser, keyword string) error {
+		var err error
+		switch keyword {
+		case "NAME":
+			def.Names, err = p.qdescrs()
+		case "DESC":
+			def.Description, err = p.qdstring()
+		case "OBSOLETE":
+			def.Obsolete = true
+		case "SUP":
+			def.Superiors, err = p.oids()
+		case "ABSTRACT":
+			def.Kind = ObjectClassAbstract
+		case "STRUCTURAL":
+			def.Kind = ObjectClassStructural
+		case "AUXILIARY":
+			def.Kind = ObjectClassAuxiliary
+		case "MUST":
+			def.Must, err = p.oids()
+		case "MAY":
+			def.May, err = p.oids()
+		default:
+			return errUnknownSchemaKeyword
+		}
+		return err
+	}, &def.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid object class definition %q: %w", raw, err)
+	}
+	return def, nil
+}
+
+// ParseMatchingRuleDefinition parses a MatchingRuleDescription
+func ParseMatchingRuleDefinition(raw string) (*MatchingRuleDefinition, error) {
+	def := &MatchingRuleDefinition{Raw: raw}
+	err := parseSchemaDefinition(raw, &def.OID, func(p *schemaParser, keyword string) error {
+		var err error
+		switch keyword {
+		case "NAME":
+			def.Names, err = p.qdescrs()
+		case "DESC":
+			def.Description, err = p.qdstring()
+		case "OBSOLETE":
+			def.Obsolete = true
+		case "SYNTAX":
+			def.Syntax, _, err = p.noidlen()
+		default:
+			return errUnknownSchemaKeyword
+		}
+		return err
+	}, &def.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid matching rule definition %q: %w", raw, err)
+	}
+	return def, nil
+}
+
+// ParseLDAPSyntaxDefinition parses a SyntaxDescription
+func ParseLDAPSyntaxDefinition(raw string) (*LDAPSyntaxDefinition, error) {
+	def := &LDAPSyntaxDefinition{Raw: raw}
+	err := parseSchemaDefinition(raw, &def.OID, func(p *schemaParser, keyword string) error {
+		var err error
+		switch keyword {
+		case "DESC":
+			def.Description, err = p.qdstring()
+		default:
+			return errUnknownSchemaKeyword
+		}
+		return err
+	}, &def.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid syntax definition %q: %w", raw, err)
+	}
+	return def, nil
+}
+
+// ParseDITContentRuleDefinition parses a DITContentRuleDescription
+func ParseDITContentRuleDefinition(raw string) (*DITContentRuleDefinition, error) {
+	def := &DITContentRuleDefinition{Raw: raw}
+	err := parseSchemaDefinition(raw, &def.OID, func(p *schemaParser, keyword string) error {
+		var err error
+		switch keyword {
+		case "NAME":
+			def.Names, err = p.qdescrs()
+		case "DESC":
+			def.Description, err = p.qdstring()
+		case "OBSOLETE":
+			def.Obsolete = true
+		case "AUX":
+			def.Auxiliary, err = p.oids()
+		case "MUST":
+			def.Must, err = p.oids()
+		case "MAY":
+			def.May, err = p.oids()
+		case "NOT":
+			def.Not, err = p.oids()
+		default:
+			return errUnknownSchemaKeyword
+		}
+		return err
+	}, &def.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid DIT content rule definition %q: %w", raw, err)
+	}
+	return def, nil
+}
+
+// ParseNameFormDefinition parses a NameFormDescription
+func ParseNameFormDefinition(raw string) (*NameFormDefinition, error) {
+	def := &NameFormDefinition{Raw: raw}
+	err := parseSchemaDefinition(raw, &def.OID, func(p *schemaParser, keyword string) error {
+		var err error
+		switch keyword {
+		case "NAME":
+			def.Names, err = p.qdescrs()
+		case "DESC":
+			def.Description, err = p.qdstring()
+		case "OBSOLETE":
+			def.Obsolete = true
+		case "OC":
+			def.ObjectClass, err = p.oid()
+		case "MUST":
+			def.Must, err = p.oids()
+		case "MAY":
+			def.May, err = p.oids()
+		default:
+			return errUnknownSchemaKeyword
+		}
+		return err
+	}, &def.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid name form definition %q: %w", raw, err)
+	}
+	if def.ObjectClass == "" {
+		return nil, fmt.Errorf("ldap: invalid name form definition %q: missing OC", raw)
+	}
+	return def, nil
+}
+
+var errUnknownSchemaKeyword = errors.New("unknown keyword")
+
+// parseSchemaDefinition parses the common structure of all definitions:
+// an opening parenthesis, the numeric OID, a list of keyword and value pairs
+// handled by fn or collected as X- extensions, and a closing parenthesis.
+func parseSchemaDefinition(raw string, oid *string, fn func(p *schemaParser, keyword string) error, extensions *map[string][]string) error {
+	p := &schemaParser{input: raw}
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	var err error
+	if *oid, err = p.word(); err != nil {
+		return err
+	}
+
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case tok.kind == schemaTokenClose:
+			if rest, _ := p.peek(); rest.kind != schemaTokenEOF {
+				return fmt.Errorf("unexpected %q after closing parenthesis at position %d", rest.value, rest.pos)
+			}
+			return nil
+		case tok.kind != schemaTokenWord:
+			return fmt.Errorf("expected keyword at position %d, got %q", tok.pos, tok.value)
+		case strings.HasPrefix(tok.value, "X-"):
+			values, err := p.qdstrings()
+			if err != nil {
+				return err
+			}
+			if *extensions == nil {
+				*extensions = make(map[string][]string)
+			}
+			(*extensions)[tok.value] = values
+		default:
+			if err := fn(p, tok.value); err != nil {
+				if errors.Is(err, errUnknownSchemaKeyword) {
+					return fmt.Errorf("%w %q at position %d", err, tok.value, tok.pos)
+				}
+				return err
+			}
+		}
+	}
+}
+
+type schemaTokenKind int
+
+const (
+	schemaTokenEOF schemaTokenKind = iota
+	schemaTokenOpen
+	schemaTokenClose
+	schemaTokenDollar
+	schemaTokenWord
+	schemaTokenQuoted
+)
+
+type schemaToken struct {
+	kind  schemaTokenKind
+	value string
+	pos   int
+}
+
+// schemaParser tokenizes the definitions of https://www.rfc-editor.org/rfc/rfc4512#section-4.1
+type schemaParser struct {
+	input string
+	pos   int
+}
+
+func (p *schemaParser) peek() (schemaToken, error) {
+	pos := p.pos
+	tok, err := p.next()
+	p.pos = pos
+	return tok, err
+}
+
+func (p *schemaParser) next() (schemaToken, error) {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t' || p.input[p.pos] == '\n' || p.input[p.pos] == '\r') {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.input) {
+		return schemaToken{kind: schemaTokenEOF, pos: start}, nil
+	}
+
+	switch c := p.input[p.pos]; c {
+	case '(':
+		p.pos++
+		return schemaToken{kind: schemaTokenOpen, value: "(", pos: start}, nil
+	case ')':
+		p.pos++
+		return schemaToken{kind: schemaTokenClose, value: ")", pos: start}, nil
+	case '$':
+		p.pos++
+		return schemaToken{kind: schemaTokenDollar, value: "$", pos: start}, nil
+	case '\'':
+		end := strings.IndexByte(p.input[p.pos+1:], '\'')
+		if end < 0 {
+			return schemaToken{}, fmt.Errorf("unterminated quoted string at position %d", start)
+		}
+		value, err := unescapeQDString(p.input[p.pos+1 : p.pos+1+end])
+		if err != nil {
+			return schemaToken{}, fmt.Errorf("invalid quoted string at position %d: %w", start, err)
+		}
+		p.pos += end + 2
+		return schemaToken{kind: schemaTokenQuoted, value: value, pos: start}, nil
+	default:
+		for p.pos < len(p.input) && !strings.ContainsRune(" \t\r\n()$'", rune(p.input[p.pos])) {
+			p.pos++
+		}
+		return schemaToken{kind: schemaTokenWord, value: p.input[start:p.pos], pos: start}, nil
+	}
+}
+
+func (p *schemaParser) expect(value string) error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+	if tok.value != value || tok.kind == schemaTokenQuoted {
+		return fmt.Errorf("expected %q at position %d, got %q", value, tok.pos, tok.value)
+	}
+	return nil
+}
+
+func (p *schemaParser) word() (string, error) {
+	tok, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if tok.kind != schemaTokenWord {
+		return "", fmt.Errorf("expected identifier at position %d, got %q", tok.pos, tok.value)
+	}
+	return tok.value, nil
+}
+
+// oid reads a single oid. Some servers (e.g. Active Directory) quote OIDs,
+// so quoted strings are accepted as well.
+func (p *schemaParser) oid() (string, error) {
+	tok, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if tok.kind != schemaTokenWord && tok.kind != schemaTokenQuoted {
+		return "", fmt.Errorf("expected oid at position %d, got %q", tok.pos, tok.value)
+	}
+	return tok.value, nil
+}
+
+// oids reads either a single oid or a $ separated list of oids in parentheses
+func (p *schemaParser) oids() ([]string, error) {
+	tok, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if tok.kind != schemaTokenOpen {
+		oid, err := p.oid()
+		if err != nil {
+			return nil, err
+		}
+		return []string{oid}, nil
+	}
+	p.pos = tok.pos + 1
+
+	var oids []string
+	for {
+		oid, err := p.oid()
+		if err != nil {
+			return nil, err
+		}
+		oids = append(oids, oid)
+
+		tok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch tok.kind {
+		case schemaTokenClose:
+			return oids, nil
+		case schemaTokenDollar:
+		case schemaTokenWord, schemaTokenQuoted:
+			// Tolerate lists missing the $ separator.
+			p.pos = tok.pos
+		default:
+			return nil, fmt.Errorf("expected \"$\" or \")\" at position %d, got %q", tok.pos, tok.value)
+		}
+	}
+}
+
+// noidlen reads a numeric OID optionally followed by a length bound in braces
+func (p *schemaParser) noidlen() (string, int, error) {
+	oid, err := p.oid()
+	if err != nil {
+		return "", 0, err
+	}
+	i := strings.IndexByte(oid, '{')
+	if i < 0 {
+		return oid, 0, nil
+	}
+	if !strings.HasSuffix(oid, "}") {
+		return "", 0, fmt.Errorf("invalid syntax length in %q", oid)
+	}
+	length, err := strconv.Atoi(oid[i+1 : len(oid)-1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid syntax length in %q: %w", oid, err)
+	}
+	return oid[:i], length, nil
+}
+
+func (p *schemaParser) qdstring() (string, error) {
+	tok, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if tok.kind != schemaTokenQuoted {
+		return "", fmt.Errorf("expected quoted string at position %d, got %q", tok.pos, tok.value)
+	}
+	return tok.value, nil
+}
+
+// qdstrings reads either a single quoted string or a list of them in parentheses
+func (p *schemaParser) qdstrings() ([]string, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch tok.kind {
+	case schemaTokenQuoted:
+		return []string{tok.value}, nil
+	case schemaTokenOpen:
+		var values []string
+		for {
+			tok, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			switch tok.kind {
+			case schemaTokenClose:
+				return values, nil
+			case schemaTokenQuoted:
+				values = append(values, tok.value)
+			default:
+				return nil, fmt.Errorf("expected quoted string at position %d, got %q", tok.pos, tok.value)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("expected quoted string at position %d, got %q", tok.pos, tok.value)
+	}
+}
+
+// qdescrs reads the NAME values, which are qdstrings holding descriptors
+func (p *schemaParser) qdescrs() ([]string, error) {
+	return p.qdstrings()
+}
+
+// unescapeQDString decodes the \27 and \5C escapes allowed in a dstring
+func unescapeQDString(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", errors.New("truncated escape")
+		}
+		switch strings.ToUpper(s[i+1 : i+3]) {
+		case "27":
+			b.WriteByte('\'')
+		case "5C":
+			b.WriteByte('\\')
+		default:
+			return "", fmt.Errorf("invalid escape %q", s[i:i+3])
+		}
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,274 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAttributeTypeDefinition(t *testing.T) {
+	def, err := ParseAttributeTypeDefinition("( 2.5.4.3 NAME ( 'cn' 'commonName' ) DESC 'RFC4519: common name(s) for which the entity is known by' SUP name EQUALITY caseIgnoreMatch SUBSTR caseIgnoreSubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15{64} SINGLE-VALUE X-ORIGIN ( 'RFC 4519' 'user defined' ) )")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "2.5.4.3", def.OID)
+	assert.Equal(t, []string{"cn", "commonName"}, def.Names)
+	assert.Equal(t, "cn", def.Name())
+	assert.Equal(t, "RFC4519: common name(s) for which the entity is known by", def.Description)
+	assert.Equal(t, "name", def.Superior)
+	assert.Equal(t, "caseIgnoreMatch", def.Equality)
+	assert.Equal(t, "caseIgnoreSubstringsMatch", def.Substring)
+	assert.Equal(t, "1.3.6.1.4.1.1466.115.121.1.15", def.Syntax)
+	assert.Equal(t, 64, def.SyntaxLength)
+	assert.True(t, def.SingleValue)
+	assert.Equal(t, AttributeUsageUserApplications, def.Usage)
+	assert.Equal(t, []string{"RFC 4519", "user defined"}, def.Extensions["X-ORIGIN"])
+
+	def, err = ParseAttributeTypeDefinition("( 2.5.18.1 NAME 'createTimestamp' EQUALITY generalizedTimeMatch ORDERING generalizedTimeOrderingMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.24 SINGLE-VALUE NO-USER-MODIFICATION USAGE directoryOperation )")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, def.NoUserModification)
+	assert.Equal(t, "generalizedTimeOrderingMatch", def.Ordering)
+	assert.Equal(t, AttributeUsageDirectoryOperation, def.Usage)
+
+	// Active Directory quotes the syntax OID
+	def, err = ParseAttributeTypeDefinition("( 1.2.840.113556.1.4.221 NAME 'sAMAccountName' SYNTAX '1.3.6.1.4.1.1466.115.121.1.15' SINGLE-VALUE )")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1.3.6.1.4.1.1466.115.121.1.15", def.Syntax)
+
+	def, err = ParseAttributeTypeDefinition(`( 1.1.1 NAME 'test' DESC 'it\27s a \5Cpath' )`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `it's a \path`, def.Description)
+}
+
+func TestParseAttributeTypeDefinitionErrors(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"2.5.4.3 NAME 'cn'",
+		"( 2.5.4.3 NAME 'cn'",
+		"( 2.5.4.3 NAME 'cn )",
+		"( 2.5.4.3 NAME 'cn' BOGUS )",
+		"( 2.5.4.3 NAME 'cn' SYNTAX 1.2.3{x} )",
+		"( 2.5.4.3 NAME 'cn' ) trailing",
+		`( 2.5.4.3 DESC 'bad \41 escape' )`,
+	} {
+		_, err := ParseAttributeTypeDefinition(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestParseObjectClassDefinition(t *testing.T) {
+	def, err := ParseObjectClassDefinition("( 2.5.6.6 NAME 'person' DESC 'RFC2256: a person' SUP top STRUCTURAL MUST ( sn $ cn ) MAY ( userPassword $ telephoneNumber $ seeAlso $ description ) )")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "2.5.6.6", def.OID)
+	assert.Equal(t, "person", def.Name())
+	assert.Equal(t, []string{"top"}, def.Superiors)
+	assert.Equal(t, ObjectClassStructural, def.Kind)
+	assert.Equal(t, []string{"sn", "cn"}, def.Must)
+	assert.Equal(t, []string{"userPassword", "telephoneNumber", "seeAlso", "description"}, def.May)
+
+	def, err = ParseObjectClassDefinition("( 2.5.6.0 NAME 'top' ABSTRACT MUST objectClass )")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ObjectClassAbstract, def.Kind)
+	assert.Equal(t, []string{"objectClass"}, def.Must)
+}
+
+func TestParseOtherDefinitions(t *testing.T) {
+	mr, err := ParseMatchingRuleDefinition("( 2.5.13.2 NAME 'caseIgnoreMatch' SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 )")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "2.5.13.2", mr.OID)
+	assert.Equal(t, []string{"caseIgnoreMatch"}, mr.Names)
+	assert.Equal(t, "1.3.6.1.4.1.1466.115.121.1.15", mr.Syntax)
+
+	syn, err := ParseLDAPSyntaxDefinition("( 1.3.6.1.4.1.1466.115.121.1.7 DESC 'Boolean' X-NOT-HUMAN-READABLE 'FALSE' )")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Boolean", syn.Description)
+	assert.Equal(t, []string{"FALSE"}, syn.Extensions["X-NOT-HUMAN-READABLE"])
+
+	cr, err := ParseDITContentRuleDefinition("( 2.5.6.6 NAME 'personRule' AUX ( posixAccount $ shadowAccount ) MUST uid NOT ( seeAlso ) )")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"posixAccount", "shadowAccount"}, cr.Auxiliary)
+	assert.Equal(t, []string{"uid"}, cr.Must)
+	assert.Equal(t, []string{"seeAlso"}, cr.Not)
+
+	nf, err := ParseNameFormDefinition("( 1.1.2 NAME 'personNameForm' OC person MUST cn )")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "person", nf.ObjectClass)
+	assert.Equal(t, []string{"cn"}, nf.Must)
+
+	_, err = ParseNameFormDefinition("( 1.1.2 NAME 'personNameForm' MUST cn )")
+	assert.Error(t, err)
+}
+
+func testSchemaEntry() *Entry {
+	return NewEntry("cn=Subschema", map[string][]string{
+		SchemaAttributeTypes: {
+			"( 2.5.4.41 NAME 'name' EQUALITY caseIgnoreMatch SUBSTR caseIgnoreSubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15{32768} )",
+			"( 2.5.4.3 NAME ( 'cn' 'commonName' ) SUP name )",
+			"( 2.5.4.4 NAME ( 'sn' 'surname' ) SUP name )",
+			"( 2.5.4.0 NAME 'objectClass' EQUALITY objectIdentifierMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.38 )",
+			"( 2.5.4.35 NAME 'userPassword' EQUALITY octetStringMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.40 )",
+			"( 0.9.2342.19200300.100.1.3 NAME ( 'mail' 'rfc822Mailbox' ) EQUALITY caseIgnoreIA5Match SYNTAX 1.3.6.1.4.1.1466.115.121.1.26 )",
+		},
+		SchemaObjectClasses: {
+			"( 2.5.6.0 NAME 'top' ABSTRACT MUST objectClass )",
+			"( 2.5.6.6 NAME 'person' SUP top STRUCTURAL MUST ( sn $ cn ) MAY userPassword )",
+			"( 2.5.6.7 NAME 'organizationalPerson' SUP person STRUCTURAL )",
+			"( 2.16.840.1.113730.3.2.2 NAME 'inetOrgPerson' SUP organizationalPerson STRUCTURAL MAY mail )",
+		},
+		SchemaMatchingRules: {
+			"( 2.5.13.2 NAME 'caseIgnoreMatch' SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 )",
+		},
+		SchemaLDAPSyntaxes: {
+			"( 1.3.6.1.4.1.1466.115.121.1.15 DESC 'Directory String' )",
+		},
+	})
+}
+
+func TestParseSchema(t *testing.T) {
+	schema := ParseSchema(testSchemaEntry())
+	assert.Equal(t, "cn=Subschema", schema.DN)
+	assert.Len(t, schema.AttributeTypes, 6)
+	assert.Len(t, schema.ObjectClasses, 4)
+
+	t.Run("lookup", func(t *testing.T) {
+		assert.Equal(t, "2.5.4.3", schema.AttributeType("CommonName").OID)
+		assert.Equal(t, "cn", schema.AttributeType("2.5.4.3").Name())
+		assert.Nil(t, schema.AttributeType("unknown"))
+		assert.Equal(t, "2.5.6.6", schema.ObjectClass("PERSON").OID)
+		assert.Equal(t, "caseIgnoreMatch", schema.MatchingRule("2.5.13.2").Names[0])
+		assert.Equal(t, "Directory String", schema.LDAPSyntax("1.3.6.1.4.1.1466.115.121.1.15").Description)
+		assert.Nil(t, schema.NameForm("unknown"))
+	})
+
+	t.Run("object class resolution", func(t *testing.T) {
+		superiors, err := schema.ObjectClassSuperiors("inetOrgPerson")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, sup := range superiors {
+			names = append(names, sup.Name())
+		}
+		assert.Equal(t, []string{"organizationalPerson", "person", "top"}, names)
+
+		resolved, err := schema.ResolveObjectClass("inetOrgPerson")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.ElementsMatch(t, []string{"sn", "cn", "objectClass"}, resolved.Must)
+		assert.ElementsMatch(t, []string{"mail", "userPassword"}, resolved.May)
+		assert.Empty(t, schema.ObjectClass("inetOrgPerson").Must, "resolution must not modify the schema")
+	})
+
+	t.Run("attribute type resolution", func(t *testing.T) {
+		resolved, err := schema.ResolveAttributeType("cn")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "caseIgnoreMatch", resolved.Equality)
+		assert.Equal(t, "1.3.6.1.4.1.1466.115.121.1.15", resolved.Syntax)
+		assert.Equal(t, 32768, resolved.SyntaxLength)
+		assert.Empty(t, schema.AttributeType("cn").Syntax, "resolution must not modify the schema")
+	})
+}
+
+func TestParseSchemaInvalidDefinitions(t *testing.T) {
+	schema := ParseSchema(NewEntry("cn=Subschema", map[string][]string{
+		SchemaAttributeTypes: {
+			"( 2.5.4.3 NAME 'cn' )",
+			"( 2.5.4.4 NAME 'sn' VENDOR-KEYWORD )",
+			"( 2.5.4.41 NAME 'name'",
+		},
+		SchemaObjectClasses: {
+			"( 2.5.6.6 NAME 'person' MUST cn )",
+		},
+	}))
+	assert.Len(t, schema.AttributeTypes, 1)
+	assert.NotNil(t, schema.AttributeType("cn"))
+	assert.Nil(t, schema.AttributeType("sn"))
+	assert.NotNil(t, schema.ObjectClass("person"))
+	assert.Len(t, schema.Errors, 2)
+}
+
+func TestConn_Schema(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	subentry := map[string][]string{}
+	for _, attr := range testSchemaEntry().Attributes {
+		subentry[attr.Name] = attr.Values
+	}
+	go func() {
+		for _, response := range []map[string][]string{
+			{subschemaSubentryAttr: {"cn=Subschema"}},
+			subentry,
+		} {
+			req, err := ptc.ReceiveRequest()
+			if err != nil {
+				return
+			}
+			msgID := req.Children[0].Value.(int64)
+			_ = ptc.SendResponse(encodeTestSearchEntry(msgID, req.Children[1].Children[0].Value.(string), response))
+			_ = ptc.SendResponse(encodeTestResult(msgID, ApplicationSearchResultDone, LDAPResultSuccess))
+		}
+	}()
+
+	schema, err := conn.Schema(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "cn=Subschema", schema.DN)
+	assert.Len(t, schema.AttributeTypes, 6)
+	assert.Empty(t, schema.Errors)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = conn.SubschemaSubentry(ctx, "")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSchemaCycles(t *testing.T) {
+	schema := ParseSchema(NewEntry("cn=Subschema", map[string][]string{
+		SchemaAttributeTypes: {
+			"( 1.1.1 NAME 'a' SUP b )",
+			"( 1.1.2 NAME 'b' SUP a )",
+		},
+		SchemaObjectClasses: {
+			"( 1.2.1 NAME 'x' SUP y )",
+			"( 1.2.2 NAME 'y' SUP x )",
+			"( 1.2.3 NAME 'z' SUP missing )",
+		},
+	}))
+
+	_, err := schema.ResolveAttributeType("a")
+	assert.Error(t, err)
+	_, err = schema.ResolveObjectClass("x")
+	assert.Error(t, err)
+	_, err = schema.ResolveObjectClass("z")
+	assert.Error(t, err)
+	_, err = schema.ResolveObjectClass("unknown")
+	assert.Error(t, err)
+}
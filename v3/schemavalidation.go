@@ -0,0 +1,577 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// SchemaViolationKind describes why a value or attribute does not conform to the schema
+type SchemaViolationKind int
+
+// Schema violation kinds
+const (
+	SchemaViolationUnknownAttribute   SchemaViolationKind = 1
+	SchemaViolationUnknownObjectClass SchemaViolationKind = 2
+	SchemaViolationNoStructuralClass  SchemaViolationKind = 3
+	SchemaViolationMissingRequired    SchemaViolationKind = 4
+	SchemaViolationNotAllowed         SchemaViolationKind = 5
+	SchemaViolationSingleValue        SchemaViolationKind = 6
+	SchemaViolationNoUserModification SchemaViolationKind = 7
+	SchemaViolationInvalidSyntax      SchemaViolationKind = 8
+	SchemaViolationNoValues           SchemaViolationKind = 9
+	SchemaViolationNamingAttribute    SchemaViolationKind = 10
+)
+
+// SchemaViolationKindMap contains human readable descriptions of the schema violation kinds
+var SchemaViolationKindMap = map[SchemaViolationKind]string{
+	SchemaViolationUnknownAttribute:   "Unknown Attribute Type",
+	SchemaViolationUnknownObjectClass: "Unknown Object Class",
+	SchemaViolationNoStructuralClass:  "No Single Structural Object Class",
+	SchemaViolationMissingRequired:    "Missing Required Attribute",
+	SchemaViolationNotAllowed:         "Attribute Not Allowed",
+	SchemaViolationSingleValue:        "Single-Valued Attribute Has Multiple Values",
+	SchemaViolationNoUserModification: "Attribute Not User Modifiable",
+	SchemaViolationInvalidSyntax:      "Invalid Attribute Syntax",
+	SchemaViolationNoValues:           "Attribute Has No Values",
+	SchemaViolationNamingAttribute:    "Naming Attribute Not Present",
+}
+
+// Well known syntaxes checked by the validator, see https://www.rfc-editor.org/rfc/rfc4517#section-3.3
+const (
+	SyntaxBoolean           = "1.3.6.1.4.1.1466.115.121.1.7"
+	SyntaxCountryString     = "1.3.6.1.4.1.1466.115.121.1.11"
+	SyntaxDN                = "1.3.6.1.4.1.1466.115.121.1.12"
+	SyntaxDirectoryString   = "1.3.6.1.4.1.1466.115.121.1.15"
+	SyntaxGeneralizedTime   = "1.3.6.1.4.1.1466.115.121.1.24"
+	SyntaxIA5String         = "1.3.6.1.4.1.1466.115.121.1.26"
+	SyntaxInteger           = "1.3.6.1.4.1.1466.115.121.1.27"
+	SyntaxNumericString     = "1.3.6.1.4.1.1466.115.121.1.36"
+	SyntaxOID               = "1.3.6.1.4.1.1466.115.121.1.38"
+	SyntaxOctetString       = "1.3.6.1.4.1.1466.115.121.1.40"
+	SyntaxPrintableString   = "1.3.6.1.4.1.1466.115.121.1.44"
+	SyntaxTelephoneNumber   = "1.3.6.1.4.1.1466.115.121.1.50"
+	objectClassAttribute    = "objectClass"
+	extensibleObjectClassID = "1.3.6.1.4.1.1466.101.120.111"
+)
+
+// SchemaViolation describes a single problem found by the schema validator
+type SchemaViolation struct {
+	// Kind is the kind of the violation
+	Kind SchemaViolationKind
+	// Attribute is the attribute description or object class the violation relates to
+	Attribute string
+	// Value is the offending value, if any
+	Value string
+	// Message gives details about the violation
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	s := fmt.Sprintf("%s: %s", v.Attribute, SchemaViolationKindMap[v.Kind])
+	if v.Message != "" {
+		s += ": " + v.Message
+	}
+	return s
+}
+
+// SchemaValidationError is returned by the schema validator and lists all
+// problems found in a request
+type SchemaValidationError struct {
+	// DN is the DN of the entry the request applies to
+	DN string
+	// Violations are the problems found, in request order
+	Violations []SchemaViolation
+}
+
+func (e *SchemaValidationError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+	return fmt.Sprintf("ldap: request for %q violates the schema: %s", e.DN, strings.Join(violations, "; "))
+}
+
+// HasViolation returns true if the error contains a violation of the given kind
+func (e *SchemaValidationError) HasViolation(kind SchemaViolationKind) bool {
+	for _, v := range e.Violations {
+		if v.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateAddRequest checks the given AddRequest against the object class
+// rules, the SINGLE-VALUE and NO-USER-MODIFICATION constraints and the syntaxes
+// of the schema. It returns a *SchemaValidationError listing all problems found,
+// or nil if the request conforms to the schema.
+func (s *Schema) ValidateAddRequest(req *AddRequest) error {
+	v := &schemaValidator{schema: s, err: &SchemaValidationError{DN: req.DN}}
+
+	entry := newValidatorEntry()
+	for _, attr := range req.Attributes {
+		at := v.attributeType(attr.Type)
+		if len(attr.Vals) == 0 {
+			v.add(SchemaViolationNoValues, attr.Type, "", "")
+		}
+		if at == nil {
+			continue
+		}
+		if at.NoUserModification {
+			v.add(SchemaViolationNoUserModification, attr.Type, "", "")
+		}
+		v.checkSyntax(attr.Type, at, attr.Vals)
+		entry.add(at, attr.Vals)
+	}
+
+	v.checkEntry(entry)
+	v.checkNamingAttributes(req.DN, entry)
+	return v.result()
+}
+
+// ValidateModifyRequest checks the given ModifyRequest against the schema. If
+// the current state of the entry is given, the changes are applied to it and the
+// resulting entry is checked against the object class rules and the SINGLE-VALUE
+// constraints. Without the current entry, only the attribute types, the
+// NO-USER-MODIFICATION constraints and the syntaxes of the values are checked.
+// The current entry must hold all user attributes, including objectClass.
+func (s *Schema) ValidateModifyRequest(req *ModifyRequest, current *Entry) error {
+	v := &schemaValidator{schema: s, err: &SchemaValidationError{DN: req.DN}}
+
+	var entry *validatorEntry
+	if current != nil {
+		entry = newValidatorEntry()
+		for _, attr := range current.Attributes {
+			if at := s.AttributeType(attributeTypeFromDescription(attr.Name)); at != nil {
+				entry.add(at, attr.Values)
+			}
+		}
+	}
+
+	for _, change := range req.Changes {
+		attr := change.Modification
+		at := v.attributeType(attr.Type)
+		if at == nil {
+			continue
+		}
+		if at.NoUserModification {
+			v.add(SchemaViolationNoUserModification, attr.Type, "", "")
+		}
+		v.checkSyntax(attr.Type, at, attr.Vals)
+
+		switch change.Operation {
+		case AddAttribute:
+			if len(attr.Vals) == 0 {
+				v.add(SchemaViolationNoValues, attr.Type, "", "")
+			}
+			if entry != nil {
+				entry.add(at, attr.Vals)
+			} else if at.SingleValue && len(attr.Vals) > 1 {
+				v.add(SchemaViolationSingleValue, attr.Type, "", "")
+			}
+		case DeleteAttribute:
+			if entry != nil {
+				entry.delete(at, attr.Vals)
+			}
+		case ReplaceAttribute:
+			if entry != nil {
+				entry.replace(at, attr.Vals)
+			} else if at.SingleValue && len(attr.Vals) > 1 {
+				v.add(SchemaViolationSingleValue, attr.Type, "", "")
+			}
+		case IncrementAttribute:
+			if len(attr.Vals) != 1 {
+				v.add(SchemaViolationSingleValue, attr.Type, "", "increment requires exactly one value")
+			}
+			if at.Syntax != SyntaxInteger {
+				v.add(SchemaViolationInvalidSyntax, attr.Type, "", "increment requires an attribute of INTEGER syntax")
+			}
+		}
+	}
+
+	if entry != nil {
+		v.checkEntry(entry)
+	}
+	return v.result()
+}
+
+type schemaValidator struct {
+	schema *Schema
+	err    *SchemaValidationError
+}
+
+func (v *schemaValidator) add(kind SchemaViolationKind, attribute, value, message string) {
+	v.err.Violations = append(v.err.Violations, SchemaViolation{
+		Kind:      kind,
+		Attribute: attribute,
+		Value:     value,
+		Message:   message,
+	})
+}
+
+func (v *schemaValidator) result() error {
+	if len(v.err.Violations) > 0 {
+		return v.err
+	}
+	return nil
+}
+
+// attributeType looks up the attribute type for an attribute description,
+// reporting a violation if it is unknown
+func (v *schemaValidator) attributeType(description string) *AttributeTypeDefinition {
+	name := attributeTypeFromDescription(description)
+	at, err := v.schema.ResolveAttributeType(name)
+	if err != nil {
+		v.add(SchemaViolationUnknownAttribute, description, "", err.Error())
+		return nil
+	}
+	return at
+}
+
+func (v *schemaValidator) checkSyntax(description string, at *AttributeTypeDefinition, values []string) {
+	check, ok := syntaxCheckers[at.Syntax]
+	if !ok {
+		return
+	}
+	for _, value := range values {
+		if err := check(value); err != "" {
+			v.add(SchemaViolationInvalidSyntax, description, value, err)
+		}
+	}
+}
+
+// checkEntry checks the object class rules and SINGLE-VALUE constraints of the
+// complete entry
+func (v *schemaValidator) checkEntry(entry *validatorEntry) {
+	for _, oid := range entry.order {
+		at := entry.types[oid]
+		if at.SingleValue && len(entry.values[oid]) > 1 {
+			v.add(SchemaViolationSingleValue, at.Name(), "", fmt.Sprintf("%d values", len(entry.values[oid])))
+		}
+	}
+
+	objectClassType := v.schema.AttributeType(objectClassAttribute)
+	var objectClasses []string
+	if objectClassType != nil {
+		objectClasses = entry.values[objectClassType.OID]
+	}
+	if len(objectClasses) == 0 {
+		v.add(SchemaViolationMissingRequired, objectClassAttribute, "", "")
+		return
+	}
+
+	var must, may []string
+	var structural []*ObjectClassDefinition
+	extensible := false
+	for _, name := range objectClasses {
+		oc, err := v.schema.ResolveObjectClass(name)
+		if err != nil {
+			v.add(SchemaViolationUnknownObjectClass, name, "", err.Error())
+			continue
+		}
+		if oc.OID == extensibleObjectClassID {
+			extensible = true
+		}
+		if oc.Kind == ObjectClassStructural {
+			structural = append(structural, oc)
+		}
+		must = appendUniqueFold(must, oc.Must...)
+		may = appendUniqueFold(may, oc.May...)
+	}
+
+	var not []string
+	if sc := v.structuralClass(structural); sc != nil {
+		if rule := v.schema.DITContentRule(sc.OID); rule != nil {
+			must = appendUniqueFold(must, rule.Must...)
+			may = appendUniqueFold(may, rule.May...)
+			not = rule.Not
+		}
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range must {
+		at := v.schema.AttributeType(name)
+		if at == nil {
+			continue
+		}
+		allowed[at.OID] = true
+		if len(entry.values[at.OID]) == 0 {
+			v.add(SchemaViolationMissingRequired, at.Name(), "", "")
+		}
+	}
+	for _, name := range may {
+		if at := v.schema.AttributeType(name); at != nil {
+			allowed[at.OID] = true
+		}
+	}
+	for _, name := range not {
+		if at := v.schema.AttributeType(name); at != nil {
+			allowed[at.OID] = false
+			if len(entry.values[at.OID]) > 0 {
+				v.add(SchemaViolationNotAllowed, at.Name(), "", "precluded by DIT content rule")
+			}
+		}
+	}
+
+	for _, oid := range entry.order {
+		at := entry.types[oid]
+		if len(entry.values[oid]) == 0 || allowed[oid] {
+			continue
+		}
+		if _, precluded := allowed[oid]; precluded {
+			continue
+		}
+		if at.Usage != AttributeUsageUserApplications || extensible || v.allowedBySuperior(at, allowed) {
+			continue
+		}
+		v.add(SchemaViolationNotAllowed, at.Name(), "", "not allowed by the object classes of the entry")
+	}
+}
+
+// allowedBySuperior returns true if a supertype of the attribute type is
+// allowed, which makes subtypes allowed as well (e.g. cn for name)
+func (v *schemaValidator) allowedBySuperior(at *AttributeTypeDefinition, allowed map[string]bool) bool {
+	superiors, err := v.schema.AttributeTypeSuperiors(at.OID)
+	if err != nil {
+		return false
+	}
+	for _, sup := range superiors {
+		if allowed[sup.OID] {
+			return true
+		}
+	}
+	return false
+}
+
+// structuralClass returns the structural object class of the entry, which is
+// the one all other structural classes are superclasses of. A violation is
+// reported if there is none.
+func (v *schemaValidator) structuralClass(structural []*ObjectClassDefinition) *ObjectClassDefinition {
+	for _, candidate := range structural {
+		superiors, err := v.schema.ObjectClassSuperiors(candidate.OID)
+		if err != nil {
+			continue
+		}
+		chain := map[string]bool{candidate.OID: true}
+		for _, sup := range superiors {
+			chain[sup.OID] = true
+		}
+		found := true
+		for _, other := range structural {
+			if !chain[other.OID] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return candidate
+		}
+	}
+	if len(structural) == 0 {
+		v.add(SchemaViolationNoStructuralClass, objectClassAttribute, "", "no structural object class")
+	} else {
+		v.add(SchemaViolationNoStructuralClass, objectClassAttribute, "", "structural object classes are not in the same superclass chain")
+	}
+	return nil
+}
+
+// checkNamingAttributes checks that the values of the RDN are present in the entry
+func (v *schemaValidator) checkNamingAttributes(dn string, entry *validatorEntry) {
+	parsed, err := ParseDN(dn)
+	if err != nil {
+		v.add(SchemaViolationInvalidSyntax, "dn", dn, err.Error())
+		return
+	}
+	if len(parsed.RDNs) == 0 {
+		return
+	}
+	for _, ava := range parsed.RDNs[0].Attributes {
+		at := v.schema.AttributeType(ava.Type)
+		if at == nil {
+			v.add(SchemaViolationUnknownAttribute, ava.Type, "", "naming attribute is not defined in the schema")
+			continue
+		}
+		if !containsFold(entry.values[at.OID], ava.Value) {
+			v.add(SchemaViolationNamingAttribute, ava.Type, ava.Value, "")
+		}
+	}
+}
+
+// validatorEntry holds the attribute values of an entry keyed by attribute type OID
+type validatorEntry struct {
+	order  []string
+	types  map[string]*AttributeTypeDefinition
+	values map[string][]string
+}
+
+func newValidatorEntry() *validatorEntry {
+	return &validatorEntry{
+		types:  make(map[string]*AttributeTypeDefinition),
+		values: make(map[string][]string),
+	}
+}
+
+func (e *validatorEntry) add(at *AttributeTypeDefinition, values []string) {
+	if _, ok := e.types[at.OID]; !ok {
+		e.order = append(e.order, at.OID)
+		e.types[at.OID] = at
+	}
+	for _, value := range values {
+		if !containsFold(e.values[at.OID], value) {
+			e.values[at.OID] = append(e.values[at.OID], value)
+		}
+	}
+}
+
+func (e *validatorEntry) delete(at *AttributeTypeDefinition, values []string) {
+	if len(values) == 0 {
+		delete(e.values, at.OID)
+		return
+	}
+	var remaining []string
+	for _, existing := range e.values[at.OID] {
+		if !containsFold(values, existing) {
+			remaining = append(remaining, existing)
+		}
+	}
+	e.values[at.OID] = remaining
+}
+
+func (e *validatorEntry) replace(at *AttributeTypeDefinition, values []string) {
+	delete(e.values, at.OID)
+	e.add(at, values)
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeTypeFromDescription strips the options from an attribute description,
+// e.g. "cn;lang-de" becomes "cn"
+func attributeTypeFromDescription(description string) string {
+	if i := strings.IndexByte(description, ';'); i >= 0 {
+		return description[:i]
+	}
+	return description
+}
+
+// syntaxCheckers validate values of well known syntaxes, returning a
+// description of the problem or an empty string if the value is valid
+var syntaxCheckers = map[string]func(value string) string{
+	SyntaxBoolean: func(value string) string {
+		if value != "TRUE" && value != "FALSE" {
+			return "expected TRUE or FALSE"
+		}
+		return ""
+	},
+	SyntaxCountryString: func(value string) string {
+		if len(value) != 2 || !isPrintableString(value) {
+			return "expected a two letter country code"
+		}
+		return ""
+	},
+	SyntaxDN: func(value string) string {
+		if _, err := ParseDN(value); err != nil {
+			return err.Error()
+		}
+		return ""
+	},
+	SyntaxDirectoryString: func(value string) string {
+		if value == "" {
+			return "empty value"
+		}
+		if !utf8.ValidString(value) {
+			return "invalid UTF-8"
+		}
+		return ""
+	},
+	SyntaxGeneralizedTime: func(value string) string {
+		if _, err := ber.ParseGeneralizedTime([]byte(value)); err != nil {
+			return "invalid generalized time"
+		}
+		return ""
+	},
+	SyntaxIA5String: func(value string) string {
+		for i := 0; i < len(value); i++ {
+			if value[i] >= 0x80 {
+				return "non IA5 character"
+			}
+		}
+		return ""
+	},
+	SyntaxInteger: func(value string) string {
+		digits := strings.TrimPrefix(value, "-")
+		if digits == "" || strings.Trim(digits, "0123456789") != "" {
+			return "expected an integer"
+		}
+		if len(digits) > 1 && digits[0] == '0' || value == "-0" {
+			return "leading zeros are not allowed"
+		}
+		return ""
+	},
+	SyntaxNumericString: func(value string) string {
+		if value == "" || strings.Trim(value, "0123456789 ") != "" {
+			return "expected digits and spaces"
+		}
+		return ""
+	},
+	SyntaxOID: func(value string) string {
+		if !isNumericOID(value) && !isDescriptor(value) {
+			return "expected a numeric OID or descriptor"
+		}
+		return ""
+	},
+	SyntaxPrintableString: func(value string) string {
+		if value == "" || !isPrintableString(value) {
+			return "non printable character"
+		}
+		return ""
+	},
+	SyntaxTelephoneNumber: func(value string) string {
+		if strings.TrimSpace(value) == "" || !isPrintableString(value) {
+			return "expected a printable telephone number"
+		}
+		return ""
+	},
+}
+
+func isPrintableString(value string) bool {
+	for _, c := range value {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune(`'()+,-./:? =`, c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isNumericOID(value string) bool {
+	for _, arc := range strings.Split(value, ".") {
+		if arc == "" || strings.Trim(arc, "0123456789") != "" || len(arc) > 1 && arc[0] == '0' {
+			return false
+		}
+	}
+	return strings.Contains(value, ".")
+}
+
+func isDescriptor(value string) bool {
+	if value == "" || !(value[0] >= 'a' && value[0] <= 'z' || value[0] >= 'A' && value[0] <= 'Z') {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testValidationSchema(t *testing.T) *Schema {
+	entry := testSchemaEntry()
+	for _, attr := range entry.Attributes {
+		switch attr.Name {
+		case SchemaAttributeTypes:
+			attr.Values = append(attr.Values,
+				"( 1.3.6.1.1.1.1.0 NAME 'uidNumber' EQUALITY integerMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.27 SINGLE-VALUE )",
+				"( 2.5.18.1 NAME 'createTimestamp' SYNTAX 1.3.6.1.4.1.1466.115.121.1.24 SINGLE-VALUE NO-USER-MODIFICATION USAGE directoryOperation )",
+				"( 2.16.840.1.113730.3.1.241 NAME 'displayName' SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 SINGLE-VALUE )",
+				"( 2.5.4.20 NAME 'telephoneNumber' SYNTAX 1.3.6.1.4.1.1466.115.121.1.50 )",
+			)
+		case SchemaObjectClasses:
+			for i, value := range attr.Values {
+				if value == "( 2.16.840.1.113730.3.2.2 NAME 'inetOrgPerson' SUP organizationalPerson STRUCTURAL MAY mail )" {
+					attr.Values[i] = "( 2.16.840.1.113730.3.2.2 NAME 'inetOrgPerson' SUP organizationalPerson STRUCTURAL MAY ( mail $ displayName $ telephoneNumber ) )"
+				}
+			}
+			attr.Values = append(attr.Values,
+				"( 1.3.6.1.1.1.2.0 NAME 'posixAccount' SUP top AUXILIARY MUST uidNumber )",
+				"( 2.5.6.2 NAME 'country' SUP top STRUCTURAL MUST c )",
+			)
+		}
+	}
+	schema := ParseSchema(entry)
+	return schema
+}
+
+func violationKinds(err error) []SchemaViolationKind {
+	var validationErr *SchemaValidationError
+	if !errors.As(err, &validationErr) {
+		return nil
+	}
+	var kinds []SchemaViolationKind
+	for _, v := range validationErr.Violations {
+		kinds = append(kinds, v.Kind)
+	}
+	return kinds
+}
+
+func TestSchema_ValidateAddRequest(t *testing.T) {
+	schema := testValidationSchema(t)
+
+	t.Run("valid", func(t *testing.T) {
+		req := NewAddRequest("cn=Jane Doe,dc=example,dc=com", nil)
+		req.Attribute("objectClass", []string{"top", "inetOrgPerson", "posixAccount"})
+		req.Attribute("cn", []string{"Jane Doe"})
+		req.Attribute("sn", []string{"Doe"})
+		req.Attribute("mail;x-work", []string{"jane@example.com"})
+		req.Attribute("uidNumber", []string{"1000"})
+		req.Attribute("telephoneNumber", []string{"+1 555 1234"})
+		assert.NoError(t, schema.ValidateAddRequest(req))
+	})
+
+	t.Run("violations", func(t *testing.T) {
+		req := NewAddRequest("cn=John Doe,dc=example,dc=com", nil)
+		req.Attribute("objectClass", []string{"inetOrgPerson", "posixAccount", "unknownClass"})
+		req.Attribute("cn", []string{"Jane Doe"})
+		req.Attribute("displayName", []string{"Jane", "Janie"})
+		req.Attribute("uidNumber", []string{"01000"})
+		req.Attribute("createTimestamp", []string{"20240101000000Z"})
+		req.Attribute("unknownAttr", []string{"value"})
+		req.Attribute("c", []string{"DE"})
+		err := schema.ValidateAddRequest(req)
+		assert.ElementsMatch(t, []SchemaViolationKind{
+			SchemaViolationUnknownAttribute,
+			SchemaViolationUnknownAttribute,
+			SchemaViolationInvalidSyntax,
+			SchemaViolationNoUserModification,
+			SchemaViolationSingleValue,
+			SchemaViolationUnknownObjectClass,
+			SchemaViolationMissingRequired,
+			SchemaViolationNamingAttribute,
+		}, violationKinds(err))
+		assert.Contains(t, err.Error(), "sn: Missing Required Attribute")
+	})
+
+	t.Run("not allowed and structural", func(t *testing.T) {
+		req := NewAddRequest("cn=Jane Doe,dc=example,dc=com", nil)
+		req.Attribute("objectClass", []string{"person", "posixAccount"})
+		req.Attribute("cn", []string{"Jane Doe"})
+		req.Attribute("sn", []string{"Doe"})
+		req.Attribute("uidNumber", []string{"1000"})
+		req.Attribute("mail", []string{"jane@example.com"})
+		assert.Equal(t, []SchemaViolationKind{SchemaViolationNotAllowed}, violationKinds(schema.ValidateAddRequest(req)))
+
+		req = NewAddRequest("uidNumber=1,dc=example,dc=com", nil)
+		req.Attribute("objectClass", []string{"posixAccount"})
+		req.Attribute("uidNumber", []string{"1"})
+		assert.Equal(t, []SchemaViolationKind{SchemaViolationNoStructuralClass}, violationKinds(schema.ValidateAddRequest(req)))
+	})
+}
+
+func TestSchema_ValidateModifyRequest(t *testing.T) {
+	schema := testValidationSchema(t)
+	current := NewEntry("cn=Jane Doe,dc=example,dc=com", map[string][]string{
+		"objectClass":     {"top", "inetOrgPerson"},
+		"cn":              {"Jane Doe"},
+		"sn":              {"Doe"},
+		"displayName":     {"Jane"},
+		"createTimestamp": {"20240101000000Z"},
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		req := NewModifyRequest(current.DN, nil)
+		req.Replace("displayName", []string{"Janie"})
+		req.Add("mail", []string{"jane@example.com"})
+		req.Add("objectClass", []string{"posixAccount"})
+		req.Add("uidNumber", []string{"1000"})
+		assert.NoError(t, schema.ValidateModifyRequest(req, current))
+	})
+
+	t.Run("resulting entry", func(t *testing.T) {
+		req := NewModifyRequest(current.DN, nil)
+		req.Delete("sn", nil)
+		req.Add("displayName", []string{"Janie"})
+		req.Add("objectClass", []string{"posixAccount"})
+		assert.ElementsMatch(t, []SchemaViolationKind{
+			SchemaViolationSingleValue,
+			SchemaViolationMissingRequired,
+			SchemaViolationMissingRequired,
+		}, violationKinds(schema.ValidateModifyRequest(req, current)))
+	})
+
+	t.Run("without current entry", func(t *testing.T) {
+		req := NewModifyRequest(current.DN, nil)
+		req.Delete("sn", nil)
+		req.Replace("displayName", []string{"a", "b"})
+		req.Replace("createTimestamp", []string{"20240101000000Z"})
+		req.Replace("uidNumber", []string{"abc"})
+		req.Increment("cn", "1")
+		assert.ElementsMatch(t, []SchemaViolationKind{
+			SchemaViolationSingleValue,
+			SchemaViolationNoUserModification,
+			SchemaViolationInvalidSyntax,
+			SchemaViolationInvalidSyntax,
+		}, violationKinds(schema.ValidateModifyRequest(req, nil)))
+	})
+}
+
+func TestSyntaxCheckers(t *testing.T) {
+	tests := []struct {
+		syntax string
+		value  string
+		valid  bool
+	}{
+		{SyntaxBoolean, "TRUE", true},
+		{SyntaxBoolean, "true", false},
+		{SyntaxInteger, "-42", true},
+		{SyntaxInteger, "0", true},
+		{SyntaxInteger, "-0", false},
+		{SyntaxInteger, "007", false},
+		{SyntaxInteger, "1e3", false},
+		{SyntaxDN, "cn=a,dc=example", true},
+		{SyntaxDN, "invalid", false},
+		{SyntaxGeneralizedTime, "20240101120000Z", true},
+		{SyntaxGeneralizedTime, "2024-01-01", false},
+		{SyntaxNumericString, "123 456", true},
+		{SyntaxNumericString, "12a", false},
+		{SyntaxIA5String, "plain ascii", true},
+		{SyntaxIA5String, "ümlaut", false},
+		{SyntaxPrintableString, "Hello (World)", true},
+		{SyntaxPrintableString, "a@b", false},
+		{SyntaxDirectoryString, "ümlaut", true},
+		{SyntaxDirectoryString, "", false},
+		{SyntaxOID, "1.2.840.113556", true},
+		{SyntaxOID, "inetOrgPerson", true},
+		{SyntaxOID, "1.02", false},
+		{SyntaxCountryString, "DE", true},
+		{SyntaxCountryString, "DEU", false},
+		{SyntaxTelephoneNumber, "+1 555 1234", true},
+		{SyntaxTelephoneNumber, " ", false},
+	}
+	for _, test := range tests {
+		problem := syntaxCheckers[test.syntax](test.value)
+		assert.Equal(t, test.valid, problem == "", "%s %q: %s", test.syntax, test.value, problem)
+	}
+}
@@ -0,0 +1,281 @@
+package ldap
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// SCRAM mechanisms, see https://www.rfc-editor.org/rfc/rfc5802 and
+// https://www.rfc-editor.org/rfc/rfc7677
+const (
+	SCRAMSHA1       = "SCRAM-SHA-1"
+	SCRAMSHA1Plus   = "SCRAM-SHA-1-PLUS"
+	SCRAMSHA256     = "SCRAM-SHA-256"
+	SCRAMSHA256Plus = "SCRAM-SHA-256-PLUS"
+)
+
+// scramMaxIterations limits the iteration count requested by the server, so
+// a malicious server can not make the client compute PBKDF2 indefinitely
+const scramMaxIterations = 10000000
+
+// ErrSCRAMServerSignature is returned if the server could not prove that it
+// knows the credentials of the user
+var ErrSCRAMServerSignature = errors.New("ldap: SCRAM server signature verification failed")
+
+// SCRAMBindRequest represents a SCRAM SASL bind request
+type SCRAMBindRequest struct {
+	// Mechanism is one of SCRAMSHA1, SCRAMSHA1Plus, SCRAMSHA256 and SCRAMSHA256Plus
+	Mechanism string
+	// Username is the authentication identity, usually not a DN
+	Username string
+	// Password is the credentials to bind with
+	Password string
+	// (Optional) Authorization identity
+	AuthZID string
+	// (Optional) ChannelBinding is the channel binding type of the -PLUS
+	// mechanisms, ChannelBindingTLSServerEndPoint or ChannelBindingTLSExporter.
+	// Defaults to tls-exporter for TLS 1.3 and tls-server-end-point otherwise.
+	ChannelBinding string
+	// (Optional) ServerWithoutChannelBinding is set if the
+	// SupportedSASLMechanisms of the RootDSE offer no -PLUS mechanism. Over
+	// TLS, the other mechanisms then tell the server that the client supports
+	// channel binding, which lets it detect downgrade attacks. Servers which
+	// support channel binding fail the exchange if it is set wrongly.
+	ServerWithoutChannelBinding bool
+	// (Optional) Controls to send with the bind request
+	Controls []Control
+}
+
+// SCRAMBind performs a SCRAM SASL bind with the given mechanism, username and password
+func (l *Conn) SCRAMBind(mechanism, username, password string) error {
+	_, err := l.SCRAMBindWithResult(context.Background(), &SCRAMBindRequest{
+		Mechanism: mechanism,
+		Username:  username,
+		Password:  password,
+	})
+	return err
+}
+
+// SCRAMBindWithResult performs the SCRAM SASL bind defined in the given request.
+// The -PLUS mechanisms require a TLS connection, see ServerWithoutChannelBinding
+// for the other mechanisms over TLS.
+func (l *Conn) SCRAMBindWithResult(ctx context.Context, req *SCRAMBindRequest) (*SASLBindResult, error) {
+	if l == nil || l.conn == nil {
+		return nil, ErrNilConnection
+	}
+	if req.Password == "" {
+		return nil, NewError(ErrorEmptyPassword, errors.New("ldap: empty password not allowed by the client"))
+	}
+	state, isTLS := l.TLSConnectionState()
+
+	mechanism, err := newSCRAMMechanism(req, state, isTLS)
+	if err != nil {
+		return nil, err
+	}
+	result, err := l.SASLBind(ctx, mechanism, req.Controls)
+	switch {
+	case IsErrorWithCode(err, LDAPResultAuthMethodNotSupported):
+		return result, NewError(LDAPResultAuthMethodNotSupported, fmt.Errorf("ldap: the server does not support the SASL mechanism %s: %w", req.Mechanism, err))
+	case err != nil:
+		return result, err
+	case !mechanism.verified:
+		// the bind succeeded without the server proving its identity
+		return result, ErrSCRAMServerSignature
+	}
+	return result, nil
+}
+
+// scramMechanism is the client side of the SCRAM SASL mechanisms
+type scramMechanism struct {
+	name     string
+	hash     func() hash.Hash
+	username string
+	password string
+
+	// gs2Header and channelBinding form the cbind-input of the client-final-message
+	gs2Header      string
+	channelBinding []byte
+
+	nonce           string
+	clientFirstBare string
+	serverSignature []byte
+	verified        bool
+}
+
+func newSCRAMMechanism(req *SCRAMBindRequest, state tls.ConnectionState, isTLS bool) (*scramMechanism, error) {
+	m := &scramMechanism{name: req.Mechanism}
+	plus := false
+	switch req.Mechanism {
+	case SCRAMSHA1:
+		m.hash = sha1.New
+	case SCRAMSHA1Plus:
+		m.hash, plus = sha1.New, true
+	case SCRAMSHA256:
+		m.hash = sha256.New
+	case SCRAMSHA256Plus:
+		m.hash, plus = sha256.New, true
+	default:
+		return nil, fmt.Errorf("ldap: unsupported SCRAM mechanism %q", req.Mechanism)
+	}
+
+	password, err := saslPrep(req.Password)
+	if err != nil {
+		return nil, err
+	}
+	m.password = password
+
+	switch {
+	case plus && !isTLS:
+		return nil, fmt.Errorf("ldap: %s requires a TLS connection for channel binding", req.Mechanism)
+	case plus:
+		bindingType := req.ChannelBinding
+		if bindingType == "" {
+			bindingType = defaultChannelBinding(state)
+		}
+		m.channelBinding, err = channelBindingData(state, bindingType)
+		if err != nil {
+			return nil, err
+		}
+		m.gs2Header = "p=" + bindingType + ","
+	case isTLS && req.ServerWithoutChannelBinding:
+		// channel binding is supported, but not by the server
+		m.gs2Header = "y,"
+	default:
+		m.gs2Header = "n,"
+	}
+	if req.AuthZID != "" {
+		m.gs2Header += "a=" + scramName(req.AuthZID)
+	}
+	m.gs2Header += ","
+
+	m.username, err = saslPrep(req.Username)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomBytes(24)
+	if err != nil {
+		return nil, err
+	}
+	m.nonce = base64.RawStdEncoding.EncodeToString(nonce)
+	return m, nil
+}
+
+func (m *scramMechanism) Name() string {
+	return m.name
+}
+
+func (m *scramMechanism) Start() ([]byte, error) {
+	m.clientFirstBare = "n=" + scramName(m.username) + ",r=" + m.nonce
+	return []byte(m.gs2Header + m.clientFirstBare), nil
+}
+
+func (m *scramMechanism) Next(challenge []byte) ([]byte, error) {
+	if m.serverSignature == nil {
+		return m.clientFinal(string(challenge))
+	}
+	if err := m.verifyServerFinal(string(challenge)); err != nil {
+		return nil, err
+	}
+	// the server-final-message may be sent as a challenge, the empty response
+	// completes the exchange
+	return []byte{}, nil
+}
+
+// clientFinal processes the server-first-message and returns the
+// client-final-message
+func (m *scramMechanism) clientFinal(serverFirst string) ([]byte, error) {
+	attributes, err := parseSCRAMMessage(serverFirst)
+	if err != nil {
+		return nil, err
+	}
+	if serverError, ok := attributes['e']; ok {
+		return nil, fmt.Errorf("ldap: SCRAM authentication failed: %s", serverError)
+	}
+	if _, ok := attributes['m']; ok {
+		return nil, errors.New("ldap: SCRAM server requires an unsupported extension")
+	}
+	nonce := attributes['r']
+	if !strings.HasPrefix(nonce, m.nonce) || len(nonce) == len(m.nonce) {
+		return nil, errors.New("ldap: SCRAM server nonce does not extend the client nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attributes['s'])
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("ldap: SCRAM server sent an invalid salt")
+	}
+	iterations, err := strconv.Atoi(attributes['i'])
+	if err != nil || iterations <= 0 {
+		return nil, errors.New("ldap: SCRAM server sent an invalid iteration count")
+	}
+	if iterations > scramMaxIterations {
+		return nil, fmt.Errorf("ldap: SCRAM server iteration count %d exceeds the limit of %d", iterations, scramMaxIterations)
+	}
+
+	saltedPassword, err := pbkdf2.Key(m.hash, m.password, salt, iterations, m.hash().Size())
+	if err != nil {
+		return nil, fmt.Errorf("ldap: SCRAM: %w", err)
+	}
+	clientKey := m.hmac(saltedPassword, "Client Key")
+	storedKey := m.hash()
+	storedKey.Write(clientKey)
+
+	channelBinding := base64.StdEncoding.EncodeToString(append([]byte(m.gs2Header), m.channelBinding...))
+	clientFinalWithoutProof := "c=" + channelBinding + ",r=" + nonce
+	authMessage := m.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof
+
+	proof := m.hmac(storedKey.Sum(nil), authMessage)
+	subtle.XORBytes(proof, proof, clientKey)
+	m.serverSignature = m.hmac(m.hmac(saltedPassword, "Server Key"), authMessage)
+
+	return []byte(clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verifyServerFinal checks the server signature of the server-final-message
+func (m *scramMechanism) verifyServerFinal(serverFinal string) error {
+	attributes, err := parseSCRAMMessage(serverFinal)
+	if err != nil {
+		return err
+	}
+	if serverError, ok := attributes['e']; ok {
+		return fmt.Errorf("ldap: SCRAM authentication failed: %s", serverError)
+	}
+	signature, err := base64.StdEncoding.DecodeString(attributes['v'])
+	if err != nil || !hmac.Equal(signature, m.serverSignature) {
+		return ErrSCRAMServerSignature
+	}
+	m.verified = true
+	return nil
+}
+
+func (m *scramMechanism) hmac(key []byte, message string) []byte {
+	mac := hmac.New(m.hash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// parseSCRAMMessage splits a SCRAM message into its attributes
+func parseSCRAMMessage(message string) (map[byte]string, error) {
+	attributes := make(map[byte]string)
+	for _, attribute := range strings.Split(message, ",") {
+		if len(attribute) < 2 || attribute[1] != '=' {
+			return nil, fmt.Errorf("ldap: invalid SCRAM message %q", message)
+		}
+		attributes[attribute[0]] = attribute[2:]
+	}
+	return attributes, nil
+}
+
+// scramName escapes a name for use in a SCRAM message
+func scramName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
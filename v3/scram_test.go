@@ -0,0 +1,206 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors of RFC 5802 section 5 and RFC 7677 section 3
+var scramTestVectors = []struct {
+	mechanism   string
+	nonce       string
+	clientFirst string
+	serverFirst string
+	clientFinal string
+	serverFinal string
+}{
+	{
+		mechanism:   SCRAMSHA1,
+		nonce:       "fyko+d2lbbFgONRv9qkxdawL",
+		clientFirst: "n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL",
+		serverFirst: "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+		clientFinal: "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+		serverFinal: "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+	},
+	{
+		mechanism:   SCRAMSHA256,
+		nonce:       "rOprNGfwEbeRWgbNEkqO",
+		clientFirst: "n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+		serverFirst: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		clientFinal: "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		serverFinal: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+	},
+}
+
+func TestSCRAMMechanism(t *testing.T) {
+	for _, vector := range scramTestVectors {
+		t.Run(vector.mechanism, func(t *testing.T) {
+			m, err := newSCRAMMechanism(&SCRAMBindRequest{Mechanism: vector.mechanism, Username: "user", Password: "pencil"}, tls.ConnectionState{}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.nonce = vector.nonce
+
+			clientFirst, err := m.Start()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, vector.clientFirst, string(clientFirst))
+
+			clientFinal, err := m.Next([]byte(vector.serverFirst))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, vector.clientFinal, string(clientFinal))
+
+			_, err = m.Next([]byte(vector.serverFinal))
+			assert.NoError(t, err)
+			assert.True(t, m.verified)
+		})
+	}
+}
+
+func TestSCRAMMechanism_Errors(t *testing.T) {
+	vector := scramTestVectors[1]
+	newMechanism := func() *scramMechanism {
+		m, err := newSCRAMMechanism(&SCRAMBindRequest{Mechanism: SCRAMSHA256, Username: "user", Password: "pencil"}, tls.ConnectionState{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.nonce = vector.nonce
+		_, _ = m.Start()
+		return m
+	}
+
+	for _, serverFirst := range []string{
+		"e=unknown-user",
+		"r=rOprNGfwEbeRWgbNEkqO,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		"r=other,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		"r=rOprNGfwEbeRWgbNEkqOx,s=!,i=4096",
+		"r=rOprNGfwEbeRWgbNEkqOx,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=0",
+		"r=rOprNGfwEbeRWgbNEkqOx,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=2147483647",
+		"m=ext,r=rOprNGfwEbeRWgbNEkqOx,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		"garbage",
+	} {
+		_, err := newMechanism().Next([]byte(serverFirst))
+		assert.Error(t, err, serverFirst)
+	}
+
+	m := newMechanism()
+	if _, err := m.Next([]byte(vector.serverFirst)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := m.Next([]byte("v=AAAA"))
+	assert.ErrorIs(t, err, ErrSCRAMServerSignature)
+	_, err = m.Next([]byte("e=invalid-proof"))
+	assert.EqualError(t, err, "ldap: SCRAM authentication failed: invalid-proof")
+
+	_, err = newSCRAMMechanism(&SCRAMBindRequest{Mechanism: SCRAMSHA256Plus, Username: "user", Password: "pencil"}, tls.ConnectionState{}, false)
+	assert.Error(t, err)
+	_, err = newSCRAMMechanism(&SCRAMBindRequest{Mechanism: "SCRAM-MD5", Username: "user", Password: "pencil"}, tls.ConnectionState{}, false)
+	assert.Error(t, err)
+}
+
+func TestSCRAMMechanism_GS2Header(t *testing.T) {
+	for _, tt := range []struct {
+		serverWithoutChannelBinding bool
+		expected                    string
+	}{
+		{false, "n,a=dn:cn=3Da=2Cdc=3Db,n=u=3Ds=2Cr,r=abc"},
+		{true, "y,a=dn:cn=3Da=2Cdc=3Db,n=u=3Ds=2Cr,r=abc"},
+	} {
+		m, err := newSCRAMMechanism(&SCRAMBindRequest{
+			Mechanism:                   SCRAMSHA256,
+			Username:                    "u=s,r",
+			Password:                    "p",
+			AuthZID:                     "dn:cn=a,dc=b",
+			ServerWithoutChannelBinding: tt.serverWithoutChannelBinding,
+		}, tls.ConnectionState{Version: tls.VersionTLS13}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.nonce = "abc"
+		clientFirst, _ := m.Start()
+		assert.Equal(t, tt.expected, string(clientFirst))
+	}
+}
+
+func TestConn_SCRAMBind(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	// the server answers with the server-first-message of the test vector
+	// extending the nonce of the client and the given server-final-message
+	serve := func(serverFinal string) {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		clientFirst := req.Children[1].Children[2].Children[1].Value.(string)
+		nonce := clientFirst[len("n,,n=user,r="):]
+		serverFirst := "r=" + nonce + "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSaslBindInProgress, serverFirst))
+
+		req, err = ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if serverFinal == "" {
+			_ = ptc.SendResponse(encodeTestResult(req.Children[0].Value.(int64), ApplicationBindResponse, LDAPResultSuccess))
+			return
+		}
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSuccess, serverFinal))
+	}
+
+	go serve("v=AAAA")
+	err := conn.SCRAMBind(SCRAMSHA256, "user", "pencil")
+	assert.ErrorIs(t, err, ErrSCRAMServerSignature)
+
+	go serve("")
+	err = conn.SCRAMBind(SCRAMSHA256, "user", "pencil")
+	assert.ErrorIs(t, err, ErrSCRAMServerSignature)
+
+	go func() {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_ = ptc.SendResponse(encodeTestResult(req.Children[0].Value.(int64), ApplicationBindResponse, LDAPResultAuthMethodNotSupported))
+	}()
+	_, err = conn.SCRAMBindWithResult(context.Background(), &SCRAMBindRequest{Mechanism: SCRAMSHA1, Username: "user", Password: "pencil"})
+	assert.True(t, IsErrorWithCode(err, LDAPResultAuthMethodNotSupported))
+	assert.Contains(t, err.Error(), "does not support the SASL mechanism SCRAM-SHA-1")
+
+	assert.True(t, IsErrorWithCode(conn.SCRAMBind(SCRAMSHA256, "user", ""), ErrorEmptyPassword))
+}
+
+func TestSASLPrep(t *testing.T) {
+	for input, expected := range map[string]string{
+		"user":              "user",
+		"I\u00adX":          "IX",
+		"a\u00a0b":          "a b",
+		"caf\u00e9":         "caf\u00e9",
+		"zero\u200bwide":    "zerowide",
+		"\u2003\ufeffspace": " space",
+	} {
+		prepared, err := saslPrep(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected, prepared, input)
+	}
+	for _, input := range []string{"a\u0007b", "\ue000", "a\uffff"} {
+		_, err := saslPrep(input)
+		assert.Error(t, err, input)
+	}
+}
@@ -434,6 +434,9 @@ type SearchRequest struct {
 	Attributes   []string
 	Controls     []Control
 
+	// FilterTree, if set, is sent instead of Filter
+	FilterTree Filter
+
 	// EnforceSizeLimit will hard limit the maximum number of entries parsed, in case the directory
 	// server returns more results than requested. This setting is disabled by default and does not
 	// work in async search requests.
@@ -449,11 +452,15 @@ func (req *SearchRequest) appendTo(envelope *ber.Packet) error {
 	pkt.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, uint64(req.TimeLimit), "Time Limit"))
 	pkt.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, req.TypesOnly, "Types Only"))
 	// compile and encode filter
-	filterPacket, err := CompileFilter(req.Filter)
-	if err != nil {
-		return err
+	if req.FilterTree != nil {
+		pkt.AppendChild(req.FilterTree.Encode())
+	} else {
+		filterPacket, err := CompileFilter(req.Filter)
+		if err != nil {
+			return err
+		}
+		pkt.AppendChild(filterPacket)
 	}
-	pkt.AppendChild(filterPacket)
 	// encode attributes
 	attributesPacket := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
 	for _, attribute := range req.Attributes {
@@ -565,6 +572,26 @@ func (l *Conn) SearchWithPaging(searchRequest *SearchRequest, pagingSize uint32)
 
 // Search performs the given search request
 func (l *Conn) Search(searchRequest *SearchRequest) (*SearchResult, error) {
+	controls, removed := l.negotiateControls("search", searchRequest.BaseDN, searchRequest.Controls,
+		ControlTypeServerSideSorting, ControlTypePaging)
+	if len(removed) == 0 {
+		return l.search(searchRequest)
+	}
+
+	req := *searchRequest
+	req.Controls = controls
+	result, err := l.search(&req)
+	if result != nil {
+		for _, control := range removed {
+			if sorting, ok := control.(*ControlServerSideSorting); ok {
+				sortEntries(result.Entries, sorting.SortKeys)
+			}
+		}
+	}
+	return result, err
+}
+
+func (l *Conn) search(searchRequest *SearchRequest) (*SearchResult, error) {
 	msgCtx, err := l.doRequest(searchRequest)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,419 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// Mechanism OIDs used with SPNEGO
+const (
+	spnegoOID           = "1.3.6.1.5.5.2"
+	spnegoKerberosOID   = "1.2.840.113554.1.2.2"
+	spnegoMSKerberosOID = "1.2.840.48018.1.2.2"
+	spnegoNTLMOID       = "1.3.6.1.4.1.311.2.2.10"
+)
+
+// spnegoMaxWrapSize is the maximum number of bytes protected at once by the
+// security layer, which is not negotiated with GSS-SPNEGO
+const spnegoMaxWrapSize = 64 * 1024
+
+// SPNEGO negotiation states, see RFC 4178 section 4.2.2
+const (
+	spnegoNegStateAbsent   = -1
+	spnegoAcceptCompleted  = 0
+	spnegoAcceptIncomplete = 1
+	spnegoReject           = 2
+	spnegoRequestMIC       = 3
+)
+
+// GSSAPIMICClient is implemented by a GSSAPIClient which can compute and
+// verify message integrity codes, as needed for the mechListMIC of SPNEGO.
+// See RFC 2743 section 2.3.1.
+type GSSAPIMICClient interface {
+	GSSAPIClient
+	// GetMIC returns a token protecting the integrity of the message.
+	GetMIC(message []byte) ([]byte, error)
+	// VerifyMIC verifies a token of the server for the message.
+	VerifyMIC(message, token []byte) error
+}
+
+// SPNEGOBindRequest represents a GSS-SPNEGO SASL bind request, which
+// negotiates Kerberos or NTLM as described in RFC 4178 and MS-SPNG.
+//
+// Kerberos is offered first if the client can obtain a ticket for the
+// service principal, followed by NTLM with the given credentials, so the
+// server can select NTLM instead. The mechListMIC of the server is then
+// required to detect downgrades.
+type SPNEGOBindRequest struct {
+	// (Optional) Kerberos is the client used for Kerberos, e.g. a gssapi.Client.
+	// It has to implement GSSAPIMICClient to validate the mechListMIC.
+	Kerberos GSSAPIClient
+	// Service Principal Name used for the Kerberos service ticket. Eg. "ldap/<host>"
+	ServicePrincipalName string
+	// (Optional) SecurityLayer protecting the connection after a Kerberos
+	// bind, GSSAPISecurityLayerIntegrity or GSSAPISecurityLayerConfidentiality.
+	// GSS-SPNEGO does not negotiate it in the SASL exchange, it has to match
+	// what the server expects for the context flags requested by the client.
+	// Requires a client implementing GSSAPISecurityLayerClient.
+	SecurityLayer byte
+
+	// (Optional) Username is the NTLM user name, the domain is only sent for
+	// a username of the form DOMAIN\user
+	Username string
+	// (Optional) Password is the NTLM password
+	Password string
+	// (Optional) Hash is the hex NTLM hash used instead of the password
+	Hash string
+
+	// (Optional) Controls to send with the bind request
+	Controls []Control
+}
+
+// SPNEGOBind performs the GSS-SPNEGO SASL bind defined in the given request
+func (l *Conn) SPNEGOBind(req *SPNEGOBindRequest) error {
+	_, err := l.SPNEGOBindWithResult(context.Background(), req)
+	return err
+}
+
+// SPNEGOBindWithResult performs the GSS-SPNEGO SASL bind defined in the given
+// request and returns the response of the server
+func (l *Conn) SPNEGOBindWithResult(ctx context.Context, req *SPNEGOBindRequest) (*SASLBindResult, error) {
+	if req.Kerberos == nil && req.Username == "" {
+		return nil, errors.New("ldap: SPNEGO requires a Kerberos client or NTLM credentials")
+	}
+	if req.Username != "" && req.Password == "" && req.Hash == "" {
+		return nil, NewError(ErrorEmptyPassword, errors.New("ldap: empty password not allowed by the client"))
+	}
+
+	mechanism := &spnegoMechanism{req: req}
+	if req.Username != "" {
+		ntlm, err := newNTLMSession(req.Username, req.Password, req.Hash, GSSAPISecurityLayerNone)
+		if err != nil {
+			return nil, err
+		}
+		// security layers require Kerberos, the key exchange protects the
+		// mechListMIC
+		ntlm.keyExchange = true
+		if state, ok := l.TLSConnectionState(); ok {
+			if err := ntlm.setChannelBinding(state); err != nil {
+				return nil, err
+			}
+		}
+		mechanism.ntlm = ntlm
+	}
+	var saslMechanism SASLMechanism = mechanism
+	switch req.SecurityLayer {
+	case 0, GSSAPISecurityLayerNone:
+	case GSSAPISecurityLayerIntegrity, GSSAPISecurityLayerConfidentiality:
+		layerClient, ok := req.Kerberos.(GSSAPISecurityLayerClient)
+		if !ok {
+			return nil, errors.New("ldap: Kerberos client does not support security layers")
+		}
+		mechanism.layerClient = layerClient
+		saslMechanism = &spnegoSecurityLayerMechanism{mechanism}
+	default:
+		return nil, fmt.Errorf("ldap: invalid GSSAPI security layer %#x", req.SecurityLayer)
+	}
+	if req.Kerberos != nil {
+		defer func() {
+			if !mechanism.protected() {
+				//nolint:errcheck
+				req.Kerberos.DeleteSecContext()
+			}
+		}()
+	}
+
+	result, err := l.SASLBind(ctx, saslMechanism, req.Controls)
+	if err != nil {
+		return result, err
+	}
+	switch {
+	case !mechanism.complete:
+		return nil, errors.New("ldap: SPNEGO bind succeeded without the server completing the negotiation")
+	case mechanism.layerClient != nil && !mechanism.protected():
+		return nil, errors.New("ldap: SPNEGO negotiated NTLM, security layers require Kerberos")
+	}
+	return result, nil
+}
+
+// spnegoMechanism is the client side of the GSS-SPNEGO SASL mechanism
+type spnegoMechanism struct {
+	req         *SPNEGOBindRequest
+	layerClient GSSAPISecurityLayerClient
+	ntlm        *ntlmSession
+
+	// mechTypes is the DER encoding of the offered mechanisms protected by
+	// the mechListMIC
+	mechTypes []byte
+	// first is the OID of the mechanism of the initial token, selected the
+	// OID of the mechanism in use
+	first    string
+	selected string
+	// kerberosContinue is set while the Kerberos context is not established
+	kerberosContinue bool
+	micVerified      bool
+	micSent          bool
+	complete         bool
+}
+
+func (m *spnegoMechanism) Name() string {
+	return "GSS-SPNEGO"
+}
+
+func (m *spnegoMechanism) Start() ([]byte, error) {
+	var mechToken []byte
+	var kerberosErr error
+	if m.req.Kerberos != nil {
+		mechToken, m.kerberosContinue, kerberosErr = m.req.Kerberos.InitSecContext(m.req.ServicePrincipalName, nil)
+		if kerberosErr == nil {
+			m.selected = spnegoKerberosOID
+		}
+	}
+	if m.selected == "" {
+		if m.ntlm == nil {
+			return nil, fmt.Errorf("ldap: no SPNEGO mechanism available: %w", kerberosErr)
+		}
+		mechToken, m.selected = m.ntlm.negotiate(), spnegoNTLMOID
+	}
+
+	m.first = m.selected
+
+	mechTypes := ber.NewSequence("MechTypeList")
+	mechTypes.AppendChild(ber.NewOID(ber.ClassUniversal, ber.TypePrimitive, ber.TagObjectIdentifier, m.selected, "MechType"))
+	if m.selected == spnegoKerberosOID && m.ntlm != nil {
+		mechTypes.AppendChild(ber.NewOID(ber.ClassUniversal, ber.TypePrimitive, ber.TagObjectIdentifier, spnegoNTLMOID, "MechType"))
+	}
+	m.mechTypes = mechTypes.Bytes()
+	return encodeSPNEGOInit(mechTypes, mechToken), nil
+}
+
+func (m *spnegoMechanism) Next(challenge []byte) ([]byte, error) {
+	if m.complete {
+		return nil, errors.New("ldap: unexpected SPNEGO token after completion")
+	}
+	resp, err := decodeSPNEGOResponse(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if resp.negState == spnegoReject {
+		return nil, errors.New("ldap: SPNEGO negotiation rejected by the server")
+	}
+
+	supportedMech := resp.supportedMech
+	if supportedMech == spnegoMSKerberosOID {
+		supportedMech = spnegoKerberosOID
+	}
+	var output []byte
+	switch {
+	case supportedMech == "" || supportedMech == m.selected:
+	case supportedMech == spnegoNTLMOID && m.ntlm != nil && m.ntlm.negotiateMessage == nil:
+		// the server rejected the Kerberos token, NTLM starts over
+		m.selected, m.kerberosContinue = spnegoNTLMOID, false
+		output = m.ntlm.negotiate()
+	default:
+		return nil, fmt.Errorf("ldap: SPNEGO server selected the mechanism %s which was not offered", resp.supportedMech)
+	}
+
+	if len(resp.responseToken) > 0 {
+		if output != nil {
+			return nil, errors.New("ldap: SPNEGO server sent a token before the NTLM negotiation")
+		}
+		output, err = m.processToken(resp.responseToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(resp.mechListMIC) > 0 {
+		micClient, ok := m.micClient()
+		if !ok {
+			return nil, fmt.Errorf("ldap: cannot verify the SPNEGO mechListMIC of mechanism %s", m.selected)
+		}
+		if err := micClient.VerifyMIC(m.mechTypes, resp.mechListMIC); err != nil {
+			return nil, fmt.Errorf("ldap: invalid SPNEGO mechListMIC: %w", err)
+		}
+		m.micVerified = true
+	}
+
+	// the client sends its MIC when requested, when the server sent one it
+	// still expects an answer to, or with the NTLM AUTHENTICATE message if
+	// it carries a MIC as described in MS-SPNG section 3.1.5.1 or if the
+	// server did not select the first mechanism
+	ntlmAuthenticate := m.selected == spnegoNTLMOID && len(output) > 0 && m.ntlm.signed()
+	var mic []byte
+	if !m.micSent && (resp.negState == spnegoRequestMIC || m.micVerified && resp.negState == spnegoAcceptIncomplete ||
+		ntlmAuthenticate && (m.ntlm.withMIC || m.selected != m.first)) {
+		micClient, ok := m.micClient()
+		if !ok {
+			return nil, fmt.Errorf("ldap: cannot compute the SPNEGO mechListMIC of mechanism %s", m.selected)
+		}
+		if mic, err = micClient.GetMIC(m.mechTypes); err != nil {
+			return nil, err
+		}
+		m.micSent = true
+	}
+
+	if resp.negState == spnegoAcceptCompleted {
+		if m.selected == spnegoKerberosOID && m.kerberosContinue {
+			return nil, errors.New("ldap: SPNEGO server completed the negotiation without completing Kerberos mutual authentication")
+		}
+		// the mechanism list is only protected by the mechListMIC, see RFC
+		// 4178 section 5
+		if m.selected != m.first && !m.micVerified {
+			return nil, fmt.Errorf("ldap: SPNEGO server selected the mechanism %s without sending the mechListMIC", m.selected)
+		}
+		m.complete = true
+	}
+	return encodeSPNEGOResponse(output, mic), nil
+}
+
+// processToken passes a token of the server to the selected mechanism
+func (m *spnegoMechanism) processToken(token []byte) ([]byte, error) {
+	if m.selected == spnegoKerberosOID {
+		output, needContinue, err := m.req.Kerberos.InitSecContext(m.req.ServicePrincipalName, token)
+		if err != nil {
+			return nil, err
+		}
+		m.kerberosContinue = needContinue
+		return output, nil
+	}
+
+	if m.ntlm.flags != 0 {
+		return nil, errors.New("ldap: unexpected NTLM token after the challenge")
+	}
+	return m.ntlm.authenticate(token)
+}
+
+// spnegoMICClient computes and verifies the mechListMIC
+type spnegoMICClient interface {
+	GetMIC(message []byte) ([]byte, error)
+	VerifyMIC(message, token []byte) error
+}
+
+// micClient returns the client computing the mechListMIC of the selected
+// mechanism, if it supports it
+func (m *spnegoMechanism) micClient() (spnegoMICClient, bool) {
+	if m.selected == spnegoNTLMOID {
+		return m.ntlm, m.ntlm.signed()
+	}
+	if m.selected != spnegoKerberosOID || m.kerberosContinue {
+		return nil, false
+	}
+	micClient, ok := m.req.Kerberos.(GSSAPIMICClient)
+	return micClient, ok
+}
+
+// protected reports whether the security layer is used after the bind
+func (m *spnegoMechanism) protected() bool {
+	return m.layerClient != nil && m.complete && m.selected == spnegoKerberosOID
+}
+
+// spnegoSecurityLayerMechanism is a spnegoMechanism protecting the
+// connection after a Kerberos bind
+type spnegoSecurityLayerMechanism struct {
+	*spnegoMechanism
+}
+
+func (m *spnegoSecurityLayerMechanism) SecurityLayer() (bool, int) {
+	return m.protected(), spnegoMaxWrapSize
+}
+
+func (m *spnegoSecurityLayerMechanism) Wrap(data []byte) ([]byte, error) {
+	return m.layerClient.Wrap(data, m.req.SecurityLayer == GSSAPISecurityLayerConfidentiality)
+}
+
+func (m *spnegoSecurityLayerMechanism) Unwrap(data []byte) ([]byte, error) {
+	return m.layerClient.Unwrap(data)
+}
+
+func (m *spnegoSecurityLayerMechanism) confidential() bool {
+	return m.req.SecurityLayer == GSSAPISecurityLayerConfidentiality
+}
+
+// encodeSPNEGOInit returns the initial context token with the NegTokenInit
+// offering the mechanisms, see RFC 4178 section 4.2.1
+func encodeSPNEGOInit(mechTypes *ber.Packet, mechToken []byte) []byte {
+	types := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "mechTypes")
+	types.AppendChild(mechTypes)
+
+	negTokenInit := ber.NewSequence("NegTokenInit")
+	negTokenInit.AppendChild(types)
+	if mechToken != nil {
+		negTokenInit.AppendChild(encodeSPNEGOOctetString(2, mechToken, "mechToken"))
+	}
+
+	negotiationToken := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "negTokenInit")
+	negotiationToken.AppendChild(negTokenInit)
+
+	token := ber.Encode(ber.ClassApplication, ber.TypeConstructed, 0, nil, "InitialContextToken")
+	token.AppendChild(ber.NewOID(ber.ClassUniversal, ber.TypePrimitive, ber.TagObjectIdentifier, spnegoOID, "thisMech"))
+	token.AppendChild(negotiationToken)
+	return token.Bytes()
+}
+
+// encodeSPNEGOResponse returns a NegTokenResp with the optional response
+// token and mechListMIC, see RFC 4178 section 4.2.2
+func encodeSPNEGOResponse(responseToken, mechListMIC []byte) []byte {
+	negTokenResp := ber.NewSequence("NegTokenResp")
+	if len(responseToken) > 0 {
+		negTokenResp.AppendChild(encodeSPNEGOOctetString(2, responseToken, "responseToken"))
+	}
+	if len(mechListMIC) > 0 {
+		negTokenResp.AppendChild(encodeSPNEGOOctetString(3, mechListMIC, "mechListMIC"))
+	}
+	token := ber.Encode(ber.ClassContext, ber.TypeConstructed, 1, nil, "negTokenResp")
+	token.AppendChild(negTokenResp)
+	return token.Bytes()
+}
+
+func encodeSPNEGOOctetString(tag ber.Tag, value []byte, description string) *ber.Packet {
+	field := ber.Encode(ber.ClassContext, ber.TypeConstructed, tag, nil, description)
+	field.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(value), description))
+	return field
+}
+
+// spnegoResponse is a NegTokenResp of the server
+type spnegoResponse struct {
+	negState      int64
+	supportedMech string
+	responseToken []byte
+	mechListMIC   []byte
+}
+
+func decodeSPNEGOResponse(data []byte) (*spnegoResponse, error) {
+	packet, err := ber.DecodePacketErr(data)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid SPNEGO token: %w", err)
+	}
+	if packet.ClassType != ber.ClassContext || packet.Tag != 1 || len(packet.Children) != 1 {
+		return nil, errors.New("ldap: SPNEGO token is not a NegTokenResp")
+	}
+
+	resp := &spnegoResponse{negState: spnegoNegStateAbsent}
+	for _, field := range packet.Children[0].Children {
+		if field.ClassType != ber.ClassContext || len(field.Children) != 1 {
+			return nil, errors.New("ldap: invalid field in SPNEGO NegTokenResp")
+		}
+		value := field.Children[0]
+		var ok bool
+		switch field.Tag {
+		case 0:
+			resp.negState, ok = value.Value.(int64)
+		case 1:
+			resp.supportedMech, ok = value.Value.(string)
+		case 2:
+			resp.responseToken, ok = value.Data.Bytes(), value.Tag == ber.TagOctetString
+		case 3:
+			resp.mechListMIC, ok = value.Data.Bytes(), value.Tag == ber.TagOctetString
+		default:
+			ok = true
+		}
+		if !ok {
+			return nil, fmt.Errorf("ldap: invalid field %d in SPNEGO NegTokenResp", field.Tag)
+		}
+	}
+	return resp, nil
+}
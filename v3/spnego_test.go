@@ -0,0 +1,349 @@
+package ldap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSPNEGOKerberosClient computes the MIC by prefixing the message
+type testSPNEGOKerberosClient struct {
+	testGSSAPIClient
+	noTicket bool
+}
+
+func (c *testSPNEGOKerberosClient) InitSecContext(target string, token []byte) ([]byte, bool, error) {
+	if c.noTicket {
+		return nil, false, errors.New("no ticket")
+	}
+	return c.InitSecContextWithOptions(target, token, nil)
+}
+
+func (c *testSPNEGOKerberosClient) GetMIC(message []byte) ([]byte, error) {
+	return append([]byte("client-mic:"), message...), nil
+}
+
+func (c *testSPNEGOKerberosClient) VerifyMIC(message, token []byte) error {
+	if !bytes.Equal(token, append([]byte("server-mic:"), message...)) {
+		return errors.New("MIC mismatch")
+	}
+	return nil
+}
+
+func encodeTestSPNEGOResponse(negState int64, supportedMech string, responseToken, mechListMIC []byte) string {
+	negTokenResp := ber.NewSequence("NegTokenResp")
+	if negState >= 0 {
+		field := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "negState")
+		field.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, negState, "negState"))
+		negTokenResp.AppendChild(field)
+	}
+	if supportedMech != "" {
+		field := ber.Encode(ber.ClassContext, ber.TypeConstructed, 1, nil, "supportedMech")
+		field.AppendChild(ber.NewOID(ber.ClassUniversal, ber.TypePrimitive, ber.TagObjectIdentifier, supportedMech, "supportedMech"))
+		negTokenResp.AppendChild(field)
+	}
+	if responseToken != nil {
+		negTokenResp.AppendChild(encodeSPNEGOOctetString(2, responseToken, "responseToken"))
+	}
+	if mechListMIC != nil {
+		negTokenResp.AppendChild(encodeSPNEGOOctetString(3, mechListMIC, "mechListMIC"))
+	}
+	token := ber.Encode(ber.ClassContext, ber.TypeConstructed, 1, nil, "negTokenResp")
+	token.AppendChild(negTokenResp)
+	return string(token.Bytes())
+}
+
+// decodeTestSPNEGOInit returns the offered mechanisms, the DER encoded
+// mechanism list and the mechanism token of an initial context token
+func decodeTestSPNEGOInit(t *testing.T, data []byte) ([]string, []byte, []byte) {
+	packet, err := ber.DecodePacketErr(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ber.ClassApplication, packet.ClassType)
+	assert.Equal(t, spnegoOID, packet.Children[0].Value)
+	negTokenInit := packet.Children[1].Children[0]
+	mechTypes := negTokenInit.Children[0].Children[0]
+	var mechs []string
+	for _, mech := range mechTypes.Children {
+		mechs = append(mechs, mech.Value.(string))
+	}
+	return mechs, mechTypes.Bytes(), negTokenInit.Children[1].Children[0].Data.Bytes()
+}
+
+// testNTLMChallenge is a minimal NTLM CHALLENGE message
+func testNTLMChallenge() []byte {
+	challenge := []byte("NTLMSSP\x00")
+	for _, field := range []uint32{
+		// message type
+		2,
+		// target name length and offset
+		0, 48,
+		// flags: unicode, NTLM, extended session security, target info
+		0x00880201,
+		// server challenge and reserved bytes
+		0x01234567, 0x89ab, 0, 0,
+		// target info length and offset
+		4 | 4<<16, 48,
+	} {
+		challenge = binary.LittleEndian.AppendUint32(challenge, field)
+	}
+	// MsvAvEOL
+	return append(challenge, 0, 0, 0, 0)
+}
+
+// testSPNEGONTLMChallenge returns an NTLM CHALLENGE message with a timestamp,
+// so the client adds a MIC to the AUTHENTICATE message
+func testSPNEGONTLMChallenge(flags uint32) []byte {
+	targetInfo := appendNTLMAvPair(nil, ntlmAvTimestamp, make([]byte, 8))
+	return testNTLMChallengeWithTargetInfo(flags, appendNTLMAvPair(targetInfo, ntlmAvEOL, nil))
+}
+
+// decodeTestSPNEGOAuthenticate returns the server side of the NTLM session
+// of the AUTHENTICATE message of user EXAMPLE\user with the password
+// "password", and the mechListMIC sent with it
+func decodeTestSPNEGOAuthenticate(t *testing.T, req *ber.Packet, flags uint32) (*ntlmSession, []byte) {
+	resp, err := decodeSPNEGOResponse(req.Children[1].Children[2].Children[1].Data.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "NTLMSSP\x00\x03", string(resp.responseToken[:9]))
+	ntResponse, _ := ntlmField(resp.responseToken, 20)
+	encryptedSessionKey, _ := ntlmField(resp.responseToken, 52)
+	responseKey := ntlmV2ResponseKey(decodeTestHex(t, "8846f7eaee8fb117ad06bdd830b7586c"), "user", "EXAMPLE")
+	exportedSessionKey := ntlmRC4(ntlmHMAC(responseKey, ntResponse[:16]), encryptedSessionKey)
+	return newTestNTLMServer(t, &ntlmSession{flags: flags}, exportedSessionKey), resp.mechListMIC
+}
+
+func TestConn_SPNEGOBindKerberos(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	serve := func(mic string) {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		auth := req.Children[1].Children[2]
+		assert.Equal(t, "GSS-SPNEGO", auth.Children[0].Value)
+		mechs, mechTypes, mechToken := decodeTestSPNEGOInit(t, auth.Children[1].Data.Bytes())
+		assert.Equal(t, []string{spnegoKerberosOID}, mechs)
+		assert.Equal(t, "ap-req ldap/host", string(mechToken))
+
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSuccess,
+			encodeTestSPNEGOResponse(spnegoAcceptCompleted, spnegoMSKerberosOID, []byte("ap-rep"), append([]byte(mic), mechTypes...))))
+	}
+
+	go serve("server-mic:")
+	client := &testSPNEGOKerberosClient{}
+	if err := conn.SPNEGOBind(&SPNEGOBindRequest{Kerberos: client, ServicePrincipalName: "ldap/host"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, client.deleted)
+
+	go serve("forged-mic:")
+	err := conn.SPNEGOBind(&SPNEGOBindRequest{Kerberos: &testSPNEGOKerberosClient{}, ServicePrincipalName: "ldap/host"})
+	assert.ErrorContains(t, err, "invalid SPNEGO mechListMIC")
+}
+
+func TestConn_SPNEGOBindNTLMFallback(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	go func() {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mechs, _, mechToken := decodeTestSPNEGOInit(t, req.Children[1].Children[2].Children[1].Data.Bytes())
+		assert.Equal(t, []string{spnegoNTLMOID}, mechs)
+		assert.Equal(t, "NTLMSSP\x00\x01", string(mechToken[:9]))
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSaslBindInProgress,
+			encodeTestSPNEGOResponse(spnegoAcceptIncomplete, spnegoNTLMOID, testNTLMChallenge(), nil)))
+
+		req, err = ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp, err := decodeSPNEGOResponse(req.Children[1].Children[2].Children[1].Data.Bytes())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, "NTLMSSP\x00\x03", string(resp.responseToken[:9]))
+		assert.Nil(t, resp.mechListMIC)
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSuccess,
+			encodeTestSPNEGOResponse(spnegoAcceptCompleted, "", nil, nil)))
+	}()
+
+	err := conn.SPNEGOBind(&SPNEGOBindRequest{
+		Kerberos: &testSPNEGOKerberosClient{noTicket: true},
+		Username: `EXAMPLE\user`,
+		Password: "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.SPNEGOBind(&SPNEGOBindRequest{Kerberos: &testSPNEGOKerberosClient{noTicket: true}})
+	assert.ErrorContains(t, err, "no ticket")
+	assert.True(t, IsErrorWithCode(conn.SPNEGOBind(&SPNEGOBindRequest{Username: "user"}), ErrorEmptyPassword))
+}
+
+func TestConn_SPNEGOBindNTLMMIC(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	serve := func(forged bool) {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, mechTypes, negotiate := decodeTestSPNEGOInit(t, req.Children[1].Children[2].Children[1].Data.Bytes())
+		flags := binary.LittleEndian.Uint32(negotiate[12:])
+		assert.Zero(t, flags&ntlmNegotiateSign)
+		assert.NotZero(t, flags&ntlmNegotiateKeyExchange)
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSaslBindInProgress,
+			encodeTestSPNEGOResponse(spnegoAcceptIncomplete, spnegoNTLMOID, testSPNEGONTLMChallenge(flags), nil)))
+
+		req, err = ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		server, mechListMIC := decodeTestSPNEGOAuthenticate(t, req, flags)
+		assert.NoError(t, server.VerifyMIC(mechTypes, mechListMIC))
+
+		mic, _ := server.GetMIC(mechTypes)
+		if forged {
+			mic[len(mic)-1] ^= 1
+		}
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSuccess,
+			encodeTestSPNEGOResponse(spnegoAcceptCompleted, "", nil, mic)))
+	}
+
+	req := &SPNEGOBindRequest{
+		Username: `EXAMPLE\user`,
+		Hash:     "8846f7eaee8fb117ad06bdd830b7586c",
+	}
+	go serve(false)
+	if err := conn.SPNEGOBind(req); err != nil {
+		t.Fatal(err)
+	}
+
+	go serve(true)
+	assert.ErrorContains(t, conn.SPNEGOBind(req), "invalid SPNEGO mechListMIC")
+}
+
+func TestDecodeSPNEGOResponse(t *testing.T) {
+	resp, err := decodeSPNEGOResponse([]byte(encodeTestSPNEGOResponse(spnegoRequestMIC, spnegoKerberosOID, []byte("token"), []byte("mic"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &spnegoResponse{
+		negState:      spnegoRequestMIC,
+		supportedMech: spnegoKerberosOID,
+		responseToken: []byte("token"),
+		mechListMIC:   []byte("mic"),
+	}, resp)
+
+	_, err = decodeSPNEGOResponse(encodeSPNEGOInit(ber.NewSequence("MechTypeList"), nil))
+	assert.Error(t, err)
+	_, err = decodeSPNEGOResponse([]byte{0xa1, 0x05})
+	assert.Error(t, err)
+}
+
+func TestConn_SPNEGOBindNTLMSelected(t *testing.T) {
+	ptc := newPacketTranslatorConn()
+	defer func() { _ = ptc.Close() }()
+
+	conn := NewConn(ptc, false)
+	conn.Start()
+	defer func() { _ = conn.Close() }()
+
+	// the server rejects the Kerberos token and selects NTLM
+	serve := func(withMIC bool) {
+		req, err := ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mechs, mechTypes, mechToken := decodeTestSPNEGOInit(t, req.Children[1].Children[2].Children[1].Data.Bytes())
+		assert.Equal(t, []string{spnegoKerberosOID, spnegoNTLMOID}, mechs)
+		assert.Equal(t, "ap-req ldap/host", string(mechToken))
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSaslBindInProgress,
+			encodeTestSPNEGOResponse(spnegoAcceptIncomplete, spnegoNTLMOID, nil, nil)))
+
+		req, err = ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp, err := decodeSPNEGOResponse(req.Children[1].Children[2].Children[1].Data.Bytes())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, "NTLMSSP\x00\x01", string(resp.responseToken[:9]))
+		flags := binary.LittleEndian.Uint32(resp.responseToken[12:])
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSaslBindInProgress,
+			encodeTestSPNEGOResponse(spnegoAcceptIncomplete, "", testSPNEGONTLMChallenge(flags), nil)))
+
+		req, err = ptc.ReceiveRequest()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		server, mechListMIC := decodeTestSPNEGOAuthenticate(t, req, flags)
+		assert.NoError(t, server.VerifyMIC(mechTypes, mechListMIC))
+
+		var mic []byte
+		if withMIC {
+			mic, _ = server.GetMIC(mechTypes)
+		}
+		_ = ptc.SendResponse(encodeTestBindResponse(req.Children[0].Value.(int64), LDAPResultSuccess,
+			encodeTestSPNEGOResponse(spnegoAcceptCompleted, "", nil, mic)))
+	}
+
+	go serve(true)
+	client := &testSPNEGOKerberosClient{}
+	err := conn.SPNEGOBind(&SPNEGOBindRequest{
+		Kerberos:             client,
+		ServicePrincipalName: "ldap/host",
+		Username:             `EXAMPLE\user`,
+		Password:             "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, client.deleted)
+
+	go serve(false)
+	err = conn.SPNEGOBind(&SPNEGOBindRequest{
+		Kerberos:             &testSPNEGOKerberosClient{},
+		ServicePrincipalName: "ldap/host",
+		Username:             `EXAMPLE\user`,
+		Password:             "password",
+	})
+	assert.ErrorContains(t, err, "without sending the mechListMIC")
+}